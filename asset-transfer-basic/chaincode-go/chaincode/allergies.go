@@ -0,0 +1,335 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+)
+
+// A patient's allergies and intolerances are clinical data, so they are kept in the private
+// data collection under one record per patient, salted like the other private records.
+// Doctors submit them as transient data under allergyTransientKey. CreateAsset refuses a
+// prescription that matches an active allergy unless the transient patient details carry an
+// override with a clinical justification, which is recorded in the prescription's private
+// details.
+const (
+	allergyObjectType   = "allergy"
+	allergyTransientKey = "allergy"
+
+	AllergyTypeAllergy     = "allergy"
+	AllergyTypeIntolerance = "intolerance"
+)
+
+// Allergy is one allergy or intolerance of a patient. Substance is matched against
+// prescriptions by name, and Code by catalogue code; an ATC class code also matches the
+// medications within the class.
+type Allergy struct {
+	AllergyId  string `json:"AllergyId"`
+	Substance  string `json:"Substance"`
+	Code       string `json:"Code,omitempty"`
+	Type       string `json:"Type"`
+	Reaction   string `json:"Reaction,omitempty"`
+	Severity   string `json:"Severity,omitempty"`
+	Active     bool   `json:"Active"`
+	RecordedBy string `json:"RecordedBy"`
+	RecordedAt string `json:"RecordedAt"`
+	RemovedBy  string `json:"RemovedBy,omitempty"`
+	RemovedAt  string `json:"RemovedAt,omitempty"`
+}
+
+// allergyInput is the transient input of RecordAllergy.
+type allergyInput struct {
+	Allergy
+	Salt string `json:"Salt"`
+}
+
+// patientAllergies is the private collection record of a patient's allergies.
+type patientAllergies struct {
+	PatientId string    `json:"PatientId"`
+	Allergies []Allergy `json:"Allergies"`
+	Salt      string    `json:"Salt"`
+}
+
+// AllergyOverride allows a prescription that matches one of the patient's allergies.
+// Clients submit Prescription, the index of the prescription within the submitted asset,
+// with the AllergyId and Justification; the chaincode records who overrode it and when.
+type AllergyOverride struct {
+	Prescription  int    `json:"Prescription,omitempty"`
+	AllergyId     string `json:"AllergyId"`
+	Substance     string `json:"Substance,omitempty"`
+	Justification string `json:"Justification"`
+	OverriddenBy  string `json:"OverriddenBy,omitempty"`
+	Timestamp     string `json:"Timestamp,omitempty"`
+}
+
+// newAllergyId derives an allergy ID from the recording transaction, in the same way as
+// prescription IDs.
+func newAllergyId(txId string, position int) string {
+	if len(txId) > 16 {
+		txId = txId[:16]
+	}
+	return fmt.Sprintf("ALG-%s-%d", txId, position)
+}
+
+func allergyKey(ctx contractapi.TransactionContextInterface, patientId string) (string, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(allergyObjectType, []string{patientId})
+	if err != nil {
+		return "", fmt.Errorf("failed to create allergy key: %v", err)
+	}
+	return key, nil
+}
+
+// readPatientAllergies returns the patient's allergy record, or an empty one.
+func readPatientAllergies(ctx contractapi.TransactionContextInterface, patientId string) (*patientAllergies, error) {
+	key, err := allergyKey(ctx, patientId)
+	if err != nil {
+		return nil, err
+	}
+	recordJSON, err := ctx.GetStub().GetPrivateData(phiCollection, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read allergies: %v", err)
+	}
+
+	record := &patientAllergies{PatientId: patientId, Allergies: []Allergy{}}
+	if recordJSON == nil {
+		return record, nil
+	}
+	if err := json.Unmarshal(recordJSON, record); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+func putPatientAllergies(ctx contractapi.TransactionContextInterface, record *patientAllergies) error {
+	key, err := allergyKey(ctx, record.PatientId)
+	if err != nil {
+		return err
+	}
+	recordJSON, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	if err := ctx.GetStub().PutPrivateData(phiCollection, key, recordJSON); err != nil {
+		return fmt.Errorf("failed to put allergies: %v", err)
+	}
+	return nil
+}
+
+// RecordAllergy - records an allergy or intolerance of the patient, submitted as transient
+// data under "allergy" with a salt. Recording a substance the patient already has an active
+// allergy to replaces that entry. Returns the allergy ID.
+func (s *SmartContract) RecordAllergy(ctx contractapi.TransactionContextInterface, patientId string) (string, error) {
+	doctor, err := s.authorize(ctx, "RecordAllergy")
+	if err != nil {
+		return "", err
+	}
+	if _, err := readPatient(ctx, patientId); err != nil {
+		return "", err
+	}
+
+	transientMap, err := ctx.GetStub().GetTransient()
+	if err != nil {
+		return "", fmt.Errorf("failed to get transient data: %v", err)
+	}
+	inputJSON, ok := transientMap[allergyTransientKey]
+	if !ok || len(inputJSON) == 0 {
+		return "", fmt.Errorf("allergy details must be submitted in the '%s' transient field", allergyTransientKey)
+	}
+	var input allergyInput
+	if err := json.Unmarshal(inputJSON, &input); err != nil {
+		return "", fmt.Errorf("failed to parse transient allergy details: %v", err)
+	}
+	if len(input.Salt) < minSaltLength {
+		return "", fmt.Errorf("salt must be at least %d characters", minSaltLength)
+	}
+	if strings.TrimSpace(input.Substance) == "" {
+		return "", fmt.Errorf("an allergy requires a substance")
+	}
+	switch input.Type {
+	case "":
+		input.Type = AllergyTypeAllergy
+	case AllergyTypeAllergy, AllergyTypeIntolerance:
+	default:
+		return "", fmt.Errorf("invalid allergy type '%s': expected allergy or intolerance", input.Type)
+	}
+
+	clock, err := newTxClock(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	record, err := readPatientAllergies(ctx, patientId)
+	if err != nil {
+		return "", err
+	}
+	allergy := input.Allergy
+	allergy.AllergyId = newAllergyId(ctx.GetStub().GetTxID(), len(record.Allergies))
+	allergy.Active = true
+	allergy.RecordedBy = doctor.EnrollmentID
+	allergy.RecordedAt = clock.Timestamp()
+	allergy.RemovedBy = ""
+	allergy.RemovedAt = ""
+
+	for i := range record.Allergies {
+		existing := &record.Allergies[i]
+		if existing.Active && normalizeMedicationName(existing.Substance) == normalizeMedicationName(allergy.Substance) {
+			existing.Active = false
+			existing.RemovedBy = doctor.EnrollmentID
+			existing.RemovedAt = clock.Timestamp()
+		}
+	}
+	record.Allergies = append(record.Allergies, allergy)
+	record.Salt = input.Salt
+
+	if err := putPatientAllergies(ctx, record); err != nil {
+		return "", err
+	}
+	return allergy.AllergyId, nil
+}
+
+// RemoveAllergy - marks one of the patient's allergies inactive, for example when it was
+// recorded in error. It stays in the record for audit.
+func (s *SmartContract) RemoveAllergy(ctx contractapi.TransactionContextInterface, patientId string, allergyId string) error {
+	doctor, err := s.authorize(ctx, "RemoveAllergy")
+	if err != nil {
+		return err
+	}
+
+	clock, err := newTxClock(ctx)
+	if err != nil {
+		return err
+	}
+
+	record, err := readPatientAllergies(ctx, patientId)
+	if err != nil {
+		return err
+	}
+	for i := range record.Allergies {
+		allergy := &record.Allergies[i]
+		if allergy.AllergyId != allergyId {
+			continue
+		}
+		if !allergy.Active {
+			return fmt.Errorf("allergy %s of patient %s has already been removed", allergyId, patientId)
+		}
+		allergy.Active = false
+		allergy.RemovedBy = doctor.EnrollmentID
+		allergy.RemovedAt = clock.Timestamp()
+		return putPatientAllergies(ctx, record)
+	}
+	return fmt.Errorf("allergy %s not found for patient %s", allergyId, patientId)
+}
+
+// GetPatientAllergies - returns the patient's allergies, including removed ones.
+func (s *SmartContract) GetPatientAllergies(ctx contractapi.TransactionContextInterface, patientId string) ([]Allergy, error) {
+	if _, err := s.authorize(ctx, "GetPatientAllergies"); err != nil {
+		return nil, err
+	}
+
+	record, err := readPatientAllergies(ctx, patientId)
+	if err != nil {
+		return nil, err
+	}
+	return record.Allergies, nil
+}
+
+// matches reports whether the allergy applies to a prescription whose medication has the
+// given catalogue code.
+func (allergy *Allergy) matches(codes *medicationCodes, prescription *Prescription, code string) (bool, error) {
+	substance := normalizeMedicationName(allergy.Substance)
+	if substance == normalizeMedicationName(prescription.MedicationName) ||
+		substance == normalizeMedicationName(prescription.medicationLabel()) {
+		return true, nil
+	}
+	if code == "" {
+		return false, nil
+	}
+
+	allergyCode := allergy.Code
+	if allergyCode == "" {
+		resolved, err := codes.resolve(allergy.Substance)
+		if err != nil {
+			return false, err
+		}
+		allergyCode = resolved
+	}
+	if allergyCode == "" {
+		return false, nil
+	}
+	if allergyCode == code {
+		return true, nil
+	}
+	// An ATC class code covers the codes below it in the classification.
+	return atcCodePattern.MatchString(allergyCode) && atcCodePattern.MatchString(code) && strings.HasPrefix(code, allergyCode), nil
+}
+
+// checkAllergies checks new prescriptions against the patient's active allergies and returns
+// the overrides to record on each prescription. A match without an override that names the
+// allergy and gives a justification is an error.
+func checkAllergies(ctx contractapi.TransactionContextInterface, doctor *caller, clock *txClock, patientId string, prescriptions []Prescription, overrides []AllergyOverride) ([][]AllergyOverride, error) {
+	for _, override := range overrides {
+		if override.Prescription < 0 || override.Prescription >= len(prescriptions) {
+			return nil, fmt.Errorf("allergy override names prescription %d, but %d were submitted", override.Prescription, len(prescriptions))
+		}
+		if strings.TrimSpace(override.Justification) == "" {
+			return nil, fmt.Errorf("an allergy override requires a clinical justification")
+		}
+	}
+
+	record, err := readPatientAllergies(ctx, patientId)
+	if err != nil {
+		return nil, err
+	}
+
+	codes := newMedicationCodes(ctx)
+	recorded := make([][]AllergyOverride, len(prescriptions))
+	used := make([]bool, len(overrides))
+	for i := range prescriptions {
+		prescription := &prescriptions[i]
+		code, err := codes.forPrescription(prescription)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, allergy := range record.Allergies {
+			if !allergy.Active {
+				continue
+			}
+			matches, err := allergy.matches(codes, prescription, code)
+			if err != nil {
+				return nil, err
+			}
+			if !matches {
+				continue
+			}
+
+			overridden := false
+			for j, override := range overrides {
+				if override.Prescription == i && override.AllergyId == allergy.AllergyId {
+					used[j] = true
+					overridden = true
+					recorded[i] = append(recorded[i], AllergyOverride{
+						AllergyId:     allergy.AllergyId,
+						Substance:     allergy.Substance,
+						Justification: override.Justification,
+						OverriddenBy:  doctor.EnrollmentID,
+						Timestamp:     clock.Timestamp(),
+					})
+				}
+			}
+			if !overridden {
+				return nil, fmt.Errorf("prescription %d (%s) matches the patient's %s %s (%s); an override with a clinical justification is required",
+					i, firstNonEmpty(prescription.MedicationName, prescription.medicationLabel()), allergy.Substance, allergy.Type, allergy.AllergyId)
+			}
+		}
+	}
+
+	for j, override := range overrides {
+		if !used[j] {
+			return nil, fmt.Errorf("allergy override for prescription %d names allergy %s, which does not apply to it", override.Prescription, override.AllergyId)
+		}
+	}
+	return recorded, nil
+}
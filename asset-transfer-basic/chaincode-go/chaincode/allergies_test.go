@@ -0,0 +1,141 @@
+package chaincode_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/hyperledger/fabric-chaincode-go/v2/shim"
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode"
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode/mocks"
+	"github.com/stretchr/testify/require"
+)
+
+const testAllergyId = "ALG-4a4e3bdbd2f6e1d3-0"
+
+func withAllergy(ctx contractapi.TransactionContextInterface, allergyJSON string) {
+	ctx.GetStub().(*mocks.ChaincodeStub).GetTransientReturns(map[string][]byte{"allergy": []byte(allergyJSON)}, nil)
+}
+
+// recordAllergy records an allergy for patient1 as doctor1 and returns its ID.
+func recordAllergy(t *testing.T, state ledger, allergyJSON string) string {
+	t.Helper()
+	smartContract := chaincode.SmartContract{}
+	transactionContext, _ := newEndorsement(state, testTxTime, doctorIdentity("doctor1"))
+	withAllergy(transactionContext, allergyJSON)
+	allergyId, err := smartContract.RecordAllergy(transactionContext, "patient1")
+	require.NoError(t, err)
+	return allergyId
+}
+
+func TestRecordAndRemoveAllergies(t *testing.T) {
+	smartContract := chaincode.SmartContract{}
+	state := activePatient(t)
+
+	allergyId := recordAllergy(t, state, `{"Substance":"Penicillin","Code":"J01C","Reaction":"Anaphylaxis","Severity":"severe","Salt":"0123456789abcdef"}`)
+	require.Equal(t, testAllergyId, allergyId)
+
+	// Allergies are private; nothing about them reaches the public state.
+	for key, value := range state {
+		if !strings.HasPrefix(key, privateKey(testCollection, "")) {
+			require.NotContains(t, string(value), "Penicillin", "public key %q", key)
+		}
+	}
+
+	transactionContext, _ := newEndorsement(state, testTxTime, pharmacistIdentity("pharmacist1"))
+	allergies, err := smartContract.GetPatientAllergies(transactionContext, "patient1")
+	require.NoError(t, err)
+	require.Equal(t, []chaincode.Allergy{{
+		AllergyId:  testAllergyId,
+		Substance:  "Penicillin",
+		Code:       "J01C",
+		Type:       "allergy",
+		Reaction:   "Anaphylaxis",
+		Severity:   "severe",
+		Active:     true,
+		RecordedBy: "doctor1",
+		RecordedAt: "2025-03-14T09:30:00Z",
+	}}, allergies)
+
+	transactionContext, _ = newEndorsement(state, testTxTime, pharmacistIdentity("pharmacist1"))
+	withAllergy(transactionContext, `{"Substance":"Latex","Salt":"0123456789abcdef"}`)
+	_, err = smartContract.RecordAllergy(transactionContext, "patient1")
+	require.EqualError(t, err, "caller pharmacist1 with role 'pharmacist' is not permitted to call RecordAllergy")
+
+	transactionContext, _ = newEndorsement(state, testTxTime, doctorIdentity("doctor1"))
+	withAllergy(transactionContext, `{"Substance":"Latex"}`)
+	_, err = smartContract.RecordAllergy(transactionContext, "patient1")
+	require.EqualError(t, err, "salt must be at least 16 characters")
+
+	transactionContext, _ = newEndorsement(state, testTxTime, doctorIdentity("doctor1"))
+	require.NoError(t, smartContract.RemoveAllergy(transactionContext, "patient1", allergyId))
+	transactionContext, _ = newEndorsement(state, testTxTime, doctorIdentity("doctor1"))
+	err = smartContract.RemoveAllergy(transactionContext, "patient1", allergyId)
+	require.EqualError(t, err, "allergy "+testAllergyId+" of patient patient1 has already been removed")
+
+	transactionContext, _ = newEndorsement(state, testTxTime, doctorIdentity("doctor1"))
+	allergies, err = smartContract.GetPatientAllergies(transactionContext, "patient1")
+	require.NoError(t, err)
+	require.False(t, allergies[0].Active)
+	require.Equal(t, "doctor1", allergies[0].RemovedBy)
+}
+
+func TestCreateAssetChecksAllergies(t *testing.T) {
+	smartContract := chaincode.SmartContract{}
+	state := activePatient(t)
+	allergyId := recordAllergy(t, state, `{"Substance":"Ibuprofen","Type":"intolerance","Salt":"0123456789abcdef"}`)
+
+	create := func(state ledger, phiJSON string) (*chaincode.CreateAssetResult, error) {
+		transactionContext, _ := newEndorsement(state, testTxTime, doctorIdentity("doctor1"))
+		withPHI(transactionContext, phiJSON)
+		return smartContract.CreateAsset(transactionContext, `{"PatientId":"patient1","Prescriptions":[{"MedicationName":"Paracetamol"},{"MedicationName":"ibuprofen"}]}`)
+	}
+
+	_, err := create(state.clone(), `{"Salt":"0123456789abcdef","Diagnoses":["Fever","Pain"]}`)
+	require.EqualError(t, err, "prescription 1 (ibuprofen) matches the patient's Ibuprofen intolerance ("+allergyId+"); an override with a clinical justification is required")
+
+	_, err = create(state.clone(), `{"Salt":"0123456789abcdef","Diagnoses":["Fever","Pain"],"AllergyOverrides":[{"Prescription":1,"AllergyId":"`+allergyId+`"}]}`)
+	require.EqualError(t, err, "an allergy override requires a clinical justification")
+
+	_, err = create(state.clone(), `{"Salt":"0123456789abcdef","Diagnoses":["Fever","Pain"],"AllergyOverrides":[{"Prescription":1,"AllergyId":"`+allergyId+`","Justification":"Mild"},{"Prescription":0,"AllergyId":"`+allergyId+`","Justification":"Mild"}]}`)
+	require.EqualError(t, err, "allergy override for prescription 0 names allergy "+allergyId+", which does not apply to it")
+
+	result, err := create(state, `{"Salt":"0123456789abcdef","Diagnoses":["Fever","Pain"],"AllergyOverrides":[{"Prescription":1,"AllergyId":"`+allergyId+`","Justification":"Mild dyspepsia only; benefit outweighs risk"}]}`)
+	require.NoError(t, err)
+
+	// The override is kept with the prescription's private details.
+	key, err := shim.CreateCompositeKey("prescription", []string{"patient1", result.PrescriptionIds[1]})
+	require.NoError(t, err)
+	require.NotContains(t, string(state[key]), "Justification")
+	transactionContext, _ := newEndorsement(state, testTxTime, doctorIdentity("doctor1"))
+	asset, err := smartContract.ReadAsset(transactionContext, "patient1")
+	require.NoError(t, err)
+	var overridden chaincode.Prescription
+	for _, prescription := range asset.Prescriptions {
+		if prescription.PrescriptionId == result.PrescriptionIds[1] {
+			overridden = prescription
+		}
+	}
+	require.Equal(t, []chaincode.AllergyOverride{{
+		AllergyId:     allergyId,
+		Substance:     "Ibuprofen",
+		Justification: "Mild dyspepsia only; benefit outweighs risk",
+		OverriddenBy:  "doctor1",
+		Timestamp:     "2025-03-14T09:30:00Z",
+	}}, overridden.AllergyOverrides)
+}
+
+func TestAllergyToATCClassMatchesCodedMedication(t *testing.T) {
+	smartContract := chaincode.SmartContract{}
+	state := activePatient(t)
+	recordAllergy(t, state, `{"Substance":"Penicillins","Code":"J01C","Salt":"0123456789abcdef"}`)
+
+	transactionContext, _ := newEndorsement(state, testTxTime, adminIdentity("Org1MSP", "org1admin"))
+	_, err := smartContract.ImportInteractionCatalogue(transactionContext, `{"Medications":[{"Code":"J01CA04","Name":"Amoxicillin"}]}`)
+	require.NoError(t, err)
+
+	transactionContext, _ = newEndorsement(state, testTxTime, doctorIdentity("doctor1"))
+	withPHI(transactionContext, `{"Salt":"0123456789abcdef","Diagnoses":["Otitis media"]}`)
+	_, err = smartContract.CreateAsset(transactionContext, `{"PatientId":"patient1","Prescriptions":[{"Medication":{"Code":"J01CA04"}}]}`)
+	require.EqualError(t, err, "prescription 0 (Amoxicillin) matches the patient's Penicillins allergy ("+testAllergyId+"); an override with a clinical justification is required")
+}
@@ -0,0 +1,182 @@
+package chaincode
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+)
+
+// updatableFields are the prescription fields UpdatePrescription can change. Each role is
+// granted a subset of them through RolePermission.UpdatableFields in the access policy;
+// every other field is immutable. Status is not among them: it changes only through the
+// dispensing, hold, release, revocation and expiry transactions.
+var updatableFields = []string{"MedicationName", "Dosage", "Instructions", "ExpiryDate"}
+
+// isUpdatableField reports whether UpdatePrescription can change the named field.
+func isUpdatableField(name string) bool {
+	for _, field := range updatableFields {
+		if field == name {
+			return true
+		}
+	}
+	return false
+}
+
+// clinicalFields describe what was prescribed and can no longer change once any of the
+// prescription has been dispensed.
+var clinicalFields = map[string]bool{
+	"MedicationName": true,
+	"Dosage":         true,
+	"Instructions":   true,
+}
+
+// PrescriptionUpdate is the patch accepted by UpdatePrescription. Changes maps field names
+// to their new values.
+type PrescriptionUpdate struct {
+	PrescriptionId string            `json:"PrescriptionId"`
+	Changes        map[string]string `json:"Changes"`
+	Reason         string            `json:"Reason"`
+}
+
+// FieldChange records the previous and new value of one amended field.
+type FieldChange struct {
+	Field    string `json:"Field"`
+	Previous string `json:"Previous"`
+	New      string `json:"New"`
+}
+
+// Amendment records one UpdatePrescription transaction on a prescription.
+type Amendment struct {
+	TxID      string        `json:"TxID"`
+	Timestamp string        `json:"Timestamp"`
+	AmendedBy string        `json:"AmendedBy"`
+	Role      string        `json:"Role"`
+	Reason    string        `json:"Reason"`
+	Changes   []FieldChange `json:"Changes"`
+}
+
+// hasBeenDispensed reports whether any of the prescription has been handed out.
+func (prescription *Prescription) hasBeenDispensed() bool {
+	return len(prescription.Dispensations) > 0 ||
+		prescription.DispensingPharmacist != "" ||
+		prescription.Status == StatusPartiallyDispensed ||
+		prescription.Status == StatusDispensed
+}
+
+// field returns the current value of an updatable field.
+func (prescription *Prescription) field(name string) string {
+	switch name {
+	case "MedicationName":
+		return prescription.MedicationName
+	case "Dosage":
+		return prescription.Dosage
+	case "Instructions":
+		return prescription.Instructions
+	case "ExpiryDate":
+		return prescription.ExpiryDate
+	}
+	return ""
+}
+
+// setField validates and sets an updatable field.
+func (prescription *Prescription) setField(name string, value string) error {
+	switch name {
+	case "MedicationName":
+		if value == "" {
+			return fmt.Errorf("medicationName cannot be empty")
+		}
+		if prescription.Medication != nil {
+			return fmt.Errorf("the medication of prescription %s is coded and cannot be changed by name", prescription.PrescriptionId)
+		}
+		prescription.MedicationName = value
+	case "Dosage":
+		if prescription.Dose != nil {
+			return fmt.Errorf("the dose of prescription %s is structured and cannot be changed as text", prescription.PrescriptionId)
+		}
+		prescription.Dosage = value
+	case "Instructions":
+		prescription.Instructions = value
+	case "ExpiryDate":
+		if _, err := time.Parse(dateLayout, value); err != nil {
+			return fmt.Errorf("invalid expiry date '%s': expected YYYY-MM-DD", value)
+		}
+		prescription.ExpiryDate = value
+	default:
+		return fmt.Errorf("field '%s' cannot be updated", name)
+	}
+	return nil
+}
+
+// applyUpdate applies the changes permitted for role to the prescription and returns the
+// changes actually made, in field order so that every endorser records the same amendment.
+func (prescription *Prescription) applyUpdate(update *PrescriptionUpdate, permitted map[string]bool, role string) ([]FieldChange, error) {
+	fields := make([]string, 0, len(update.Changes))
+	for field := range update.Changes {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	changes := []FieldChange{}
+	for _, field := range fields {
+		value := update.Changes[field]
+		if !permitted[field] {
+			return nil, fmt.Errorf("role '%s' may not update field '%s'", role, field)
+		}
+
+		previous := prescription.field(field)
+		if value == previous {
+			continue
+		}
+		if clinicalFields[field] && prescription.hasBeenDispensed() {
+			return nil, fmt.Errorf("field '%s' of prescription %s cannot change after it has been dispensed", field, prescription.PrescriptionId)
+		}
+		if err := prescription.setField(field, value); err != nil {
+			return nil, err
+		}
+		changes = append(changes, FieldChange{Field: field, Previous: previous, New: value})
+	}
+	return changes, nil
+}
+
+// changesMedication reports whether the amendment changes the medication.
+func changesMedication(changes []FieldChange) bool {
+	for _, change := range changes {
+		if change.Field == "MedicationName" {
+			return true
+		}
+	}
+	return false
+}
+
+// screenMedicationChange applies the checks CreateAsset makes to a new medication: the
+// patient's allergies, with overrides submitted as transient data under "phi", and the
+// interaction catalogue against the patient's other current prescriptions. Overrides are
+// recorded in the prescription's private details, stored again with the submitted salt.
+func screenMedicationChange(ctx contractapi.TransactionContextInterface, c *caller, clock *txClock, prescription *Prescription) error {
+	entries, err := readPHIEntries(ctx, 1)
+	if err != nil {
+		return err
+	}
+	var phi phiInput
+	if entries[0] != nil {
+		if phi, err = parsePHIInput(entries[0]); err != nil {
+			return err
+		}
+	}
+
+	overrides, err := checkAllergies(ctx, c, clock, prescription.PatientId, []Prescription{*prescription}, phi.AllergyOverrides)
+	if err != nil {
+		return err
+	}
+	if _, err := screenNewPrescriptions(ctx, prescription.PatientId, []Prescription{*prescription}); err != nil {
+		return err
+	}
+
+	if len(overrides[0]) == 0 {
+		return nil
+	}
+	prescription.AllergyOverrides = append(prescription.AllergyOverrides, overrides[0]...)
+	return putPrescriptionPrivate(ctx, prescription, phi.Salt)
+}
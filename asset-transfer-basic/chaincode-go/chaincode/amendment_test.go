@@ -0,0 +1,209 @@
+package chaincode_test
+
+import (
+	"testing"
+
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpdatePrescriptionRecordsAmendment(t *testing.T) {
+	smartContract := chaincode.SmartContract{}
+	state := activePatient(t)
+
+	transactionContext, _ := newEndorsement(state, testTxTime, doctorIdentity("doctor1"))
+	err := smartContract.UpdatePrescription(transactionContext, "patient1", `{"PrescriptionId":"rx1","Reason":"Dose adjusted for weight","Changes":{"Dosage":"250mg","ExpiryDate":"2025-05-01","MedicationName":"Amoxicillin"}}`)
+	require.NoError(t, err)
+
+	prescription := readPatient(t, state, "patient1").Prescriptions[0]
+	require.Equal(t, "250mg", prescription.Dosage)
+	require.Equal(t, "2025-05-01", prescription.ExpiryDate)
+	require.Equal(t, []chaincode.Amendment{{
+		TxID:      testTxID,
+		Timestamp: "2025-03-14T09:30:00Z",
+		AmendedBy: "doctor1",
+		Role:      "doctor",
+		Reason:    "Dose adjusted for weight",
+		Changes: []chaincode.FieldChange{
+			{Field: "Dosage", Previous: "500mg", New: "250mg"},
+			{Field: "ExpiryDate", Previous: "2025-04-01", New: "2025-05-01"},
+		},
+	}}, prescription.Amendments)
+}
+
+func TestUpdatePrescriptionValidation(t *testing.T) {
+	smartContract := chaincode.SmartContract{}
+
+	tests := []struct {
+		name     string
+		update   string
+		expected string
+	}{
+		{
+			name:     "missing reason",
+			update:   `{"PrescriptionId":"rx1","Changes":{"Dosage":"250mg"}}`,
+			expected: "a reason is required to amend a prescription",
+		},
+		{
+			name:     "no changes",
+			update:   `{"PrescriptionId":"rx1","Reason":"Review"}`,
+			expected: "an update must change at least one field",
+		},
+		{
+			name:     "unchanged values",
+			update:   `{"PrescriptionId":"rx1","Reason":"Review","Changes":{"MedicationName":"Amoxicillin"}}`,
+			expected: "update does not change prescription rx1",
+		},
+		{
+			name:     "immutable field",
+			update:   `{"PrescriptionId":"rx1","Reason":"Review","Changes":{"CreatedBy":"doctor2"}}`,
+			expected: "role 'doctor' may not update field 'CreatedBy'",
+		},
+		{
+			name:     "invalid expiry date",
+			update:   `{"PrescriptionId":"rx1","Reason":"Review","Changes":{"ExpiryDate":"01/05/2025"}}`,
+			expected: "invalid expiry date '01/05/2025': expected YYYY-MM-DD",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transactionContext, chaincodeStub := newEndorsement(activePatient(t), testTxTime, doctorIdentity("doctor1"))
+			err := smartContract.UpdatePrescription(transactionContext, "patient1", tt.update)
+			require.EqualError(t, err, tt.expected)
+			require.Equal(t, 0, chaincodeStub.PutStateCallCount())
+		})
+	}
+}
+
+func TestUpdatePrescriptionCannotChangeStatus(t *testing.T) {
+	smartContract := chaincode.SmartContract{}
+
+	for _, status := range []string{"Dispensed", "PartiallyDispensed", "OnHold", "Expired", "Revoked"} {
+		t.Run(status, func(t *testing.T) {
+			transactionContext, chaincodeStub := newEndorsement(activePatient(t), testTxTime, doctorIdentity("doctor1"))
+			err := smartContract.UpdatePrescription(transactionContext, "patient1", `{"PrescriptionId":"rx1","Reason":"Handed out","Changes":{"Status":"`+status+`"}}`)
+			require.EqualError(t, err, "role 'doctor' may not update field 'Status'")
+			require.Equal(t, 0, chaincodeStub.PutStateCallCount())
+		})
+	}
+
+	// A policy cannot grant Status to a role either.
+	transactionContext, _ := newEndorsement(activePatient(t), testTxTime, adminIdentity("Org1MSP", "org1admin"))
+	err := smartContract.SetRoleUpdatableFields(transactionContext, "doctor", `["Dosage","Status"]`)
+	require.EqualError(t, err, "unknown updatable field 'Status' for role 'doctor'")
+}
+
+func TestUpdatableFieldsArePerRole(t *testing.T) {
+	smartContract := chaincode.SmartContract{}
+	state := activePatient(t)
+
+	transactionContext, _ := newEndorsement(state, testTxTime, adminIdentity("Org1MSP", "org1admin"))
+	require.NoError(t, smartContract.SetRoleUpdatableFields(transactionContext, "doctor", `["ExpiryDate"]`))
+
+	transactionContext, _ = newEndorsement(state, testTxTime, doctorIdentity("doctor1"))
+	err := smartContract.UpdatePrescription(transactionContext, "patient1", `{"PrescriptionId":"rx1","Reason":"Dose adjusted for weight","Changes":{"Dosage":"250mg"}}`)
+	require.EqualError(t, err, "role 'doctor' may not update field 'Dosage'")
+
+	transactionContext, _ = newEndorsement(state, testTxTime, doctorIdentity("doctor1"))
+	err = smartContract.UpdatePrescription(transactionContext, "patient1", `{"PrescriptionId":"rx1","Reason":"Course extended","Changes":{"ExpiryDate":"2025-05-01"}}`)
+	require.NoError(t, err)
+
+	// Replacing the role's functions keeps its updatable fields.
+	transactionContext, _ = newEndorsement(state, testTxTime, adminIdentity("Org1MSP", "org1admin"))
+	require.NoError(t, smartContract.SetRolePermissions(transactionContext, "doctor", `["ReadAsset","UpdatePrescription"]`))
+	transactionContext, _ = newEndorsement(state, testTxTime, adminIdentity("Org1MSP", "org1admin"))
+	policy, err := smartContract.GetAccessPolicy(transactionContext)
+	require.NoError(t, err)
+	for _, permission := range policy.Permissions {
+		if permission.Role == "doctor" {
+			require.Equal(t, []string{"ExpiryDate"}, permission.UpdatableFields)
+		}
+	}
+
+	transactionContext, _ = newEndorsement(state, testTxTime, adminIdentity("Org1MSP", "org1admin"))
+	err = smartContract.SetRoleUpdatableFields(transactionContext, "nurse", `["Dosage"]`)
+	require.EqualError(t, err, "role 'nurse' has no permissions")
+}
+
+func TestClinicalFactsAreFixedAfterDispensing(t *testing.T) {
+	smartContract := chaincode.SmartContract{}
+
+	transactionContext, chaincodeStub := newEndorsement(patientWithStatus(t, chaincode.StatusPartiallyDispensed), testTxTime, doctorIdentity("doctor1"))
+	err := smartContract.UpdatePrescription(transactionContext, "patient1", `{"PrescriptionId":"rx1","Reason":"Dose adjusted for weight","Changes":{"Dosage":"250mg"}}`)
+	require.EqualError(t, err, "field 'Dosage' of prescription rx1 cannot change after it has been dispensed")
+	require.Equal(t, 0, chaincodeStub.PutStateCallCount())
+
+	// Administrative fields may still change.
+	state := patientWithStatus(t, chaincode.StatusPartiallyDispensed)
+	transactionContext, _ = newEndorsement(state, testTxTime, doctorIdentity("doctor1"))
+	err = smartContract.UpdatePrescription(transactionContext, "patient1", `{"PrescriptionId":"rx1","Reason":"Course extended","Changes":{"ExpiryDate":"2025-05-01"}}`)
+	require.NoError(t, err)
+	require.Equal(t, "2025-05-01", readPatient(t, state, "patient1").Prescriptions[0].ExpiryDate)
+}
+
+func TestUpdatePrescriptionChecksNewMedicationAgainstAllergies(t *testing.T) {
+	smartContract := chaincode.SmartContract{}
+	state := activePatient(t)
+	allergyId := recordAllergy(t, state, `{"Substance":"Penicillin","Salt":"0123456789abcdef"}`)
+	update := `{"PrescriptionId":"rx1","Reason":"Switched antibiotic","Changes":{"MedicationName":"penicillin"}}`
+
+	transactionContext, chaincodeStub := newEndorsement(state, testTxTime, doctorIdentity("doctor1"))
+	err := smartContract.UpdatePrescription(transactionContext, "patient1", update)
+	require.EqualError(t, err, "prescription 0 (penicillin) matches the patient's Penicillin allergy ("+allergyId+"); an override with a clinical justification is required")
+	require.Zero(t, chaincodeStub.PutStateCallCount())
+
+	transactionContext, _ = newEndorsement(state, testTxTime, doctorIdentity("doctor1"))
+	withPHI(transactionContext, `{"Salt":"0123456789abcdef","AllergyOverrides":[{"Prescription":0,"AllergyId":"`+allergyId+`","Justification":"Rash in childhood only; tolerated since"}]}`)
+	require.NoError(t, smartContract.UpdatePrescription(transactionContext, "patient1", update))
+
+	transactionContext, _ = newEndorsement(state, testTxTime, doctorIdentity("doctor1"))
+	asset, err := smartContract.ReadAsset(transactionContext, "patient1")
+	require.NoError(t, err)
+	require.Equal(t, "penicillin", asset.Prescriptions[0].MedicationName)
+	require.Equal(t, "Otitis media", asset.Prescriptions[0].Diagnosis)
+	require.Equal(t, []chaincode.AllergyOverride{{
+		AllergyId:     allergyId,
+		Substance:     "Penicillin",
+		Justification: "Rash in childhood only; tolerated since",
+		OverriddenBy:  "doctor1",
+		Timestamp:     "2025-03-14T09:30:00Z",
+	}}, asset.Prescriptions[0].AllergyOverrides)
+}
+
+func TestUpdatePrescriptionChecksNewMedicationForInteractions(t *testing.T) {
+	smartContract := chaincode.SmartContract{}
+	asset := activePatientAsset()
+	paracetamol := asset.Prescriptions[0]
+	paracetamol.PrescriptionId = "rx2"
+	paracetamol.MedicationName = "Paracetamol"
+	asset.Prescriptions = append(asset.Prescriptions, paracetamol)
+	state := patientState(t, asset)
+	withCatalogue(t, state)
+	transactionContext, _ := newEndorsement(state, testTxTime, adminIdentity("Org1MSP", "org1admin"))
+	require.NoError(t, smartContract.SetInteractionSettings(transactionContext, `{"Enforce":true}`))
+
+	transactionContext, chaincodeStub := newEndorsement(state, testTxTime, doctorIdentity("doctor1"))
+	err := smartContract.UpdatePrescription(transactionContext, "patient1", `{"PrescriptionId":"rx2","Reason":"Arthritis flare","Changes":{"MedicationName":"Methotrexate"}}`)
+	require.EqualError(t, err, "Methotrexate is contraindicated with Amoxicillin: Reduced methotrexate clearance")
+	require.Zero(t, chaincodeStub.PutStateCallCount())
+
+	// A prescription is not screened against its own previous medication.
+	transactionContext, _ = newEndorsement(state, testTxTime, doctorIdentity("doctor1"))
+	require.NoError(t, smartContract.UpdatePrescription(transactionContext, "patient1", `{"PrescriptionId":"rx1","Reason":"Arthritis flare","Changes":{"MedicationName":"Methotrexate"}}`))
+}
+
+func TestCreateAssetDiscardsSuppliedAmendments(t *testing.T) {
+	smartContract := chaincode.SmartContract{}
+	state := ledger{}
+
+	transactionContext, _ := newEndorsement(state, testTxTime, doctorIdentity("doctor1"))
+	withPHI(transactionContext, `{"Salt":"0123456789abcdef","Diagnoses":["Otitis media"]}`)
+	_, err := smartContract.CreateAsset(transactionContext, `{"PatientId":"patient1","Prescriptions":[{"MedicationName":"Amoxicillin","Amendments":[{"TxID":"fake","AmendedBy":"doctor2","Reason":"forged"}]}]}`)
+	require.NoError(t, err)
+
+	transactionContext, _ = newEndorsement(state, testTxTime, doctorIdentity("doctor1"))
+	asset, err := smartContract.ReadAsset(transactionContext, "patient1")
+	require.NoError(t, err)
+	require.Empty(t, asset.Prescriptions[0].Amendments)
+}
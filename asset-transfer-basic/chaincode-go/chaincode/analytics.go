@@ -0,0 +1,255 @@
+package chaincode
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/hyperledger/fabric-chaincode-go/v2/shim"
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+)
+
+// PrescriptionAnalytics summarises the prescriptions created within a date range.
+type PrescriptionAnalytics struct {
+	StartDate           string         `json:"startDate,omitempty"`
+	EndDate             string         `json:"endDate,omitempty"`
+	TotalPrescriptions  int            `json:"totalPrescriptions"`
+	ActiveCount         int            `json:"activeCount"`
+	DispensedCount      int            `json:"dispensedCount"`
+	ExpiryCount         int            `json:"expiryCount"`
+	StatusCounts        map[string]int `json:"statusCounts"`
+	MedicationFrequency map[string]int `json:"medicationFrequency"`
+	DiagnosisFrequency  map[string]int `json:"diagnosisFrequency"`
+	ByDoctor            map[string]int `json:"byDoctor"`
+	ByPharmacist        map[string]int `json:"byPharmacist"`
+	// AverageDispenseTime is the mean dispense latency in seconds, as in DispenseLatency.
+	AverageDispenseTime float64        `json:"averageDispenseTime"`
+	DispenseLatency     LatencySummary `json:"dispenseLatency"`
+}
+
+// LatencySummary describes the time, in seconds, from a prescription being written to its
+// first dispensation.
+type LatencySummary struct {
+	Count         int     `json:"count"`
+	MeanSeconds   float64 `json:"meanSeconds"`
+	MedianSeconds float64 `json:"medianSeconds"`
+	P90Seconds    float64 `json:"p90Seconds"`
+}
+
+// dateRange is an inclusive range of calendar days. A zero bound is open.
+type dateRange struct {
+	start time.Time
+	end   time.Time
+}
+
+// parseDateRange parses optional YYYY-MM-DD bounds.
+func parseDateRange(startDate string, endDate string) (*dateRange, error) {
+	r := &dateRange{}
+	var err error
+	if startDate != "" {
+		if r.start, err = time.Parse(dateLayout, startDate); err != nil {
+			return nil, fmt.Errorf("invalid start date '%s': expected YYYY-MM-DD", startDate)
+		}
+	}
+	if endDate != "" {
+		if r.end, err = time.Parse(dateLayout, endDate); err != nil {
+			return nil, fmt.Errorf("invalid end date '%s': expected YYYY-MM-DD", endDate)
+		}
+		// Include the whole end day.
+		r.end = r.end.AddDate(0, 0, 1)
+	}
+	if !r.start.IsZero() && !r.end.IsZero() && !r.start.Before(r.end) {
+		return nil, fmt.Errorf("start date %s is after end date %s", startDate, endDate)
+	}
+	return r, nil
+}
+
+func (r *dateRange) contains(t time.Time) bool {
+	return (r.start.IsZero() || !t.Before(r.start)) && (r.end.IsZero() || t.Before(r.end))
+}
+
+// createdAt returns when the prescription was written. Prescriptions written before CreatedAt
+// was recorded fall back to Timestamp, the time of their last change.
+func (prescription *Prescription) createdAt() (time.Time, error) {
+	return time.Parse(time.RFC3339, firstNonEmpty(prescription.CreatedAt, prescription.Timestamp))
+}
+
+// firstDispensedAt returns when the prescription was first dispensed, if it has been.
+func (prescription *Prescription) firstDispensedAt() (time.Time, bool) {
+	value := prescription.DispensingTimestamp
+	if len(prescription.Dispensations) > 0 {
+		value = prescription.Dispensations[0].Timestamp
+	}
+	if value == "" {
+		return time.Time{}, false
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	return t, err == nil
+}
+
+// dispenseLatency returns the time from creation to first dispensation. It is unknown for
+// prescriptions without CreatedAt, whose Timestamp was overwritten when they were dispensed.
+func (prescription *Prescription) dispenseLatency(created time.Time) (time.Duration, bool) {
+	dispensed, ok := prescription.firstDispensedAt()
+	if !ok || prescription.CreatedAt == "" && !created.Before(dispensed) {
+		return 0, false
+	}
+	return dispensed.Sub(created), true
+}
+
+// summarizeLatencies computes the mean, median and 90th percentile of the latencies. The
+// percentile uses the nearest-rank method.
+func summarizeLatencies(latencies []time.Duration) LatencySummary {
+	summary := LatencySummary{Count: len(latencies)}
+	if len(latencies) == 0 {
+		return summary
+	}
+
+	seconds := make([]float64, len(latencies))
+	total := 0.0
+	for i, latency := range latencies {
+		seconds[i] = latency.Seconds()
+		total += seconds[i]
+	}
+	sort.Float64s(seconds)
+
+	n := len(seconds)
+	summary.MeanSeconds = total / float64(n)
+	if n%2 == 1 {
+		summary.MedianSeconds = seconds[n/2]
+	} else {
+		summary.MedianSeconds = (seconds[n/2-1] + seconds[n/2]) / 2
+	}
+	summary.P90Seconds = seconds[int(math.Ceil(0.9*float64(n)))-1]
+	return summary
+}
+
+// analyticsAccumulator builds PrescriptionAnalytics from prescription records.
+type analyticsAccumulator struct {
+	analytics *PrescriptionAnalytics
+	dates     *dateRange
+	latencies []time.Duration
+}
+
+func newAnalyticsAccumulator(startDate string, endDate string) (*analyticsAccumulator, error) {
+	dates, err := parseDateRange(startDate, endDate)
+	if err != nil {
+		return nil, err
+	}
+
+	return &analyticsAccumulator{
+		dates: dates,
+		analytics: &PrescriptionAnalytics{
+			StartDate:           startDate,
+			EndDate:             endDate,
+			StatusCounts:        map[string]int{},
+			MedicationFrequency: map[string]int{},
+			DiagnosisFrequency:  map[string]int{},
+			ByDoctor:            map[string]int{},
+			ByPharmacist:        map[string]int{},
+		},
+	}, nil
+}
+
+// addPrescriptions adds the prescriptions returned by a query of the prescription keys.
+// Prescriptions without CreatedBy are counted for their patient's doctor.
+func (a *analyticsAccumulator) addPrescriptions(ctx contractapi.TransactionContextInterface, iterator shim.StateQueryIteratorInterface) error {
+	prescriptions, err := readPrescriptions(ctx, iterator, func(prescription *Prescription) bool {
+		created, err := prescription.createdAt()
+		return err == nil && a.dates.contains(created)
+	})
+	if err != nil {
+		return err
+	}
+
+	doctors := map[string]string{}
+	for _, prescription := range prescriptions {
+		doctorId := prescription.CreatedBy
+		if doctorId == "" {
+			var ok bool
+			if doctorId, ok = doctors[prescription.PatientId]; !ok {
+				patient, err := readPatient(ctx, prescription.PatientId)
+				if err != nil {
+					return err
+				}
+				doctorId = patient.DoctorId
+				doctors[prescription.PatientId] = doctorId
+			}
+		}
+		a.add(doctorId, prescription)
+	}
+	return nil
+}
+
+// add counts the prescription, written by doctorId, if it was created within the date range.
+func (a *analyticsAccumulator) add(doctorId string, prescription *Prescription) {
+	created, err := prescription.createdAt()
+	if err != nil || !a.dates.contains(created) {
+		return
+	}
+
+	analytics := a.analytics
+	analytics.TotalPrescriptions++
+	analytics.StatusCounts[string(prescription.Status)]++
+	analytics.MedicationFrequency[prescription.medicationLabel()]++
+	analytics.DiagnosisFrequency[prescription.Diagnosis]++
+	analytics.ByDoctor[doctorId]++
+
+	switch prescription.Status {
+	case StatusActive:
+		analytics.ActiveCount++
+	case StatusDispensed:
+		analytics.DispensedCount++
+	case StatusExpired:
+		analytics.ExpiryCount++
+	}
+
+	if len(prescription.Dispensations) > 0 {
+		for _, dispensation := range prescription.Dispensations {
+			analytics.ByPharmacist[dispensation.PharmacistId]++
+		}
+	} else if prescription.DispensingPharmacist != "" {
+		analytics.ByPharmacist[prescription.DispensingPharmacist]++
+	}
+
+	if latency, ok := prescription.dispenseLatency(created); ok {
+		a.latencies = append(a.latencies, latency)
+	}
+}
+
+// result returns the analytics with the latency statistics filled in.
+func (a *analyticsAccumulator) result() *PrescriptionAnalytics {
+	a.analytics.DispenseLatency = summarizeLatencies(a.latencies)
+	a.analytics.AverageDispenseTime = a.analytics.DispenseLatency.MeanSeconds
+	return a.analytics
+}
+
+// GetPrescriptionAnalytics - get analytics for prescriptions created between startDate and
+// endDate inclusive, given as YYYY-MM-DD. Either bound may be empty to leave the range open.
+// Counts are broken down by status, medication, diagnosis and prescribing doctor; dispensations
+// are counted by pharmacist. Dispense latency is measured from creation to first dispensation.
+// This reads every prescription key, and the private details of those within the range;
+// GetPrescriptionAnalyticsWithPagination reads one page of them. Legacy prescriptions
+// stored inline in the patient record are not counted until MigrateAssets has run.
+func (s *SmartContract) GetPrescriptionAnalytics(ctx contractapi.TransactionContextInterface, startDate string, endDate string) (*PrescriptionAnalytics, error) {
+	if _, err := s.authorize(ctx, "GetPrescriptionAnalytics"); err != nil {
+		return nil, err
+	}
+
+	accumulator, err := newAnalyticsAccumulator(startDate, endDate)
+	if err != nil {
+		return nil, err
+	}
+
+	iterator, err := ctx.GetStub().GetStateByPartialCompositeKey(prescriptionObjectType, []string{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan prescriptions: %v", err)
+	}
+	defer iterator.Close()
+
+	if err := accumulator.addPrescriptions(ctx, iterator); err != nil {
+		return nil, err
+	}
+	return accumulator.result(), nil
+}
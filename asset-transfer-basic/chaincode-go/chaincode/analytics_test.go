@@ -0,0 +1,100 @@
+package chaincode_test
+
+import (
+	"testing"
+
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode"
+	"github.com/stretchr/testify/require"
+)
+
+// analyticsState returns two patients with prescriptions created in March and April 2025.
+func analyticsState(t *testing.T) ledger {
+	dispensation := func(pharmacist string, timestamp string) chaincode.Dispensation {
+		return chaincode.Dispensation{Fill: 1, Quantity: 10, PharmacistId: pharmacist, PharmacyId: "Org2MSP", Timestamp: timestamp}
+	}
+
+	state := patientState(t, chaincode.Asset{
+		PatientId: "patient1",
+		DoctorId:  "doctor1",
+		Prescriptions: []chaincode.Prescription{
+			{PrescriptionId: "rx1", MedicationName: "Amoxicillin", Diagnosis: "Otitis media", Status: chaincode.StatusDispensed, CreatedBy: "doctor1",
+				CreatedAt: "2025-03-01T08:00:00Z", Timestamp: "2025-03-01T09:00:00Z", Quantity: 10,
+				Dispensations: []chaincode.Dispensation{dispensation("pharmacist1", "2025-03-01T09:00:00Z")}},
+			{PrescriptionId: "rx2", MedicationName: "Metformin", Diagnosis: "Diabetes", Status: chaincode.StatusPartiallyDispensed, CreatedBy: "doctor1",
+				CreatedAt: "2025-03-10T08:00:00Z", Timestamp: "2025-04-10T08:00:00Z", Quantity: 10, Refills: 2,
+				Dispensations: []chaincode.Dispensation{dispensation("pharmacist2", "2025-03-10T11:00:00Z"), dispensation("pharmacist1", "2025-04-10T08:00:00Z")}},
+			{PrescriptionId: "rx3", MedicationName: "Amoxicillin", Diagnosis: "Tonsillitis", Status: chaincode.StatusActive, CreatedBy: "doctor2",
+				CreatedAt: "2025-04-02T08:00:00Z", Timestamp: "2025-04-02T08:00:00Z"},
+		},
+	})
+	// A record written before CreatedAt was recorded; its Timestamp is the dispense time.
+	for key, value := range patientState(t, chaincode.Asset{
+		PatientId: "patient2",
+		DoctorId:  "doctor2",
+		Prescriptions: []chaincode.Prescription{
+			{PrescriptionId: "rx4", MedicationName: "Salbutamol", Diagnosis: "Asthma", Status: chaincode.StatusDispensed, CreatedBy: "doctor2",
+				Timestamp: "2025-03-20T10:00:00Z", DispensingPharmacist: "pharmacist2", DispensingTimestamp: "2025-03-20T10:00:00Z"},
+		},
+	}) {
+		state[key] = value
+	}
+	return state
+}
+
+func TestPrescriptionAnalytics(t *testing.T) {
+	smartContract := chaincode.SmartContract{}
+
+	transactionContext, _ := newEndorsement(analyticsState(t), testTxTime, doctorIdentity("doctor1"))
+	analytics, err := smartContract.GetPrescriptionAnalytics(transactionContext, "", "")
+	require.NoError(t, err)
+	require.Equal(t, 4, analytics.TotalPrescriptions)
+	require.Equal(t, 1, analytics.ActiveCount)
+	require.Equal(t, 2, analytics.DispensedCount)
+	require.Equal(t, map[string]int{"Active": 1, "Dispensed": 2, "PartiallyDispensed": 1}, analytics.StatusCounts)
+	require.Equal(t, map[string]int{"Amoxicillin": 2, "Metformin": 1, "Salbutamol": 1}, analytics.MedicationFrequency)
+	require.Equal(t, map[string]int{"doctor1": 2, "doctor2": 2}, analytics.ByDoctor)
+	require.Equal(t, map[string]int{"pharmacist1": 2, "pharmacist2": 2}, analytics.ByPharmacist)
+
+	// Latencies of one and three hours; the legacy record has no known creation time.
+	require.Equal(t, chaincode.LatencySummary{Count: 2, MeanSeconds: 7200, MedianSeconds: 7200, P90Seconds: 10800}, analytics.DispenseLatency)
+	require.Equal(t, 7200.0, analytics.AverageDispenseTime)
+}
+
+func TestPrescriptionAnalyticsReadsOnlyPrescriptionKeys(t *testing.T) {
+	smartContract := chaincode.SmartContract{}
+	state := analyticsState(t)
+	withCatalogue(t, state)
+	state["settings"] = []byte(`{"PatientId":"settings","Prescriptions":[{"PrescriptionId":"rx9","MedicationName":"Bogus","CreatedAt":"2025-03-05T08:00:00Z"}]}`)
+	state["not-json"] = []byte("plain value")
+
+	transactionContext, chaincodeStub := newEndorsement(state, testTxTime, doctorIdentity("doctor1"))
+	analytics, err := smartContract.GetPrescriptionAnalytics(transactionContext, "", "")
+	require.NoError(t, err)
+	require.Equal(t, 4, analytics.TotalPrescriptions)
+	require.Equal(t, map[string]int{"Amoxicillin": 2, "Metformin": 1, "Salbutamol": 1}, analytics.MedicationFrequency)
+	require.Zero(t, chaincodeStub.GetStateByRangeCallCount())
+}
+
+func TestPrescriptionAnalyticsHonoursDateRange(t *testing.T) {
+	smartContract := chaincode.SmartContract{}
+
+	transactionContext, _ := newEndorsement(analyticsState(t), testTxTime, doctorIdentity("doctor1"))
+	analytics, err := smartContract.GetPrescriptionAnalytics(transactionContext, "2025-03-01", "2025-03-10")
+	require.NoError(t, err)
+	require.Equal(t, 2, analytics.TotalPrescriptions)
+	require.Equal(t, map[string]int{"Amoxicillin": 1, "Metformin": 1}, analytics.MedicationFrequency)
+
+	transactionContext, _ = newEndorsement(analyticsState(t), testTxTime, doctorIdentity("doctor1"))
+	analytics, err = smartContract.GetPrescriptionAnalytics(transactionContext, "2025-04-01", "")
+	require.NoError(t, err)
+	require.Equal(t, 1, analytics.TotalPrescriptions)
+	require.Equal(t, chaincode.LatencySummary{}, analytics.DispenseLatency)
+
+	transactionContext, _ = newEndorsement(analyticsState(t), testTxTime, doctorIdentity("doctor1"))
+	_, err = smartContract.GetPrescriptionAnalytics(transactionContext, "2025-04-01", "2025-03-01")
+	require.EqualError(t, err, "start date 2025-04-01 is after end date 2025-03-01")
+
+	transactionContext, _ = newEndorsement(analyticsState(t), testTxTime, doctorIdentity("doctor1"))
+	_, err = smartContract.GetPrescriptionAnalytics(transactionContext, "March", "")
+	require.EqualError(t, err, "invalid start date 'March': expected YYYY-MM-DD")
+}
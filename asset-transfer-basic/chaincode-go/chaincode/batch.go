@@ -0,0 +1,418 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hyperledger/fabric-chaincode-go/v2/shim"
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+	"github.com/hyperledger/fabric-protos-go-apiv2/ledger/queryresult"
+)
+
+// Fabric does not return a transaction's own writes to its later reads, so a batch that
+// created two assets for the same patient directly on the stub would not see the first when
+// creating the second. BatchCreatePrescriptions therefore runs every item against a
+// writeCache, which keeps the writes in memory per key and serves them back to reads. Each
+// item gets its own layer, merged into the batch only if the item succeeds, and the batch is
+// written to the ledger only once every item has succeeded.
+const (
+	batchSettingsName = "batch"
+
+	// defaultMaxBatchSize is the number of prescriptions one batch may create until an
+	// administrator stores batch settings.
+	defaultMaxBatchSize = 100
+
+	// maxBatchSizeLimit bounds MaxBatchSize, and with it the write set of one transaction.
+	maxBatchSizeLimit = 1000
+)
+
+// BatchSettings configures BatchCreatePrescriptions. MaxBatchSize is the largest number of
+// prescriptions, across all assets, that one batch may create.
+type BatchSettings struct {
+	MaxBatchSize int    `json:"MaxBatchSize"`
+	UpdatedBy    string `json:"UpdatedBy,omitempty"`
+	UpdatedAt    string `json:"UpdatedAt,omitempty"`
+}
+
+// BatchItemResult reports the outcome of one asset of a batch, identified by its index in the
+// submitted array. Error is set when the item failed validation.
+type BatchItemResult struct {
+	Index               int                  `json:"Index"`
+	PatientId           string               `json:"PatientId"`
+	PrescriptionIds     []string             `json:"PrescriptionIds,omitempty"`
+	InteractionWarnings []InteractionFinding `json:"InteractionWarnings,omitempty"`
+	Error               string               `json:"Error,omitempty"`
+}
+
+// BatchCreateReport is returned by BatchCreatePrescriptions with one result per asset, in the
+// order they were submitted.
+type BatchCreateReport struct {
+	Created int               `json:"Created"`
+	Items   []BatchItemResult `json:"Items"`
+}
+
+// BatchError reports a batch that was rejected because at least one item failed. Nothing in
+// the batch is written. Like TransitionError, its message is a JSON object, carrying the
+// result of every item so that clients can fix all failures at once.
+type BatchError struct {
+	Failed int               `json:"Failed"`
+	Items  []BatchItemResult `json:"Items"`
+}
+
+func (e *BatchError) Error() string {
+	detail, _ := json.Marshal(struct {
+		Code string `json:"Code"`
+		*BatchError
+	}{"BatchRejected", e})
+	return string(detail)
+}
+
+// BatchCreatePrescriptions - create multiple prescriptions in a single transaction
+// The batch is all or nothing: every asset is validated and created in memory first, and if
+// any fails the transaction returns a BatchError with the result of each asset and writes
+// nothing. Several assets may name the same patient; later ones see the patient and
+// prescriptions created by earlier ones. The private fields are submitted as transient data
+// under "phi", one entry per asset; a missing or invalid entry fails only its asset. A batch may create at most MaxBatchSize prescriptions.
+func (s *SmartContract) BatchCreatePrescriptions(ctx contractapi.TransactionContextInterface, assetsJSON string) (*BatchCreateReport, error) {
+	doctor, err := s.authorize(ctx, "BatchCreatePrescriptions")
+	if err != nil {
+		return nil, err
+	}
+
+	var assets []Asset
+	err = json.Unmarshal([]byte(assetsJSON), &assets)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse assets JSON: %v", err)
+	}
+
+	settings, err := readBatchSettings(ctx)
+	if err != nil {
+		return nil, err
+	}
+	size := 0
+	for _, asset := range assets {
+		size += len(asset.Prescriptions)
+	}
+	if size > settings.MaxBatchSize {
+		return nil, fmt.Errorf("batch of %d prescriptions exceeds the maximum batch size of %d", size, settings.MaxBatchSize)
+	}
+
+	phi, err := readPHIEntries(ctx, len(assets))
+	if err != nil {
+		return nil, err
+	}
+
+	batch := newWriteCache(ctx.GetStub())
+	batchCtx := &cachedContext{TransactionContextInterface: ctx, cache: batch}
+	report := &BatchCreateReport{Items: []BatchItemResult{}}
+	results := []*CreateAssetResult{}
+	failed := 0
+	position := 0
+	for i, asset := range assets {
+		item := BatchItemResult{Index: i, PatientId: asset.PatientId}
+		result, err := s.createBatchItem(batchCtx, doctor, asset, phi[i], position)
+		if err != nil {
+			item.Error = err.Error()
+			failed++
+		} else {
+			item.PrescriptionIds = result.PrescriptionIds
+			item.InteractionWarnings = result.InteractionWarnings
+			report.Created += len(result.PrescriptionIds)
+			results = append(results, result)
+		}
+		report.Items = append(report.Items, item)
+		position += len(asset.Prescriptions)
+	}
+	if failed > 0 {
+		return nil, &BatchError{Failed: failed, Items: report.Items}
+	}
+
+	if err := batch.flush(); err != nil {
+		return nil, err
+	}
+
+	clock, err := newTxClock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := emitPrescriptionEvent(ctx, eventPrescriptionCreated, doctor, clock, createdEntries(results...)); err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
+
+// createBatchItem creates one asset of a batch in its own cache layer, and merges the layer
+// into the batch only if the asset is created without error.
+func (s *SmartContract) createBatchItem(batchCtx *cachedContext, doctor *caller, asset Asset, phiEntry json.RawMessage, position int) (*CreateAssetResult, error) {
+	if err := rejectPublicPHI(&asset); err != nil {
+		return nil, err
+	}
+	phi, err := parsePHIInput(phiEntry)
+	if err != nil {
+		return nil, err
+	}
+
+	item := newWriteCache(batchCtx.GetStub())
+	result, err := s.createAsset(&cachedContext{TransactionContextInterface: batchCtx, cache: item}, doctor, asset, phi, position)
+	if err != nil {
+		return nil, err
+	}
+	if err := item.flush(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// SetBatchSettings - stores the batch settings, such as the maximum batch size.
+func (s *SmartContract) SetBatchSettings(ctx contractapi.TransactionContextInterface, settingsJSON string) error {
+	admin, err := s.authorize(ctx, "SetBatchSettings")
+	if err != nil {
+		return err
+	}
+
+	var settings BatchSettings
+	if err := json.Unmarshal([]byte(settingsJSON), &settings); err != nil {
+		return fmt.Errorf("failed to parse batch settings JSON: %v", err)
+	}
+	if settings.MaxBatchSize < 1 || settings.MaxBatchSize > maxBatchSizeLimit {
+		return fmt.Errorf("maxBatchSize must be between 1 and %d", maxBatchSizeLimit)
+	}
+
+	clock, err := newTxClock(ctx)
+	if err != nil {
+		return err
+	}
+	settings.UpdatedBy = admin.EnrollmentID
+	settings.UpdatedAt = clock.Timestamp()
+
+	key, err := ctx.GetStub().CreateCompositeKey(settingsObjectType, []string{batchSettingsName})
+	if err != nil {
+		return fmt.Errorf("failed to create settings key: %v", err)
+	}
+	settingsJSONBytes, err := json.Marshal(settings)
+	if err != nil {
+		return err
+	}
+	return ctx.GetStub().PutState(key, settingsJSONBytes)
+}
+
+// GetBatchSettings - returns the batch settings.
+func (s *SmartContract) GetBatchSettings(ctx contractapi.TransactionContextInterface) (*BatchSettings, error) {
+	if _, err := s.authorize(ctx, "GetBatchSettings"); err != nil {
+		return nil, err
+	}
+	return readBatchSettings(ctx)
+}
+
+// readBatchSettings returns the stored settings, or the defaults.
+func readBatchSettings(ctx contractapi.TransactionContextInterface) (*BatchSettings, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(settingsObjectType, []string{batchSettingsName})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create settings key: %v", err)
+	}
+	settingsJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read batch settings: %v", err)
+	}
+
+	settings := &BatchSettings{MaxBatchSize: defaultMaxBatchSize}
+	if settingsJSON == nil {
+		return settings, nil
+	}
+	if err := json.Unmarshal(settingsJSON, settings); err != nil {
+		return nil, fmt.Errorf("failed to parse stored batch settings: %v", err)
+	}
+	return settings, nil
+}
+
+// cachedContext is a transaction context whose stub is a writeCache.
+type cachedContext struct {
+	contractapi.TransactionContextInterface
+	cache *writeCache
+}
+
+func (c *cachedContext) GetStub() shim.ChaincodeStubInterface {
+	return c.cache
+}
+
+// cachedWrite is a pending write to one key; deleted marks a pending delete.
+type cachedWrite struct {
+	value   []byte
+	deleted bool
+}
+
+// writeCache is a stub that holds writes to the world state and private data in memory until
+// they are flushed to the stub it wraps. Point reads and partial composite key queries see
+// the pending writes; other queries go to the wrapped stub and do not.
+type writeCache struct {
+	shim.ChaincodeStubInterface
+	state   map[string]cachedWrite
+	private map[string]map[string]cachedWrite
+}
+
+func newWriteCache(stub shim.ChaincodeStubInterface) *writeCache {
+	return &writeCache{
+		ChaincodeStubInterface: stub,
+		state:                  map[string]cachedWrite{},
+		private:                map[string]map[string]cachedWrite{},
+	}
+}
+
+func (c *writeCache) GetState(key string) ([]byte, error) {
+	if write, ok := c.state[key]; ok {
+		if write.deleted {
+			return nil, nil
+		}
+		return write.value, nil
+	}
+	return c.ChaincodeStubInterface.GetState(key)
+}
+
+func (c *writeCache) PutState(key string, value []byte) error {
+	if key == "" {
+		return fmt.Errorf("key must not be an empty string")
+	}
+	c.state[key] = cachedWrite{value: append([]byte(nil), value...)}
+	return nil
+}
+
+func (c *writeCache) DelState(key string) error {
+	c.state[key] = cachedWrite{deleted: true}
+	return nil
+}
+
+func (c *writeCache) GetPrivateData(collection string, key string) ([]byte, error) {
+	if write, ok := c.private[collection][key]; ok {
+		if write.deleted {
+			return nil, nil
+		}
+		return write.value, nil
+	}
+	return c.ChaincodeStubInterface.GetPrivateData(collection, key)
+}
+
+func (c *writeCache) PutPrivateData(collection string, key string, value []byte) error {
+	if key == "" {
+		return fmt.Errorf("key must not be an empty string")
+	}
+	if c.private[collection] == nil {
+		c.private[collection] = map[string]cachedWrite{}
+	}
+	c.private[collection][key] = cachedWrite{value: append([]byte(nil), value...)}
+	return nil
+}
+
+func (c *writeCache) DelPrivateData(collection string, key string) error {
+	if c.private[collection] == nil {
+		c.private[collection] = map[string]cachedWrite{}
+	}
+	c.private[collection][key] = cachedWrite{deleted: true}
+	return nil
+}
+
+// GetStateByPartialCompositeKey merges the pending writes under the partial key into the
+// wrapped stub's results, in key order.
+func (c *writeCache) GetStateByPartialCompositeKey(objectType string, keys []string) (shim.StateQueryIteratorInterface, error) {
+	prefix, err := c.CreateCompositeKey(objectType, keys)
+	if err != nil {
+		return nil, err
+	}
+	iterator, err := c.ChaincodeStubInterface.GetStateByPartialCompositeKey(objectType, keys)
+	if err != nil {
+		return nil, err
+	}
+	defer iterator.Close()
+
+	values := map[string][]byte{}
+	for iterator.HasNext() {
+		queryResponse, err := iterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		values[queryResponse.Key] = queryResponse.Value
+	}
+	for key, write := range c.state {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		if write.deleted {
+			delete(values, key)
+		} else {
+			values[key] = write.value
+		}
+	}
+
+	results := make([]*queryresult.KV, 0, len(values))
+	for key, value := range values {
+		results = append(results, &queryresult.KV{Key: key, Value: value})
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Key < results[j].Key
+	})
+	return &resultsIterator{results: results}, nil
+}
+
+// flush writes the pending writes to the wrapped stub in key order and clears them.
+func (c *writeCache) flush() error {
+	for _, key := range sortedKeys(c.state) {
+		write := c.state[key]
+		if write.deleted {
+			if err := c.ChaincodeStubInterface.DelState(key); err != nil {
+				return err
+			}
+		} else if err := c.ChaincodeStubInterface.PutState(key, write.value); err != nil {
+			return err
+		}
+	}
+	for _, collection := range sortedKeys(c.private) {
+		writes := c.private[collection]
+		for _, key := range sortedKeys(writes) {
+			write := writes[key]
+			if write.deleted {
+				if err := c.ChaincodeStubInterface.DelPrivateData(collection, key); err != nil {
+					return err
+				}
+			} else if err := c.ChaincodeStubInterface.PutPrivateData(collection, key, write.value); err != nil {
+				return err
+			}
+		}
+	}
+	c.state = map[string]cachedWrite{}
+	c.private = map[string]map[string]cachedWrite{}
+	return nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// resultsIterator iterates over query results already held in memory.
+type resultsIterator struct {
+	results []*queryresult.KV
+	next    int
+}
+
+func (it *resultsIterator) HasNext() bool {
+	return it.next < len(it.results)
+}
+
+func (it *resultsIterator) Next() (*queryresult.KV, error) {
+	if !it.HasNext() {
+		return nil, fmt.Errorf("no more results")
+	}
+	result := it.results[it.next]
+	it.next++
+	return result, nil
+}
+
+func (it *resultsIterator) Close() error {
+	return nil
+}
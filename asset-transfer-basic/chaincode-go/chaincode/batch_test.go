@@ -0,0 +1,125 @@
+package chaincode_test
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBatchCreatesSamePatientTwice(t *testing.T) {
+	smartContract := chaincode.SmartContract{}
+	state := ledger{}
+
+	transactionContext, _ := newEndorsement(state, testTxTime, doctorIdentity("doctor1"))
+	withPHI(transactionContext, `[{"PatientName":"Jane Banda","Salt":"0123456789abcdef","Diagnoses":["Otitis media"]},{"Salt":"fedcba9876543210","Diagnoses":["Asthma"]}]`)
+	report, err := smartContract.BatchCreatePrescriptions(transactionContext, `[{"PatientId":"patient1","Prescriptions":[{"MedicationName":"Amoxicillin"}]},{"PatientId":"patient1","Prescriptions":[{"MedicationName":"Salbutamol"}]}]`)
+	require.NoError(t, err)
+	require.Equal(t, 2, report.Created)
+
+	// The second entry sees the patient created by the first and does not overwrite it.
+	transactionContext, _ = newEndorsement(state, testTxTime, doctorIdentity("doctor1"))
+	asset, err := smartContract.ReadAsset(transactionContext, "patient1")
+	require.NoError(t, err)
+	require.Equal(t, "Jane Banda", asset.PatientName)
+	require.Len(t, asset.Prescriptions, 2)
+	require.Equal(t, "Otitis media", asset.Prescriptions[0].Diagnosis)
+	require.Equal(t, "Asthma", asset.Prescriptions[1].Diagnosis)
+	require.Contains(t, state, indexKey(t, "doctor~prescription", "Org1MSP/doctor1", asset.Prescriptions[1].PrescriptionId))
+}
+
+func TestBatchIsAllOrNothing(t *testing.T) {
+	smartContract := chaincode.SmartContract{}
+	state := ledger{}
+
+	transactionContext, chaincodeStub := newEndorsement(state, testTxTime, doctorIdentity("doctor1"))
+	withPHI(transactionContext, `[{"Salt":"0123456789abcdef","Diagnoses":["Otitis media"]},{"Salt":"0123456789abcdef","Diagnoses":[]},{"Salt":"0123456789abcdef","Diagnoses":["Asthma"]}]`)
+	_, err := smartContract.BatchCreatePrescriptions(transactionContext, `[{"PatientId":"patient1","Prescriptions":[{}]},{"PatientId":"patient2","Prescriptions":[{}]},{"PatientId":"doctor1","Prescriptions":[{}]}]`)
+
+	var batchErr *chaincode.BatchError
+	require.True(t, errors.As(err, &batchErr))
+	require.Equal(t, 2, batchErr.Failed)
+	require.Equal(t, []chaincode.BatchItemResult{
+		{Index: 0, PatientId: "patient1", PrescriptionIds: []string{"RX-4a4e3bdbd2f6e1d3-0"}},
+		{Index: 1, PatientId: "patient2", Error: "transient patient details must include one diagnosis per prescription"},
+		{Index: 2, PatientId: "doctor1", Error: "doctors may not issue prescriptions to themselves"},
+	}, batchErr.Items)
+
+	var detail map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(err.Error()), &detail))
+	require.Equal(t, "BatchRejected", detail["Code"])
+
+	// Nothing is written, not even the valid item.
+	require.Zero(t, chaincodeStub.PutStateCallCount())
+	require.Zero(t, chaincodeStub.PutPrivateDataCallCount())
+	require.Zero(t, chaincodeStub.SetEventCallCount())
+	require.Empty(t, state)
+}
+
+func TestBatchReportsInvalidPHIPerItem(t *testing.T) {
+	smartContract := chaincode.SmartContract{}
+	state := ledger{}
+
+	transactionContext, chaincodeStub := newEndorsement(state, testTxTime, doctorIdentity("doctor1"))
+	withPHI(transactionContext, `[{"Salt":"0123456789abcdef","Diagnoses":["Otitis media"]},{"Salt":"short","Diagnoses":["Asthma"]},{"Salt":0}]`)
+	_, err := smartContract.BatchCreatePrescriptions(transactionContext, `[{"PatientId":"patient1","Prescriptions":[{}]},{"PatientId":"patient2","Prescriptions":[{}]},{"PatientId":"patient3","Prescriptions":[{}]},{"PatientId":"patient4","Prescriptions":[{}]}]`)
+
+	var batchErr *chaincode.BatchError
+	require.True(t, errors.As(err, &batchErr))
+	require.Equal(t, 3, batchErr.Failed)
+	require.Equal(t, []chaincode.BatchItemResult{
+		{Index: 0, PatientId: "patient1", PrescriptionIds: []string{"RX-4a4e3bdbd2f6e1d3-0"}},
+		{Index: 1, PatientId: "patient2", Error: "salt must be at least 16 characters"},
+		{Index: 2, PatientId: "patient3", Error: "failed to parse transient patient details: json: cannot unmarshal number into Go struct field phiInput.Salt of type string"},
+		{Index: 3, PatientId: "patient4", Error: "patient details must be submitted in the 'phi' transient field"},
+	}, batchErr.Items)
+	require.Zero(t, chaincodeStub.PutStateCallCount())
+
+	// Without any transient details, every item reports the missing entry.
+	transactionContext, _ = newEndorsement(state, testTxTime, doctorIdentity("doctor1"))
+	_, err = smartContract.BatchCreatePrescriptions(transactionContext, `[{"PatientId":"patient1","Prescriptions":[{}]}]`)
+	require.True(t, errors.As(err, &batchErr))
+	require.Equal(t, 1, batchErr.Failed)
+	require.Equal(t, "patient details must be submitted in the 'phi' transient field", batchErr.Items[0].Error)
+}
+
+func TestBatchSeesEarlierItemsForInteractions(t *testing.T) {
+	smartContract := chaincode.SmartContract{}
+	state := ledger{}
+	withCatalogue(t, state)
+	transactionContext, _ := newEndorsement(state, testTxTime, adminIdentity("Org1MSP", "org1admin"))
+	require.NoError(t, smartContract.SetInteractionSettings(transactionContext, `{"Enforce":true}`))
+
+	transactionContext, _ = newEndorsement(state, testTxTime, doctorIdentity("doctor1"))
+	withPHI(transactionContext, `[{"Salt":"0123456789abcdef","Diagnoses":["Otitis media"]},{"Salt":"0123456789abcdef","Diagnoses":["Arthritis"]}]`)
+	_, err := smartContract.BatchCreatePrescriptions(transactionContext, `[{"PatientId":"patient1","Prescriptions":[{"MedicationName":"Amoxicillin"}]},{"PatientId":"patient1","Prescriptions":[{"MedicationName":"Methotrexate"}]}]`)
+
+	var batchErr *chaincode.BatchError
+	require.True(t, errors.As(err, &batchErr))
+	require.Equal(t, "Methotrexate is contraindicated with Amoxicillin: Reduced methotrexate clearance", batchErr.Items[1].Error)
+}
+
+func TestBatchEnforcesMaxBatchSize(t *testing.T) {
+	smartContract := chaincode.SmartContract{}
+	state := ledger{}
+
+	transactionContext, _ := newEndorsement(state, testTxTime, adminIdentity("Org1MSP", "org1admin"))
+	settings, err := smartContract.GetBatchSettings(transactionContext)
+	require.NoError(t, err)
+	require.Equal(t, 100, settings.MaxBatchSize)
+
+	transactionContext, _ = newEndorsement(state, testTxTime, adminIdentity("Org1MSP", "org1admin"))
+	require.EqualError(t, smartContract.SetBatchSettings(transactionContext, `{"MaxBatchSize":0}`), "maxBatchSize must be between 1 and 1000")
+	transactionContext, _ = newEndorsement(state, testTxTime, adminIdentity("Org1MSP", "org1admin"))
+	require.NoError(t, smartContract.SetBatchSettings(transactionContext, `{"MaxBatchSize":2}`))
+
+	transactionContext, _ = newEndorsement(state, testTxTime, doctorIdentity("doctor1"))
+	withPHI(transactionContext, `[{"Salt":"0123456789abcdef","Diagnoses":["Otitis media"]},{"Salt":"0123456789abcdef","Diagnoses":["Asthma","Eczema"]}]`)
+	_, err = smartContract.BatchCreatePrescriptions(transactionContext, `[{"PatientId":"patient1","Prescriptions":[{}]},{"PatientId":"patient2","Prescriptions":[{},{}]}]`)
+	require.EqualError(t, err, "batch of 3 prescriptions exceeds the maximum batch size of 2")
+
+	transactionContext, _ = newEndorsement(state, testTxTime, doctorIdentity("doctor1"))
+	require.EqualError(t, smartContract.SetBatchSettings(transactionContext, `{"MaxBatchSize":5}`), "caller doctor1 with role 'doctor' is not permitted to call SetBatchSettings")
+}
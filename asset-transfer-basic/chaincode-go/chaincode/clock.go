@@ -0,0 +1,59 @@
+package chaincode
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+)
+
+const (
+	// dateLayout is the format used for prescription expiry dates.
+	dateLayout = "2006-01-02"
+
+	// defaultValidityMonths is how long a prescription stays valid when no expiry date is supplied.
+	defaultValidityMonths = 1
+)
+
+// txClock provides the current time for a transaction. All time values written to the
+// ledger must come from the transaction timestamp rather than the peer's wall clock,
+// otherwise each endorsing peer produces a different write set.
+type txClock struct {
+	now time.Time
+}
+
+// newTxClock creates a clock fixed at the timestamp of the transaction proposal.
+func newTxClock(ctx contractapi.TransactionContextInterface) (*txClock, error) {
+	ts, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get transaction timestamp: %v", err)
+	}
+	if ts == nil {
+		return nil, fmt.Errorf("transaction timestamp is not set")
+	}
+	return &txClock{now: ts.AsTime().UTC()}, nil
+}
+
+// Now returns the transaction time.
+func (c *txClock) Now() time.Time {
+	return c.now
+}
+
+// Timestamp returns the transaction time formatted for storage on the ledger.
+func (c *txClock) Timestamp() string {
+	return c.now.Format(time.RFC3339)
+}
+
+// DefaultExpiryDate returns the expiry date given to prescriptions created without one.
+func (c *txClock) DefaultExpiryDate() string {
+	return c.now.AddDate(0, defaultValidityMonths, 0).Format(dateLayout)
+}
+
+// IsExpired reports whether the given expiry date has passed at transaction time.
+func (c *txClock) IsExpired(expiryDate string) (bool, error) {
+	expiry, err := time.Parse(dateLayout, expiryDate)
+	if err != nil {
+		return false, fmt.Errorf("invalid expiry date format: %v", err)
+	}
+	return c.now.After(expiry), nil
+}
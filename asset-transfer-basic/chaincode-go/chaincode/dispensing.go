@@ -0,0 +1,112 @@
+package chaincode
+
+import "fmt"
+
+// Dispensation records one handout of a prescription by a pharmacy. A fill of the authorized
+// quantity may be handed out over several dispensations. PharmacistMSP is empty on records
+// written before it was recorded.
+type Dispensation struct {
+	Fill          int    `json:"Fill"`
+	Quantity      int    `json:"Quantity"`
+	PharmacistId  string `json:"PharmacistId"`
+	PharmacistMSP string `json:"PharmacistMSP,omitempty"`
+	PharmacyId    string `json:"PharmacyId"`
+	TxID          string `json:"TxID"`
+	Timestamp     string `json:"Timestamp"`
+	Note          string `json:"Note,omitempty"`
+}
+
+// pharmacist returns the MSP-qualified identity of the dispensing pharmacist.
+func (dispensation *Dispensation) pharmacist() string {
+	return qualifiedID(firstNonEmpty(dispensation.PharmacistMSP, legacyPharmacistMSPID), dispensation.PharmacistId)
+}
+
+// validateQuantities checks the quantity and refills requested for a new prescription.
+// Prescriptions without a quantity are dispensed in a single handout, as before quantities
+// were tracked.
+func (prescription *Prescription) validateQuantities() error {
+	if prescription.Quantity < 0 || prescription.Refills < 0 {
+		return fmt.Errorf("quantity and refills cannot be negative")
+	}
+	if prescription.Refills > 0 && prescription.Quantity == 0 {
+		return fmt.Errorf("a quantity is required for prescriptions with refills")
+	}
+	return nil
+}
+
+// isQuantified reports whether the prescription tracks quantities and refills.
+func (prescription *Prescription) isQuantified() bool {
+	return prescription.Quantity > 0
+}
+
+// dispensedQuantity returns the total quantity handed out so far.
+func (prescription *Prescription) dispensedQuantity() int {
+	total := 0
+	for _, dispensation := range prescription.Dispensations {
+		total += dispensation.Quantity
+	}
+	return total
+}
+
+// RemainingQuantity returns the quantity still to be dispensed over the current fill and all
+// remaining refills.
+func (prescription *Prescription) RemainingQuantity() int {
+	return prescription.Quantity*(prescription.Refills+1) - prescription.dispensedQuantity()
+}
+
+// RefillsRemaining returns the number of refills that have not been started.
+func (prescription *Prescription) RefillsRemaining() int {
+	if !prescription.isQuantified() {
+		return 0
+	}
+	started := (prescription.dispensedQuantity() + prescription.Quantity - 1) / prescription.Quantity
+	if started == 0 {
+		return prescription.Refills
+	}
+	return prescription.Refills - (started - 1)
+}
+
+// currentFill returns the number of the fill the next dispensation belongs to and the quantity
+// left in it.
+func (prescription *Prescription) currentFill() (int, int) {
+	dispensed := prescription.dispensedQuantity()
+	return dispensed/prescription.Quantity + 1, prescription.Quantity - dispensed%prescription.Quantity
+}
+
+// dispense records a dispensation of quantity and moves the prescription to the status derived
+// from what remains: PartiallyDispensed while any quantity or refills remain, Dispensed once
+// everything authorized has been handed out. A quantity of zero dispenses the rest of the
+// current fill. A single dispensation cannot span fills.
+func (prescription *Prescription) dispense(dispensation Dispensation) error {
+	if dispensation.Quantity < 0 {
+		return fmt.Errorf("quantity cannot be negative")
+	}
+
+	next := StatusDispensed
+	if !prescription.isQuantified() {
+		if dispensation.Quantity != 0 {
+			return fmt.Errorf("prescription %s has no authorized quantity", prescription.PrescriptionId)
+		}
+		dispensation.Fill = 1
+	} else {
+		fill, available := prescription.currentFill()
+		if dispensation.Quantity == 0 {
+			dispensation.Quantity = available
+		}
+		if dispensation.Quantity > available {
+			return fmt.Errorf("quantity %d exceeds the %d remaining in fill %d of prescription %s", dispensation.Quantity, available, fill, prescription.PrescriptionId)
+		}
+		dispensation.Fill = fill
+		if prescription.RemainingQuantity() > dispensation.Quantity {
+			next = StatusPartiallyDispensed
+		}
+	}
+
+	if err := prescription.transition(next, OperationDispense); err != nil {
+		return err
+	}
+	prescription.Dispensations = append(prescription.Dispensations, dispensation)
+	prescription.DispensingPharmacist = dispensation.PharmacistId
+	prescription.DispensingTimestamp = dispensation.Timestamp
+	return nil
+}
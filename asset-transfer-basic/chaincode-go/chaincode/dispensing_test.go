@@ -0,0 +1,141 @@
+package chaincode_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode"
+	"github.com/stretchr/testify/require"
+)
+
+// patientWithRefills returns the active patient with rx1 authorized for quantity per fill
+// and the given number of refills.
+func patientWithRefills(t *testing.T, quantity int, refills int) ledger {
+	asset := activePatientAsset()
+	asset.Prescriptions[0].Quantity = quantity
+	asset.Prescriptions[0].Refills = refills
+	return patientState(t, asset)
+}
+
+func dispense(t *testing.T, state ledger, dispensationJSON string) error {
+	t.Helper()
+	smartContract := chaincode.SmartContract{}
+	transactionContext, _ := newEndorsement(state, testTxTime, pharmacistIdentity("pharmacist1"))
+	return smartContract.DispensePrescription(transactionContext, dispensationJSON)
+}
+
+func TestRepeatDispensingTracksFillsAndRefills(t *testing.T) {
+	state := patientWithRefills(t, 30, 1)
+
+	require.NoError(t, dispense(t, state, `{"patientId":"patient1","prescriptionId":"rx1","quantity":10,"pharmacyId":"pharmacy-lilongwe"}`))
+	prescription := readPatient(t, state, "patient1").Prescriptions[0]
+	require.Equal(t, chaincode.StatusPartiallyDispensed, prescription.Status)
+	require.Equal(t, 50, prescription.RemainingQuantity())
+	require.Equal(t, 1, prescription.RefillsRemaining())
+
+	// Without a quantity the rest of the current fill is dispensed.
+	require.NoError(t, dispense(t, state, `{"patientId":"patient1","prescriptionId":"rx1"}`))
+	prescription = readPatient(t, state, "patient1").Prescriptions[0]
+	require.Equal(t, chaincode.StatusPartiallyDispensed, prescription.Status)
+	require.Equal(t, 30, prescription.RemainingQuantity())
+	require.Equal(t, 1, prescription.RefillsRemaining())
+
+	err := dispense(t, state, `{"patientId":"patient1","prescriptionId":"rx1","quantity":40}`)
+	require.EqualError(t, err, "quantity 40 exceeds the 30 remaining in fill 2 of prescription rx1")
+
+	require.NoError(t, dispense(t, state, `{"patientId":"patient1","prescriptionId":"rx1","quantity":30}`))
+	prescription = readPatient(t, state, "patient1").Prescriptions[0]
+	require.Equal(t, chaincode.StatusDispensed, prescription.Status)
+	require.Equal(t, 0, prescription.RemainingQuantity())
+	require.Equal(t, 0, prescription.RefillsRemaining())
+
+	require.Equal(t, []chaincode.Dispensation{
+		{Fill: 1, Quantity: 10, PharmacistId: "pharmacist1", PharmacistMSP: "Org2MSP", PharmacyId: "pharmacy-lilongwe", TxID: testTxID, Timestamp: "2025-03-14T09:30:00Z"},
+		{Fill: 1, Quantity: 20, PharmacistId: "pharmacist1", PharmacistMSP: "Org2MSP", PharmacyId: "Org2MSP", TxID: testTxID, Timestamp: "2025-03-14T09:30:00Z"},
+		{Fill: 2, Quantity: 30, PharmacistId: "pharmacist1", PharmacistMSP: "Org2MSP", PharmacyId: "Org2MSP", TxID: testTxID, Timestamp: "2025-03-14T09:30:00Z"},
+	}, prescription.Dispensations)
+
+	err = dispense(t, state, `{"patientId":"patient1","prescriptionId":"rx1","quantity":1}`)
+	var transitionError *chaincode.TransitionError
+	require.True(t, errors.As(err, &transitionError))
+	require.Equal(t, chaincode.StatusDispensed, transitionError.From)
+}
+
+// requireStatusMatchesCounters checks that a prescription that is not on hold has the status
+// its dispensing counters imply.
+func requireStatusMatchesCounters(t *testing.T, prescription chaincode.Prescription) {
+	t.Helper()
+	expected := chaincode.StatusDispensed
+	switch {
+	case len(prescription.Dispensations) == 0:
+		expected = chaincode.StatusActive
+	case prescription.RemainingQuantity() > 0:
+		expected = chaincode.StatusPartiallyDispensed
+	}
+	require.Equal(t, expected, prescription.Status, "%d remaining after %d dispensations", prescription.RemainingQuantity(), len(prescription.Dispensations))
+}
+
+func TestStatusAlwaysMatchesDispensingCounters(t *testing.T) {
+	smartContract := chaincode.SmartContract{}
+	state := patientWithRefills(t, 30, 1)
+	current := func() chaincode.Prescription {
+		return readPatient(t, state, "patient1").Prescriptions[0]
+	}
+	requireStatusMatchesCounters(t, current())
+
+	require.NoError(t, dispense(t, state, `{"patientId":"patient1","prescriptionId":"rx1","quantity":10}`))
+	requireStatusMatchesCounters(t, current())
+
+	// A status patch cannot claim the rest was handed out.
+	transactionContext, _ := newEndorsement(state, testTxTime, doctorIdentity("doctor1"))
+	err := smartContract.UpdatePrescription(transactionContext, "patient1", `{"PrescriptionId":"rx1","Reason":"Handed out","Changes":{"Status":"Dispensed"}}`)
+	require.Error(t, err)
+	requireStatusMatchesCounters(t, current())
+
+	// Releasing a hold restores the status the counters imply rather than Active.
+	transactionContext, _ = newEndorsement(state, testTxTime, doctorIdentity("doctor1"))
+	require.NoError(t, smartContract.HoldPrescription(transactionContext, "patient1", "rx1"))
+	require.Equal(t, chaincode.StatusOnHold, current().Status)
+	transactionContext, _ = newEndorsement(state, testTxTime, doctorIdentity("doctor1"))
+	require.NoError(t, smartContract.ReleasePrescription(transactionContext, "patient1", "rx1"))
+	requireStatusMatchesCounters(t, current())
+
+	require.NoError(t, dispense(t, state, `{"patientId":"patient1","prescriptionId":"rx1"}`))
+	requireStatusMatchesCounters(t, current())
+	require.NoError(t, dispense(t, state, `{"patientId":"patient1","prescriptionId":"rx1","quantity":30}`))
+	requireStatusMatchesCounters(t, current())
+	require.Equal(t, chaincode.StatusDispensed, current().Status)
+}
+
+func TestUnquantifiedPrescriptionDispensesInFull(t *testing.T) {
+	state := activePatient(t)
+
+	err := dispense(t, state, `{"patientId":"patient1","prescriptionId":"rx1","quantity":5}`)
+	require.EqualError(t, err, "prescription rx1 has no authorized quantity")
+
+	require.NoError(t, dispense(t, state, `{"patientId":"patient1","prescriptionId":"rx1"}`))
+	prescription := readPatient(t, state, "patient1").Prescriptions[0]
+	require.Equal(t, chaincode.StatusDispensed, prescription.Status)
+	require.Equal(t, "pharmacist1", prescription.DispensingPharmacist)
+	require.Len(t, prescription.Dispensations, 1)
+}
+
+func TestCreateAssetValidatesQuantities(t *testing.T) {
+	smartContract := chaincode.SmartContract{}
+
+	transactionContext, _ := newEndorsement(ledger{}, testTxTime, doctorIdentity("doctor1"))
+	withPHI(transactionContext, `{"PatientName":"Jane Banda","Salt":"0123456789abcdef","Diagnoses":["Hypertension"]}`)
+	_, err := smartContract.CreateAsset(transactionContext, `{"PatientId":"patient1","DoctorId":"doctor1","Prescriptions":[{"MedicationName":"Amlodipine","Refills":5}]}`)
+	require.EqualError(t, err, "a quantity is required for prescriptions with refills")
+
+	state := ledger{}
+	transactionContext, _ = newEndorsement(state, testTxTime, doctorIdentity("doctor1"))
+	withPHI(transactionContext, `{"PatientName":"Jane Banda","Salt":"0123456789abcdef","Diagnoses":["Hypertension"]}`)
+	_, err = smartContract.CreateAsset(transactionContext, `{"PatientId":"patient1","DoctorId":"doctor1","Prescriptions":[{"MedicationName":"Amlodipine","Quantity":30,"Refills":5,"Dispensations":[{"Quantity":30}]}]}`)
+	require.NoError(t, err)
+
+	prescription := readPatient(t, state, "patient1").Prescriptions[0]
+	require.Empty(t, prescription.Dispensations)
+	require.Equal(t, 180, prescription.RemainingQuantity())
+	require.Equal(t, 5, prescription.RefillsRemaining())
+}
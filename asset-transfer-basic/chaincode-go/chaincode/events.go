@@ -0,0 +1,96 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+)
+
+// Every transaction that changes the status or content of prescriptions emits one chaincode
+// event named after the transition. Fabric keeps only the last event set by a transaction, so
+// a transaction that touches several prescriptions lists them all in a single payload.
+//
+// Payloads identify prescriptions and actors only; they never carry patient names, dates of
+// birth, diagnoses or medications. Consumers should check SchemaVersion before decoding.
+const (
+	eventSchemaVersion = 1
+
+	eventPrescriptionCreated   = "PrescriptionCreated"
+	eventPrescriptionUpdated   = "PrescriptionUpdated"
+	eventPrescriptionDispensed = "PrescriptionDispensed"
+	eventPrescriptionRevoked   = "PrescriptionRevoked"
+	eventPrescriptionExpired   = "PrescriptionExpired"
+	eventPrescriptionOnHold    = "PrescriptionOnHold"
+	eventPrescriptionReleased  = "PrescriptionReleased"
+)
+
+// PrescriptionEvent is the payload of a prescription lifecycle event.
+type PrescriptionEvent struct {
+	SchemaVersion int                      `json:"SchemaVersion"`
+	EventName     string                   `json:"EventName"`
+	TxID          string                   `json:"TxID"`
+	Timestamp     string                   `json:"Timestamp"`
+	Actor         string                   `json:"Actor"`
+	ActorMSPID    string                   `json:"ActorMSPID"`
+	Prescriptions []PrescriptionEventEntry `json:"Prescriptions"`
+}
+
+// PrescriptionEventEntry identifies one prescription affected by an event.
+type PrescriptionEventEntry struct {
+	PatientId      string             `json:"PatientId"`
+	PrescriptionId string             `json:"PrescriptionId"`
+	PreviousStatus PrescriptionStatus `json:"PreviousStatus,omitempty"`
+	Status         PrescriptionStatus `json:"Status"`
+}
+
+// newEventEntry describes the transition of a prescription from previousStatus to its
+// current status.
+func newEventEntry(prescription *Prescription, previousStatus PrescriptionStatus) PrescriptionEventEntry {
+	return PrescriptionEventEntry{
+		PatientId:      prescription.PatientId,
+		PrescriptionId: prescription.PrescriptionId,
+		PreviousStatus: previousStatus,
+		Status:         prescription.Status,
+	}
+}
+
+// createdEntries lists the prescriptions created by CreateAsset or BatchCreatePrescriptions.
+func createdEntries(results ...*CreateAssetResult) []PrescriptionEventEntry {
+	entries := []PrescriptionEventEntry{}
+	for _, result := range results {
+		for _, prescriptionId := range result.PrescriptionIds {
+			entries = append(entries, PrescriptionEventEntry{
+				PatientId:      result.PatientId,
+				PrescriptionId: prescriptionId,
+				Status:         StatusActive,
+			})
+		}
+	}
+	return entries
+}
+
+// emitPrescriptionEvent sets the transaction's chaincode event. It does nothing if entries
+// is empty, so that transactions which changed nothing emit no event.
+func emitPrescriptionEvent(ctx contractapi.TransactionContextInterface, eventName string, actor *caller, clock *txClock, entries []PrescriptionEventEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	payload, err := json.Marshal(PrescriptionEvent{
+		SchemaVersion: eventSchemaVersion,
+		EventName:     eventName,
+		TxID:          ctx.GetStub().GetTxID(),
+		Timestamp:     clock.Timestamp(),
+		Actor:         actor.EnrollmentID,
+		ActorMSPID:    actor.MSPID,
+		Prescriptions: entries,
+	})
+	if err != nil {
+		return err
+	}
+	if err := ctx.GetStub().SetEvent(eventName, payload); err != nil {
+		return fmt.Errorf("failed to set %s event: %v", eventName, err)
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package chaincode_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode"
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode/mocks"
+	"github.com/stretchr/testify/require"
+)
+
+// emittedEvent returns the single chaincode event set by a transaction.
+func emittedEvent(t *testing.T, chaincodeStub *mocks.ChaincodeStub) (string, chaincode.PrescriptionEvent, []byte) {
+	t.Helper()
+	require.Equal(t, 1, chaincodeStub.SetEventCallCount())
+	name, payload := chaincodeStub.SetEventArgsForCall(0)
+
+	var event chaincode.PrescriptionEvent
+	require.NoError(t, json.Unmarshal(payload, &event))
+	return name, event, payload
+}
+
+func TestLifecycleTransitionsEmitEvents(t *testing.T) {
+	smartContract := chaincode.SmartContract{}
+
+	tests := []struct {
+		name     string
+		identity *mocks.ClientIdentity
+		invoke   func(ctx contractapi.TransactionContextInterface) error
+		expected chaincode.PrescriptionEvent
+	}{
+		{
+			name:     "PrescriptionUpdated",
+			identity: doctorIdentity("doctor1"),
+			invoke: func(ctx contractapi.TransactionContextInterface) error {
+				return smartContract.UpdatePrescription(ctx, "patient1", `{"PrescriptionId":"rx1","Reason":"Dose adjusted for weight","Changes":{"Dosage":"250mg"}}`)
+			},
+			expected: chaincode.PrescriptionEvent{
+				Actor:         "doctor1",
+				ActorMSPID:    "Org1MSP",
+				Prescriptions: []chaincode.PrescriptionEventEntry{{PatientId: "patient1", PrescriptionId: "rx1", PreviousStatus: "Active", Status: "Active"}},
+			},
+		},
+		{
+			name:     "PrescriptionDispensed",
+			identity: pharmacistIdentity("pharmacist1"),
+			invoke: func(ctx contractapi.TransactionContextInterface) error {
+				return smartContract.DispensePrescription(ctx, `{"patientId":"patient1","prescriptionId":"rx1"}`)
+			},
+			expected: chaincode.PrescriptionEvent{
+				Actor:         "pharmacist1",
+				ActorMSPID:    "Org2MSP",
+				Prescriptions: []chaincode.PrescriptionEventEntry{{PatientId: "patient1", PrescriptionId: "rx1", PreviousStatus: "Active", Status: "Dispensed"}},
+			},
+		},
+		{
+			name:     "PrescriptionRevoked",
+			identity: doctorIdentity("doctor1"),
+			invoke: func(ctx contractapi.TransactionContextInterface) error {
+				return smartContract.RevokePrescriptionJSON(ctx, `{"patientId":"patient1","prescriptionId":"rx1"}`)
+			},
+			expected: chaincode.PrescriptionEvent{
+				Actor:         "doctor1",
+				ActorMSPID:    "Org1MSP",
+				Prescriptions: []chaincode.PrescriptionEventEntry{{PatientId: "patient1", PrescriptionId: "rx1", PreviousStatus: "Active", Status: "Revoked"}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transactionContext, chaincodeStub := newEndorsement(activePatient(t), testTxTime, tt.identity)
+			require.NoError(t, tt.invoke(transactionContext))
+
+			name, event, _ := emittedEvent(t, chaincodeStub)
+			tt.expected.SchemaVersion = 1
+			tt.expected.EventName = tt.name
+			tt.expected.TxID = testTxID
+			tt.expected.Timestamp = "2025-03-14T09:30:00Z"
+			require.Equal(t, tt.name, name)
+			require.Equal(t, tt.expected, event)
+		})
+	}
+}
+
+func TestCreateEventsCarryNoPrivateData(t *testing.T) {
+	smartContract := chaincode.SmartContract{}
+
+	transactionContext, chaincodeStub := newEndorsement(ledger{}, testTxTime, doctorIdentity("doctor1"))
+	withPHI(transactionContext, `[{"PatientName":"Jane Banda","DateOfBirth":"1990-01-01","Salt":"0123456789abcdef","Diagnoses":["Otitis media"]},{"PatientName":"John Phiri","Salt":"fedcba9876543210","Diagnoses":["Asthma"]}]`)
+	_, err := smartContract.BatchCreatePrescriptions(transactionContext, `[{"PatientId":"patient1","Prescriptions":[{"MedicationName":"Amoxicillin"}]},{"PatientId":"patient2","Prescriptions":[{"MedicationName":"Salbutamol"}]}]`)
+	require.NoError(t, err)
+
+	// A batch emits one event listing every prescription it created.
+	name, event, payload := emittedEvent(t, chaincodeStub)
+	require.Equal(t, "PrescriptionCreated", name)
+	require.Equal(t, []chaincode.PrescriptionEventEntry{
+		{PatientId: "patient1", PrescriptionId: "RX-4a4e3bdbd2f6e1d3-0", Status: "Active"},
+		{PatientId: "patient2", PrescriptionId: "RX-4a4e3bdbd2f6e1d3-1", Status: "Active"},
+	}, event.Prescriptions)
+
+	for _, private := range []string{"Jane Banda", "1990-01-01", "Otitis media", "John Phiri", "Asthma", "Amoxicillin", "Salbutamol"} {
+		require.NotContains(t, string(payload), private)
+	}
+}
+
+func TestPrescriptionExpiredEventOnlyWhenExpired(t *testing.T) {
+	smartContract := chaincode.SmartContract{}
+
+	transactionContext, chaincodeStub := newEndorsement(activePatient(t), testTxTime, pharmacistIdentity("pharmacist1"))
+	require.NoError(t, smartContract.CheckPrescriptionExpiry(transactionContext, "patient1", "rx1"))
+	require.Equal(t, 0, chaincodeStub.SetEventCallCount())
+
+	transactionContext, chaincodeStub = newEndorsement(activePatient(t), testTxTime.AddDate(0, 1, 0), pharmacistIdentity("pharmacist1"))
+	require.NoError(t, smartContract.CheckPrescriptionExpiry(transactionContext, "patient1", "rx1"))
+	name, event, _ := emittedEvent(t, chaincodeStub)
+	require.Equal(t, "PrescriptionExpired", name)
+	require.Equal(t, []chaincode.PrescriptionEventEntry{{PatientId: "patient1", PrescriptionId: "rx1", PreviousStatus: "Active", Status: "Expired"}}, event.Prescriptions)
+}
@@ -0,0 +1,6 @@
+package chaincode
+
+// Transition exposes transition to the tests of the chaincode package.
+func (prescription *Prescription) Transition(next PrescriptionStatus, operation string) error {
+	return prescription.transition(next, operation)
+}
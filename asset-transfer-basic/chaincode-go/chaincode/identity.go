@@ -0,0 +1,90 @@
+package chaincode
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+)
+
+const (
+	roleDoctor     = "doctor"
+	rolePharmacist = "pharmacist"
+
+	// enrollmentIDAttribute is added by Fabric CA to every certificate it issues.
+	enrollmentIDAttribute = "hf.EnrollmentID"
+
+	// legacyDoctorMSPID and legacyPharmacistMSPID are the organizations of the doctors and
+	// pharmacists named in records written before their MSP ID was recorded, when each role
+	// belonged to a single organization.
+	legacyDoctorMSPID     = "Org1MSP"
+	legacyPharmacistMSPID = "Org2MSP"
+)
+
+// caller is the verified identity that submitted the current transaction.
+type caller struct {
+	MSPID        string
+	Role         string
+	EnrollmentID string
+}
+
+// checkClaim rejects a payload that names a different actor than the submitting identity.
+// An empty claim is accepted and replaced by the verified identity.
+func (c *caller) checkClaim(field string, claimed string) error {
+	if claimed != "" && claimed != c.EnrollmentID {
+		return fmt.Errorf("%s '%s' does not match the submitting identity '%s'", field, claimed, c.EnrollmentID)
+	}
+	return nil
+}
+
+// ID returns the caller's MSP-qualified identity. Enrollment IDs are unique only within the
+// CA of one organization, so ownership is always checked against this identity.
+func (c *caller) ID() string {
+	return qualifiedID(c.MSPID, c.EnrollmentID)
+}
+
+// prescribed reports whether the caller wrote the prescription.
+func (c *caller) prescribed(prescription *Prescription) bool {
+	return prescription.CreatedBy != "" && prescription.prescriber() == c.ID()
+}
+
+// qualifiedID returns the identity of an enrollment ID within an MSP, such as Org1MSP/doctor1.
+func qualifiedID(mspID string, enrollmentID string) string {
+	return mspID + "/" + enrollmentID
+}
+
+// qualifyID returns id unchanged if it names an MSP, and qualified with defaultMSPID if it is
+// a bare enrollment ID.
+func qualifyID(id string, defaultMSPID string) string {
+	if strings.Contains(id, "/") {
+		return id
+	}
+	return qualifiedID(defaultMSPID, id)
+}
+
+// enrollmentIDOf returns the enrollment ID part of an MSP-qualified identity.
+func enrollmentIDOf(id string) string {
+	_, enrollmentID, _ := strings.Cut(id, "/")
+	return enrollmentID
+}
+
+// getEnrollmentID returns the enrollment ID of the submitting identity, falling back to
+// the certificate common name for certificates not issued by Fabric CA.
+func getEnrollmentID(ctx contractapi.TransactionContextInterface) (string, error) {
+	enrollmentID, ok, err := ctx.GetClientIdentity().GetAttributeValue(enrollmentIDAttribute)
+	if err != nil {
+		return "", fmt.Errorf("failed to get enrollment ID attribute: %v", err)
+	}
+	if ok && enrollmentID != "" {
+		return enrollmentID, nil
+	}
+
+	cert, err := ctx.GetClientIdentity().GetX509Certificate()
+	if err != nil {
+		return "", fmt.Errorf("failed to get client certificate: %v", err)
+	}
+	if cert == nil || cert.Subject.CommonName == "" {
+		return "", fmt.Errorf("client certificate has no enrollment ID")
+	}
+	return cert.Subject.CommonName, nil
+}
@@ -0,0 +1,203 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+)
+
+// Secondary indexes let lookups by doctor, pharmacist and status read only the matching
+// prescriptions on LevelDB, which has no rich queries. Each index entry is a composite key
+// ending in the patient and prescription IDs, with an empty value. Doctors and pharmacists
+// are indexed by their MSP-qualified identity. putPrescription keeps the
+// entries in step with the prescription in the same transaction.
+//
+// The expiry index holds only prescriptions that can still expire, keyed by expiry date first
+// so that entries come back in date order.
+const (
+	doctorIndex     = "doctor~prescription"
+	pharmacistIndex = "pharmacist~prescription"
+	statusIndex     = "status~prescription"
+	expiryIndex     = "expiry~prescription"
+)
+
+// indexValue is stored under every index key; the key itself carries the information.
+var indexValue = []byte{0x00}
+
+// indexEntries returns the index keys of a prescription, sorted. A nil prescription has none.
+func indexEntries(ctx contractapi.TransactionContextInterface, prescription *Prescription) ([]string, error) {
+	if prescription == nil {
+		return nil, nil
+	}
+
+	attributes := [][]string{}
+	if prescription.CreatedBy != "" {
+		attributes = append(attributes, []string{doctorIndex, prescription.prescriber()})
+	}
+	for _, pharmacistId := range prescription.pharmacists() {
+		attributes = append(attributes, []string{pharmacistIndex, pharmacistId})
+	}
+	if prescription.Status != "" {
+		attributes = append(attributes, []string{statusIndex, string(prescription.Status)})
+	}
+	if prescription.ExpiryDate != "" && prescription.Status.CanTransitionTo(StatusExpired) {
+		attributes = append(attributes, []string{expiryIndex, prescription.ExpiryDate})
+	}
+
+	keys := []string{}
+	for _, attribute := range attributes {
+		key, err := ctx.GetStub().CreateCompositeKey(attribute[0], []string{attribute[1], prescription.PatientId, prescription.PrescriptionId})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create %s index key: %v", attribute[0], err)
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// prescriber returns the MSP-qualified identity of the doctor who wrote the prescription, or
+// an empty string if it does not record one.
+func (prescription *Prescription) prescriber() string {
+	if prescription.CreatedBy == "" {
+		return ""
+	}
+	return qualifiedID(firstNonEmpty(prescription.CreatedByMSP, legacyDoctorMSPID), prescription.CreatedBy)
+}
+
+// pharmacists returns the MSP-qualified identities of the pharmacists who dispensed any of the
+// prescription, sorted. DispensingPharmacist is only consulted for legacy prescriptions
+// dispensed without a dispensation record.
+func (prescription *Prescription) pharmacists() []string {
+	seen := map[string]bool{}
+	if prescription.DispensingPharmacist != "" && len(prescription.Dispensations) == 0 {
+		seen[qualifiedID(legacyPharmacistMSPID, prescription.DispensingPharmacist)] = true
+	}
+	for _, dispensation := range prescription.Dispensations {
+		seen[dispensation.pharmacist()] = true
+	}
+
+	pharmacists := make([]string, 0, len(seen))
+	for pharmacistId := range seen {
+		pharmacists = append(pharmacists, pharmacistId)
+	}
+	sort.Strings(pharmacists)
+	return pharmacists
+}
+
+// updateIndexes deletes the index entries of previous that next no longer has and writes the
+// entries next gains. previous is nil for a prescription that was not stored under its own
+// key before.
+func updateIndexes(ctx contractapi.TransactionContextInterface, previous *Prescription, next *Prescription) error {
+	previousKeys, err := indexEntries(ctx, previous)
+	if err != nil {
+		return err
+	}
+	nextKeys, err := indexEntries(ctx, next)
+	if err != nil {
+		return err
+	}
+
+	keep := map[string]bool{}
+	for _, key := range nextKeys {
+		keep[key] = true
+	}
+	existing := map[string]bool{}
+	for _, key := range previousKeys {
+		existing[key] = true
+		if !keep[key] {
+			if err := ctx.GetStub().DelState(key); err != nil {
+				return fmt.Errorf("failed to delete index entry: %v", err)
+			}
+		}
+	}
+	for _, key := range nextKeys {
+		if !existing[key] {
+			if err := ctx.GetStub().PutState(key, indexValue); err != nil {
+				return fmt.Errorf("failed to write index entry: %v", err)
+			}
+		}
+	}
+	return nil
+}
+
+// readStoredPrescription returns the public record stored under a prescription's own key, or
+// nil if there is none.
+func readStoredPrescription(ctx contractapi.TransactionContextInterface, key string) (*Prescription, error) {
+	prescriptionJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read prescription: %v", err)
+	}
+	if prescriptionJSON == nil {
+		return nil, nil
+	}
+
+	var prescription Prescription
+	if err := json.Unmarshal(prescriptionJSON, &prescription); err != nil {
+		return nil, err
+	}
+	return &prescription, nil
+}
+
+// listIndexedPrescriptions returns the prescriptions under an index entry prefix, such as
+// all prescriptions created by one doctor, with their private fields.
+func listIndexedPrescriptions(ctx contractapi.TransactionContextInterface, index string, value string) ([]*Prescription, error) {
+	iterator, err := ctx.GetStub().GetStateByPartialCompositeKey(index, []string{value})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s index: %v", index, err)
+	}
+	defer iterator.Close()
+
+	prescriptions := []*Prescription{}
+	for iterator.HasNext() {
+		queryResponse, err := iterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		prescription, err := readIndexedPrescription(ctx, queryResponse.Key)
+		if err != nil {
+			return nil, err
+		}
+		prescriptions = append(prescriptions, prescription)
+	}
+	return prescriptions, nil
+}
+
+// readIndexedPrescription reads the prescription an index key refers to.
+func readIndexedPrescription(ctx contractapi.TransactionContextInterface, indexKey string) (*Prescription, error) {
+	_, attributes, err := ctx.GetStub().SplitCompositeKey(indexKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to split index key: %v", err)
+	}
+	if len(attributes) != 3 {
+		return nil, fmt.Errorf("malformed index key %q", indexKey)
+	}
+	return readPrescription(ctx, attributes[1], attributes[2])
+}
+
+// patientNames looks up patient names, reading each patient's private details once.
+type patientNames struct {
+	ctx   contractapi.TransactionContextInterface
+	names map[string]string
+}
+
+func newPatientNames(ctx contractapi.TransactionContextInterface) *patientNames {
+	return &patientNames{ctx: ctx, names: map[string]string{}}
+}
+
+func (p *patientNames) get(patientId string) (string, error) {
+	if name, ok := p.names[patientId]; ok {
+		return name, nil
+	}
+	patient, err := readPatient(p.ctx, patientId)
+	if err != nil {
+		return "", err
+	}
+	if err := mergePatientPrivate(p.ctx, patient); err != nil {
+		return "", err
+	}
+	p.names[patientId] = patient.PatientName
+	return patient.PatientName, nil
+}
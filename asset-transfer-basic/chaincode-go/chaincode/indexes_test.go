@@ -0,0 +1,90 @@
+package chaincode_test
+
+import (
+	"testing"
+
+	"github.com/hyperledger/fabric-chaincode-go/v2/shim"
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode"
+	"github.com/stretchr/testify/require"
+)
+
+func indexKey(t *testing.T, index string, value string, prescriptionId string) string {
+	t.Helper()
+	key, err := shim.CreateCompositeKey(index, []string{value, "patient1", prescriptionId})
+	require.NoError(t, err)
+	return key
+}
+
+func TestLookupsReadSecondaryIndexes(t *testing.T) {
+	smartContract := chaincode.SmartContract{}
+	state := analyticsState(t)
+
+	transactionContext, chaincodeStub := newEndorsement(state, testTxTime, doctorIdentity("doctor1"))
+	prescriptions, err := smartContract.GetPrescriptionsByDoctor(transactionContext, "doctor1")
+	require.NoError(t, err)
+	require.Len(t, prescriptions, 2)
+	require.Equal(t, "rx1", prescriptions[0]["PrescriptionId"])
+	require.Equal(t, "rx2", prescriptions[1]["PrescriptionId"])
+	require.Equal(t, "Otitis media", prescriptions[0]["Diagnosis"])
+	require.Zero(t, chaincodeStub.GetStateByRangeCallCount())
+
+	transactionContext, _ = newEndorsement(state, testTxTime, doctorIdentity("doctor1"))
+	_, err = smartContract.GetPrescriptionsByDoctor(transactionContext, "doctor3")
+	require.EqualError(t, err, "no prescriptions found for doctor doctor3")
+
+	// rx2 was only partly dispensed by pharmacist2 before pharmacist1 dispensed the refill.
+	transactionContext, chaincodeStub = newEndorsement(state, testTxTime, pharmacistIdentity("pharmacist2"))
+	history, err := smartContract.GetDispenseHistory(transactionContext, "pharmacist2")
+	require.NoError(t, err)
+	require.Len(t, history, 2)
+	require.Equal(t, "rx2", history[0]["PrescriptionId"])
+	require.Equal(t, "rx4", history[1]["PrescriptionId"])
+	require.Zero(t, chaincodeStub.GetStateByRangeCallCount())
+}
+
+func TestIndexesFollowPrescriptionWrites(t *testing.T) {
+	state := activePatient(t)
+	require.Contains(t, state, indexKey(t, "status~prescription", "Active", "rx1"))
+
+	require.NoError(t, dispense(t, state, `{"patientId":"patient1","prescriptionId":"rx1"}`))
+	require.NotContains(t, state, indexKey(t, "status~prescription", "Active", "rx1"))
+	require.Contains(t, state, indexKey(t, "status~prescription", "Dispensed", "rx1"))
+	require.Contains(t, state, indexKey(t, "pharmacist~prescription", "Org2MSP/pharmacist1", "rx1"))
+	require.Contains(t, state, indexKey(t, "doctor~prescription", "Org1MSP/doctor1", "rx1"))
+
+	smartContract := chaincode.SmartContract{}
+	transactionContext, _ := newEndorsement(state, testTxTime, pharmacistIdentity("pharmacist1"))
+	page, err := smartContract.QueryPrescriptionsByStatus(transactionContext, "Active", 10, "")
+	require.NoError(t, err)
+	require.Empty(t, page.Records)
+}
+
+func TestMigrateAssetsBackfillsIndexes(t *testing.T) {
+	smartContract := chaincode.SmartContract{}
+	state := patientState(t, twoPrescriptionPatient())
+	for _, prescriptionId := range []string{"rx1", "rx2"} {
+		delete(state, indexKey(t, "doctor~prescription", "Org1MSP/doctor1", prescriptionId))
+	}
+	delete(state, indexKey(t, "status~prescription", "Active", "rx2"))
+
+	transactionContext, _ := newEndorsement(state, testTxTime, doctorIdentity("doctor1"))
+	_, err := smartContract.GetPrescriptionsByDoctor(transactionContext, "doctor1")
+	require.EqualError(t, err, "no prescriptions found for doctor doctor1")
+
+	transactionContext, _ = newEndorsement(state, testTxTime, adminIdentity("Org1MSP", "org1admin"))
+	report, err := smartContract.MigrateAssets(transactionContext, "", 0)
+	require.NoError(t, err)
+	require.Equal(t, &chaincode.MigrationReport{PatientsScanned: 1, PrescriptionsIndexed: 2}, report)
+	require.Contains(t, state, indexKey(t, "status~prescription", "Active", "rx2"))
+
+	transactionContext, _ = newEndorsement(state, testTxTime, doctorIdentity("doctor1"))
+	prescriptions, err := smartContract.GetPrescriptionsByDoctor(transactionContext, "doctor1")
+	require.NoError(t, err)
+	require.Len(t, prescriptions, 2)
+
+	// A second run finds nothing left to index.
+	transactionContext, _ = newEndorsement(state, testTxTime, adminIdentity("Org1MSP", "org1admin"))
+	report, err = smartContract.MigrateAssets(transactionContext, "", 0)
+	require.NoError(t, err)
+	require.Zero(t, report.PrescriptionsIndexed)
+}
@@ -0,0 +1,574 @@
+package chaincode
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+)
+
+// The interaction catalogue is stored on the ledger so that every endorsing peer checks
+// prescriptions against the same knowledge base. Medications are keyed by code, and each of
+// their names and aliases, lower-cased, points back to the code. An interaction is stored
+// once under its two codes in sorted order, so lookups work in either direction.
+const (
+	medicationObjectType     = "medication"
+	medicationNameObjectType = "medication~name"
+	interactionObjectType    = "interaction"
+
+	settingsObjectType      = "settings"
+	interactionSettingsName = "interactions"
+
+	// maxCatalogueImportSize bounds the entries one import transaction writes.
+	maxCatalogueImportSize = 1000
+)
+
+// interactionCSVHeader is the header row of an interactions CSV import.
+var interactionCSVHeader = []string{"medication_a", "name_a", "medication_b", "name_b", "severity", "evidence"}
+
+// InteractionSeverity grades how serious an interaction is.
+type InteractionSeverity string
+
+const (
+	SeverityContraindicated InteractionSeverity = "contraindicated"
+	SeverityMajor           InteractionSeverity = "major"
+	SeverityModerate        InteractionSeverity = "moderate"
+	SeverityMinor           InteractionSeverity = "minor"
+)
+
+func parseSeverity(severity string) (InteractionSeverity, error) {
+	switch s := InteractionSeverity(strings.ToLower(strings.TrimSpace(severity))); s {
+	case SeverityContraindicated, SeverityMajor, SeverityModerate, SeverityMinor:
+		return s, nil
+	}
+	return "", fmt.Errorf("invalid severity '%s': expected contraindicated, major, moderate or minor", severity)
+}
+
+// CatalogueMedication is a medication known to the interaction catalogue, and an entry of
+// the code table. System is inferred from the code's format when it is not given.
+type CatalogueMedication struct {
+	System  string   `json:"System,omitempty"`
+	Code    string   `json:"Code"`
+	Name    string   `json:"Name"`
+	Aliases []string `json:"Aliases,omitempty"`
+}
+
+// Interaction is a known interaction between two medications, identified by code.
+type Interaction struct {
+	MedicationA string              `json:"MedicationA"`
+	MedicationB string              `json:"MedicationB"`
+	Severity    InteractionSeverity `json:"Severity"`
+	Evidence    string              `json:"Evidence,omitempty"`
+}
+
+// InteractionCatalogue is the bulk import format of the catalogue.
+type InteractionCatalogue struct {
+	Medications  []CatalogueMedication `json:"Medications"`
+	Interactions []Interaction         `json:"Interactions"`
+}
+
+// CatalogueImportReport counts the entries written by an import.
+type CatalogueImportReport struct {
+	Medications  int `json:"Medications"`
+	Interactions int `json:"Interactions"`
+}
+
+// InteractionSettings controls whether CreateAsset checks new prescriptions against the
+// catalogue.
+type InteractionSettings struct {
+	Enforce   bool   `json:"Enforce"`
+	UpdatedBy string `json:"UpdatedBy,omitempty"`
+	UpdatedAt string `json:"UpdatedAt,omitempty"`
+}
+
+// InteractionFinding reports an interaction between a medication being checked and another
+// of the patient's current medications. PrescriptionId names the other prescription, and is
+// empty when it is being created in the same request.
+type InteractionFinding struct {
+	Medication        string              `json:"Medication"`
+	MedicationCode    string              `json:"MedicationCode"`
+	InteractsWith     string              `json:"InteractsWith"`
+	InteractsWithCode string              `json:"InteractsWithCode"`
+	PrescriptionId    string              `json:"PrescriptionId,omitempty"`
+	Severity          InteractionSeverity `json:"Severity"`
+	Evidence          string              `json:"Evidence,omitempty"`
+}
+
+// normalizeMedicationName returns the form under which a medication name is looked up.
+func normalizeMedicationName(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
+
+// ImportInteractionCatalogue - adds medications and interactions given as an
+// InteractionCatalogue JSON document to the catalogue, updating entries that already exist.
+func (s *SmartContract) ImportInteractionCatalogue(ctx contractapi.TransactionContextInterface, catalogueJSON string) (*CatalogueImportReport, error) {
+	if _, err := s.authorize(ctx, "ImportInteractionCatalogue"); err != nil {
+		return nil, err
+	}
+
+	var catalogue InteractionCatalogue
+	if err := json.Unmarshal([]byte(catalogueJSON), &catalogue); err != nil {
+		return nil, fmt.Errorf("failed to parse interaction catalogue JSON: %v", err)
+	}
+	return importCatalogue(ctx, &catalogue)
+}
+
+// ImportInteractionsCSV - adds interactions given as CSV to the catalogue. The header row is
+// medication_a,name_a,medication_b,name_b,severity,evidence. A code with a name is added to
+// the catalogue as a medication; a code without one must already be known.
+func (s *SmartContract) ImportInteractionsCSV(ctx contractapi.TransactionContextInterface, csvData string) (*CatalogueImportReport, error) {
+	if _, err := s.authorize(ctx, "ImportInteractionsCSV"); err != nil {
+		return nil, err
+	}
+
+	catalogue, err := parseInteractionsCSV(strings.NewReader(csvData))
+	if err != nil {
+		return nil, err
+	}
+	return importCatalogue(ctx, catalogue)
+}
+
+// parseInteractionsCSV converts CSV rows into a catalogue.
+func parseInteractionsCSV(r io.Reader) (*InteractionCatalogue, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = len(interactionCSVHeader)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read interactions CSV header: %v", err)
+	}
+	for i, column := range interactionCSVHeader {
+		if strings.ToLower(strings.TrimSpace(header[i])) != column {
+			return nil, fmt.Errorf("interactions CSV header must be %s", strings.Join(interactionCSVHeader, ","))
+		}
+	}
+
+	catalogue := &InteractionCatalogue{}
+	named := map[string]bool{}
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read interactions CSV: %v", err)
+		}
+
+		for _, medication := range [][2]string{{row[0], row[1]}, {row[2], row[3]}} {
+			code, name := strings.TrimSpace(medication[0]), strings.TrimSpace(medication[1])
+			if name != "" && !named[code] {
+				named[code] = true
+				catalogue.Medications = append(catalogue.Medications, CatalogueMedication{Code: code, Name: name})
+			}
+		}
+		catalogue.Interactions = append(catalogue.Interactions, Interaction{
+			MedicationA: strings.TrimSpace(row[0]),
+			MedicationB: strings.TrimSpace(row[2]),
+			Severity:    InteractionSeverity(row[4]),
+			Evidence:    strings.TrimSpace(row[5]),
+		})
+	}
+	return catalogue, nil
+}
+
+// importCatalogue validates the catalogue as a whole and then writes it, so that an invalid
+// entry leaves the ledger unchanged.
+func importCatalogue(ctx contractapi.TransactionContextInterface, catalogue *InteractionCatalogue) (*CatalogueImportReport, error) {
+	if len(catalogue.Medications)+len(catalogue.Interactions) == 0 {
+		return nil, fmt.Errorf("the catalogue has no medications or interactions")
+	}
+	if len(catalogue.Medications)+len(catalogue.Interactions) > maxCatalogueImportSize {
+		return nil, fmt.Errorf("an import may hold at most %d entries", maxCatalogueImportSize)
+	}
+
+	imported := map[string]bool{}
+	for i := range catalogue.Medications {
+		medication := &catalogue.Medications[i]
+		if strings.TrimSpace(medication.Code) == "" || strings.TrimSpace(medication.Name) == "" {
+			return nil, fmt.Errorf("catalogue medications require a code and a name")
+		}
+		system, err := normalizeCodeSystem(medication.System, medication.Code)
+		if err != nil {
+			return nil, err
+		}
+		medication.System = system
+		if imported[medication.Code] {
+			return nil, fmt.Errorf("medication %s appears more than once", medication.Code)
+		}
+		imported[medication.Code] = true
+	}
+	for i := range catalogue.Interactions {
+		interaction := &catalogue.Interactions[i]
+		if interaction.MedicationA == "" || interaction.MedicationB == "" {
+			return nil, fmt.Errorf("interactions require two medication codes")
+		}
+		if interaction.MedicationA == interaction.MedicationB {
+			return nil, fmt.Errorf("medication %s cannot interact with itself", interaction.MedicationA)
+		}
+		severity, err := parseSeverity(string(interaction.Severity))
+		if err != nil {
+			return nil, err
+		}
+		interaction.Severity = severity
+		for _, code := range []string{interaction.MedicationA, interaction.MedicationB} {
+			if imported[code] {
+				continue
+			}
+			known, err := readCatalogueMedication(ctx, code)
+			if err != nil {
+				return nil, err
+			}
+			if known == nil {
+				return nil, fmt.Errorf("medication %s is not in the catalogue", code)
+			}
+			imported[code] = true
+		}
+	}
+
+	for _, medication := range catalogue.Medications {
+		if err := putCatalogueMedication(ctx, medication); err != nil {
+			return nil, err
+		}
+	}
+	for _, interaction := range catalogue.Interactions {
+		if err := putInteraction(ctx, interaction); err != nil {
+			return nil, err
+		}
+	}
+	return &CatalogueImportReport{Medications: len(catalogue.Medications), Interactions: len(catalogue.Interactions)}, nil
+}
+
+func readCatalogueMedication(ctx contractapi.TransactionContextInterface, code string) (*CatalogueMedication, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(medicationObjectType, []string{code})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create medication key: %v", err)
+	}
+	medicationJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read medication %s: %v", code, err)
+	}
+	if medicationJSON == nil {
+		return nil, nil
+	}
+
+	var medication CatalogueMedication
+	if err := json.Unmarshal(medicationJSON, &medication); err != nil {
+		return nil, err
+	}
+	return &medication, nil
+}
+
+// putCatalogueMedication stores a medication and its name lookups. A medication that is
+// already known keeps its aliases, and its previous name becomes one of them.
+func putCatalogueMedication(ctx contractapi.TransactionContextInterface, medication CatalogueMedication) error {
+	existing, err := readCatalogueMedication(ctx, medication.Code)
+	if err != nil {
+		return err
+	}
+
+	aliases := map[string]bool{}
+	for _, alias := range medication.Aliases {
+		aliases[strings.TrimSpace(alias)] = true
+	}
+	if existing != nil {
+		for _, alias := range append(existing.Aliases, existing.Name) {
+			aliases[alias] = true
+		}
+	}
+	delete(aliases, medication.Name)
+	delete(aliases, "")
+	medication.Aliases = make([]string, 0, len(aliases))
+	for alias := range aliases {
+		medication.Aliases = append(medication.Aliases, alias)
+	}
+	sort.Strings(medication.Aliases)
+
+	key, err := ctx.GetStub().CreateCompositeKey(medicationObjectType, []string{medication.Code})
+	if err != nil {
+		return fmt.Errorf("failed to create medication key: %v", err)
+	}
+	medicationJSON, err := json.Marshal(medication)
+	if err != nil {
+		return err
+	}
+	if err := ctx.GetStub().PutState(key, medicationJSON); err != nil {
+		return err
+	}
+
+	for _, name := range append([]string{medication.Name}, medication.Aliases...) {
+		nameKey, err := ctx.GetStub().CreateCompositeKey(medicationNameObjectType, []string{normalizeMedicationName(name)})
+		if err != nil {
+			return fmt.Errorf("failed to create medication name key: %v", err)
+		}
+		if err := ctx.GetStub().PutState(nameKey, []byte(medication.Code)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// interactionKey returns the key of the interaction between two codes, in either order.
+func interactionKey(ctx contractapi.TransactionContextInterface, codeA string, codeB string) (string, error) {
+	if codeB < codeA {
+		codeA, codeB = codeB, codeA
+	}
+	key, err := ctx.GetStub().CreateCompositeKey(interactionObjectType, []string{codeA, codeB})
+	if err != nil {
+		return "", fmt.Errorf("failed to create interaction key: %v", err)
+	}
+	return key, nil
+}
+
+func putInteraction(ctx contractapi.TransactionContextInterface, interaction Interaction) error {
+	if interaction.MedicationB < interaction.MedicationA {
+		interaction.MedicationA, interaction.MedicationB = interaction.MedicationB, interaction.MedicationA
+	}
+	key, err := interactionKey(ctx, interaction.MedicationA, interaction.MedicationB)
+	if err != nil {
+		return err
+	}
+	interactionJSON, err := json.Marshal(interaction)
+	if err != nil {
+		return err
+	}
+	return ctx.GetStub().PutState(key, interactionJSON)
+}
+
+func readInteraction(ctx contractapi.TransactionContextInterface, codeA string, codeB string) (*Interaction, error) {
+	key, err := interactionKey(ctx, codeA, codeB)
+	if err != nil {
+		return nil, err
+	}
+	interactionJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read interaction: %v", err)
+	}
+	if interactionJSON == nil {
+		return nil, nil
+	}
+
+	var interaction Interaction
+	if err := json.Unmarshal(interactionJSON, &interaction); err != nil {
+		return nil, err
+	}
+	return &interaction, nil
+}
+
+// medicationCodes resolves medication names, or codes, to catalogue codes, caching the
+// lookups of one transaction. Names the catalogue does not know resolve to "".
+type medicationCodes struct {
+	ctx   contractapi.TransactionContextInterface
+	codes map[string]string
+}
+
+func newMedicationCodes(ctx contractapi.TransactionContextInterface) *medicationCodes {
+	return &medicationCodes{ctx: ctx, codes: map[string]string{}}
+}
+
+func (m *medicationCodes) resolve(name string) (string, error) {
+	normalized := normalizeMedicationName(name)
+	if code, ok := m.codes[normalized]; ok {
+		return code, nil
+	}
+
+	code := ""
+	key, err := m.ctx.GetStub().CreateCompositeKey(medicationNameObjectType, []string{normalized})
+	if err != nil {
+		return "", fmt.Errorf("failed to create medication name key: %v", err)
+	}
+	codeBytes, err := m.ctx.GetStub().GetState(key)
+	if err != nil {
+		return "", fmt.Errorf("failed to read medication name: %v", err)
+	}
+	if codeBytes != nil {
+		code = string(codeBytes)
+	} else {
+		medication, err := readCatalogueMedication(m.ctx, strings.TrimSpace(name))
+		if err != nil {
+			return "", err
+		}
+		if medication != nil {
+			code = medication.Code
+		}
+	}
+
+	m.codes[normalized] = code
+	return code, nil
+}
+
+// forPrescription returns the catalogue code of a prescription's medication: its coded
+// medication if it has one, and otherwise the code its free-text name resolves to.
+func (m *medicationCodes) forPrescription(prescription *Prescription) (string, error) {
+	if prescription.Medication != nil {
+		return prescription.Medication.Code, nil
+	}
+	return m.resolve(prescription.MedicationName)
+}
+
+// isCurrentMedication reports whether a prescription's medication is still being taken or
+// can still be dispensed, and so counts when checking for interactions.
+func isCurrentMedication(prescription *Prescription) bool {
+	switch prescription.Status {
+	case StatusActive, StatusOnHold, StatusPartiallyDispensed:
+		return true
+	}
+	return false
+}
+
+// findInteractions checks the medication of subject against each of the current
+// prescriptions.
+func findInteractions(codes *medicationCodes, subject *Prescription, current []Prescription) ([]InteractionFinding, error) {
+	code, err := codes.forPrescription(subject)
+	if err != nil || code == "" {
+		return nil, err
+	}
+
+	findings := []InteractionFinding{}
+	for _, prescription := range current {
+		if !isCurrentMedication(&prescription) {
+			continue
+		}
+		otherCode, err := codes.forPrescription(&prescription)
+		if err != nil {
+			return nil, err
+		}
+		if otherCode == "" || otherCode == code {
+			continue
+		}
+		interaction, err := readInteraction(codes.ctx, code, otherCode)
+		if err != nil {
+			return nil, err
+		}
+		if interaction == nil {
+			continue
+		}
+		findings = append(findings, InteractionFinding{
+			Medication:        firstNonEmpty(subject.MedicationName, subject.medicationLabel()),
+			MedicationCode:    code,
+			InteractsWith:     firstNonEmpty(prescription.MedicationName, prescription.medicationLabel()),
+			InteractsWithCode: otherCode,
+			PrescriptionId:    prescription.PrescriptionId,
+			Severity:          interaction.Severity,
+			Evidence:          interaction.Evidence,
+		})
+	}
+	return findings, nil
+}
+
+// screenNewPrescriptions checks prescriptions about to be created for a patient against the
+// patient's current prescriptions and against each other, when the interaction settings ask
+// for it. A contraindicated interaction is an error; other interactions are returned as
+// warnings.
+func screenNewPrescriptions(ctx contractapi.TransactionContextInterface, patientId string, prescriptions []Prescription) ([]InteractionFinding, error) {
+	settings, err := readInteractionSettings(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !settings.Enforce {
+		return nil, nil
+	}
+
+	current := []Prescription{}
+	if patient, err := readPatient(ctx, patientId); err == nil {
+		asset, err := aggregateAsset(ctx, patient)
+		if err != nil {
+			return nil, err
+		}
+		current = asset.Prescriptions
+	}
+
+	codes := newMedicationCodes(ctx)
+	warnings := []InteractionFinding{}
+	for i, prescription := range prescriptions {
+		others := []Prescription{}
+		for _, other := range current {
+			// A prescription changing its medication is not screened against its old version.
+			if prescription.PrescriptionId == "" || other.PrescriptionId != prescription.PrescriptionId {
+				others = append(others, other)
+			}
+		}
+		for _, earlier := range prescriptions[:i] {
+			earlier.PrescriptionId = ""
+			earlier.Status = StatusActive
+			others = append(others, earlier)
+		}
+
+		findings, err := findInteractions(codes, &prescription, others)
+		if err != nil {
+			return nil, err
+		}
+		for _, finding := range findings {
+			if finding.Severity == SeverityContraindicated {
+				return nil, fmt.Errorf("%s is contraindicated with %s: %s", finding.Medication, finding.InteractsWith, finding.Evidence)
+			}
+			warnings = append(warnings, finding)
+		}
+	}
+	return warnings, nil
+}
+
+// SetInteractionSettings - stores the interaction settings, such as whether CreateAsset
+// enforces the catalogue.
+func (s *SmartContract) SetInteractionSettings(ctx contractapi.TransactionContextInterface, settingsJSON string) error {
+	admin, err := s.authorize(ctx, "SetInteractionSettings")
+	if err != nil {
+		return err
+	}
+
+	var settings InteractionSettings
+	if err := json.Unmarshal([]byte(settingsJSON), &settings); err != nil {
+		return fmt.Errorf("failed to parse interaction settings JSON: %v", err)
+	}
+
+	clock, err := newTxClock(ctx)
+	if err != nil {
+		return err
+	}
+	settings.UpdatedBy = admin.EnrollmentID
+	settings.UpdatedAt = clock.Timestamp()
+
+	key, err := ctx.GetStub().CreateCompositeKey(settingsObjectType, []string{interactionSettingsName})
+	if err != nil {
+		return fmt.Errorf("failed to create settings key: %v", err)
+	}
+	settingsJSONBytes, err := json.Marshal(settings)
+	if err != nil {
+		return err
+	}
+	return ctx.GetStub().PutState(key, settingsJSONBytes)
+}
+
+// GetInteractionSettings - returns the interaction settings.
+func (s *SmartContract) GetInteractionSettings(ctx contractapi.TransactionContextInterface) (*InteractionSettings, error) {
+	if _, err := s.authorize(ctx, "GetInteractionSettings"); err != nil {
+		return nil, err
+	}
+	return readInteractionSettings(ctx)
+}
+
+// readInteractionSettings returns the stored settings, or the defaults, which do not
+// enforce the catalogue.
+func readInteractionSettings(ctx contractapi.TransactionContextInterface) (*InteractionSettings, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(settingsObjectType, []string{interactionSettingsName})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create settings key: %v", err)
+	}
+	settingsJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read interaction settings: %v", err)
+	}
+
+	settings := &InteractionSettings{}
+	if settingsJSON == nil {
+		return settings, nil
+	}
+	if err := json.Unmarshal(settingsJSON, settings); err != nil {
+		return nil, fmt.Errorf("failed to parse stored interaction settings: %v", err)
+	}
+	return settings, nil
+}
@@ -0,0 +1,152 @@
+package chaincode_test
+
+import (
+	"testing"
+
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode"
+	"github.com/stretchr/testify/require"
+)
+
+const testCatalogue = `{
+	"Medications": [
+		{"Code": "1191", "Name": "Aspirin", "Aliases": ["Acetylsalicylic acid"]},
+		{"Code": "11289", "Name": "Warfarin"},
+		{"Code": "723", "Name": "Amoxicillin"},
+		{"Code": "6851", "Name": "Methotrexate"}
+	],
+	"Interactions": [
+		{"MedicationA": "11289", "MedicationB": "1191", "Severity": "Major", "Evidence": "Increased bleeding risk"},
+		{"MedicationA": "723", "MedicationB": "6851", "Severity": "contraindicated", "Evidence": "Reduced methotrexate clearance"}
+	]
+}`
+
+// withCatalogue imports testCatalogue into state.
+func withCatalogue(t *testing.T, state ledger) {
+	t.Helper()
+	smartContract := chaincode.SmartContract{}
+	transactionContext, _ := newEndorsement(state, testTxTime, adminIdentity("Org1MSP", "org1admin"))
+	report, err := smartContract.ImportInteractionCatalogue(transactionContext, testCatalogue)
+	require.NoError(t, err)
+	require.Equal(t, &chaincode.CatalogueImportReport{Medications: 4, Interactions: 2}, report)
+}
+
+func TestInteractionLookupIsSymmetric(t *testing.T) {
+	smartContract := chaincode.SmartContract{}
+	asset := activePatientAsset()
+	asset.Prescriptions[0].MedicationName = "Warfarin"
+	state := patientState(t, asset)
+	withCatalogue(t, state)
+
+	transactionContext, _ := newEndorsement(state, testTxTime, doctorIdentity("doctor1"))
+	findings, err := smartContract.CheckMedicationInteractions(transactionContext, "patient1", "acetylsalicylic acid")
+	require.NoError(t, err)
+	require.Equal(t, []chaincode.InteractionFinding{{
+		Medication:        "acetylsalicylic acid",
+		MedicationCode:    "1191",
+		InteractsWith:     "Warfarin",
+		InteractsWithCode: "11289",
+		PrescriptionId:    "rx1",
+		Severity:          chaincode.SeverityMajor,
+		Evidence:          "Increased bleeding risk",
+	}}, findings)
+
+	asset.Prescriptions[0].MedicationName = "Aspirin"
+	state = patientState(t, asset)
+	withCatalogue(t, state)
+	transactionContext, _ = newEndorsement(state, testTxTime, doctorIdentity("doctor1"))
+	findings, err = smartContract.CheckMedicationInteractions(transactionContext, "patient1", "Warfarin")
+	require.NoError(t, err)
+	require.Len(t, findings, 1)
+	require.Equal(t, "Aspirin", findings[0].InteractsWith)
+
+	// Medications the catalogue does not know have no findings.
+	transactionContext, _ = newEndorsement(state, testTxTime, doctorIdentity("doctor1"))
+	findings, err = smartContract.CheckMedicationInteractions(transactionContext, "patient1", "Paracetamol")
+	require.NoError(t, err)
+	require.Empty(t, findings)
+}
+
+func TestImportInteractionsCSV(t *testing.T) {
+	smartContract := chaincode.SmartContract{}
+	state := ledger{}
+	withCatalogue(t, state)
+
+	transactionContext, _ := newEndorsement(state, testTxTime, adminIdentity("Org1MSP", "org1admin"))
+	report, err := smartContract.ImportInteractionsCSV(transactionContext, "medication_a,name_a,medication_b,name_b,severity,evidence\n"+
+		"5640,Ibuprofen,11289,,major,\"Bleeding risk, GI\"\n"+
+		"5640,,1191,,moderate,Reduced antiplatelet effect\n")
+	require.NoError(t, err)
+	require.Equal(t, &chaincode.CatalogueImportReport{Medications: 1, Interactions: 2}, report)
+
+	tests := []struct {
+		name string
+		csv  string
+		err  string
+	}{
+		{
+			name: "unknown code",
+			csv:  "medication_a,name_a,medication_b,name_b,severity,evidence\n9999,,1191,,minor,\n",
+			err:  "medication 9999 is not in the catalogue",
+		},
+		{
+			name: "severity",
+			csv:  "medication_a,name_a,medication_b,name_b,severity,evidence\n5640,,1191,,severe,\n",
+			err:  "invalid severity 'severe': expected contraindicated, major, moderate or minor",
+		},
+		{
+			name: "header",
+			csv:  "a,b,c,d,e,f\n",
+			err:  "interactions CSV header must be medication_a,name_a,medication_b,name_b,severity,evidence",
+		},
+		{
+			name: "self",
+			csv:  "medication_a,name_a,medication_b,name_b,severity,evidence\n1191,,1191,,minor,\n",
+			err:  "medication 1191 cannot interact with itself",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transactionContext, chaincodeStub := newEndorsement(state.clone(), testTxTime, adminIdentity("Org1MSP", "org1admin"))
+			_, err := smartContract.ImportInteractionsCSV(transactionContext, tt.csv)
+			require.EqualError(t, err, tt.err)
+			require.Zero(t, chaincodeStub.PutStateCallCount())
+		})
+	}
+
+	transactionContext, _ = newEndorsement(state, testTxTime, doctorIdentity("doctor1"))
+	_, err = smartContract.ImportInteractionCatalogue(transactionContext, testCatalogue)
+	require.EqualError(t, err, "caller doctor1 with role 'doctor' is not permitted to call ImportInteractionCatalogue")
+}
+
+func TestCreateAssetEnforcesInteractionCatalogue(t *testing.T) {
+	smartContract := chaincode.SmartContract{}
+	state := activePatient(t)
+	withCatalogue(t, state)
+
+	create := func(state ledger, assetJSON string, diagnoses string) (*chaincode.CreateAssetResult, error) {
+		transactionContext, _ := newEndorsement(state, testTxTime, doctorIdentity("doctor1"))
+		withPHI(transactionContext, `{"Salt":"0123456789abcdef","Diagnoses":`+diagnoses+`}`)
+		return smartContract.CreateAsset(transactionContext, assetJSON)
+	}
+	methotrexate := `{"PatientId":"patient1","Prescriptions":[{"MedicationName":"Methotrexate"}]}`
+
+	// The catalogue is not enforced until the settings say so.
+	_, err := create(state.clone(), methotrexate, `["Arthritis"]`)
+	require.NoError(t, err)
+
+	transactionContext, _ := newEndorsement(state, testTxTime, adminIdentity("Org1MSP", "org1admin"))
+	require.NoError(t, smartContract.SetInteractionSettings(transactionContext, `{"Enforce":true}`))
+
+	_, err = create(state.clone(), methotrexate, `["Arthritis"]`)
+	require.EqualError(t, err, "Methotrexate is contraindicated with Amoxicillin: Reduced methotrexate clearance")
+
+	// Interactions between prescriptions in the same request are warnings.
+	result, err := create(state, `{"PatientId":"patient1","Prescriptions":[{"MedicationName":"Warfarin"},{"MedicationName":"Aspirin"}]}`, `["AF","Pain"]`)
+	require.NoError(t, err)
+	require.Len(t, result.PrescriptionIds, 2)
+	require.Len(t, result.InteractionWarnings, 1)
+	require.Equal(t, "Aspirin", result.InteractionWarnings[0].Medication)
+	require.Equal(t, "Warfarin", result.InteractionWarnings[0].InteractsWith)
+	require.Empty(t, result.InteractionWarnings[0].PrescriptionId)
+	require.Equal(t, chaincode.SeverityMajor, result.InteractionWarnings[0].Severity)
+}
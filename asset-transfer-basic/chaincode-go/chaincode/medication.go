@@ -0,0 +1,148 @@
+package chaincode
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+)
+
+// Prescriptions may name their medication by a code from RxNorm or the WHO ATC
+// classification, and give the dose as structured fields. The code table is the medication
+// table of the interaction catalogue: a coded prescription must use a code it holds. The two
+// code systems have disjoint formats, so a code identifies its system. Prescriptions written
+// before coding keep only the free-text MedicationName and Dosage, which remain readable.
+const (
+	CodeSystemRxNorm = "RxNorm"
+	CodeSystemATC    = "ATC"
+)
+
+var (
+	rxNormCodePattern = regexp.MustCompile(`^[0-9]{1,8}$`)
+	atcCodePattern    = regexp.MustCompile(`^[A-Z][0-9]{2}([A-Z]([A-Z]([0-9]{2})?)?)?$`)
+)
+
+// CodedMedication identifies a medication by code.
+type CodedMedication struct {
+	System  string `json:"System"`
+	Code    string `json:"Code"`
+	Display string `json:"Display"`
+}
+
+// Dose is a structured dose. Amount and Unit are required; the rest is optional.
+type Dose struct {
+	Amount    float64 `json:"Amount"`
+	Unit      string  `json:"Unit"`
+	Route     string  `json:"Route,omitempty"`
+	Frequency string  `json:"Frequency,omitempty"`
+	Duration  string  `json:"Duration,omitempty"`
+}
+
+// inferCodeSystem returns the code system whose format the code has.
+func inferCodeSystem(code string) (string, error) {
+	switch {
+	case rxNormCodePattern.MatchString(code):
+		return CodeSystemRxNorm, nil
+	case atcCodePattern.MatchString(code):
+		return CodeSystemATC, nil
+	}
+	return "", fmt.Errorf("medication code '%s' is neither an RxNorm nor an ATC code", code)
+}
+
+// normalizeCodeSystem checks a code against its system, inferring the system when it is not
+// given, and returns the system.
+func normalizeCodeSystem(system string, code string) (string, error) {
+	inferred, err := inferCodeSystem(code)
+	if err != nil {
+		return "", err
+	}
+	if system != "" && !strings.EqualFold(system, inferred) {
+		return "", fmt.Errorf("medication code '%s' is not a valid %s code", code, system)
+	}
+	return inferred, nil
+}
+
+func (d *Dose) validate() error {
+	if d.Amount <= 0 {
+		return fmt.Errorf("dose amount must be positive")
+	}
+	if strings.TrimSpace(d.Unit) == "" {
+		return fmt.Errorf("dose unit is required")
+	}
+	return nil
+}
+
+// String renders the dose as free text, such as "500 mg oral every 8 hours for 7 days".
+func (d *Dose) String() string {
+	parts := []string{strconv.FormatFloat(d.Amount, 'f', -1, 64) + " " + d.Unit}
+	if d.Route != "" {
+		parts = append(parts, d.Route)
+	}
+	if d.Frequency != "" {
+		parts = append(parts, d.Frequency)
+	}
+	if d.Duration != "" {
+		parts = append(parts, "for "+d.Duration)
+	}
+	return strings.Join(parts, " ")
+}
+
+// applyCoding validates a new prescription's coded medication against the code table and its
+// structured dose, and fills in the free-text fields from them when they are empty.
+func (prescription *Prescription) applyCoding(ctx contractapi.TransactionContextInterface) error {
+	if medication := prescription.Medication; medication != nil {
+		system, err := normalizeCodeSystem(medication.System, medication.Code)
+		if err != nil {
+			return err
+		}
+		entry, err := readCatalogueMedication(ctx, medication.Code)
+		if err != nil {
+			return err
+		}
+		if entry == nil {
+			return fmt.Errorf("medication code %s is not in the code table", medication.Code)
+		}
+		medication.System = system
+		medication.Display = entry.Name
+		if prescription.MedicationName == "" {
+			prescription.MedicationName = entry.Name
+		}
+	}
+
+	if dose := prescription.Dose; dose != nil {
+		if err := dose.validate(); err != nil {
+			return err
+		}
+		if prescription.Dosage == "" {
+			prescription.Dosage = dose.String()
+		}
+	}
+	return nil
+}
+
+// medicationLabel names the prescription's medication for grouping: the code table's name
+// when it is coded, and the free-text name otherwise.
+func (prescription *Prescription) medicationLabel() string {
+	if prescription.Medication != nil {
+		return prescription.Medication.Display
+	}
+	return prescription.MedicationName
+}
+
+// ReadMedicationCode - returns the code table entry for a medication code.
+func (s *SmartContract) ReadMedicationCode(ctx contractapi.TransactionContextInterface, code string) (*CatalogueMedication, error) {
+	if _, err := s.authorize(ctx, "ReadMedicationCode"); err != nil {
+		return nil, err
+	}
+
+	medication, err := readCatalogueMedication(ctx, code)
+	if err != nil {
+		return nil, err
+	}
+	if medication == nil {
+		return nil, fmt.Errorf("medication code %s is not in the code table", code)
+	}
+	return medication, nil
+}
@@ -0,0 +1,108 @@
+package chaincode_test
+
+import (
+	"testing"
+
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateAssetWithCodedMedication(t *testing.T) {
+	smartContract := chaincode.SmartContract{}
+	state := ledger{}
+	withCatalogue(t, state)
+
+	transactionContext, _ := newEndorsement(state, testTxTime, doctorIdentity("doctor1"))
+	withPHI(transactionContext, `{"PatientName":"Jane Banda","Salt":"0123456789abcdef","Diagnoses":["Angina"]}`)
+	result, err := smartContract.CreateAsset(transactionContext, `{"PatientId":"patient1","Prescriptions":[{
+		"MedicationName":"aspirin 81mg",
+		"Medication":{"Code":"1191"},
+		"Dose":{"Amount":81,"Unit":"mg","Route":"oral","Frequency":"once daily","Duration":"30 days"}}]}`)
+	require.NoError(t, err)
+
+	prescription := readPatient(t, state, "patient1").Prescriptions[0]
+	require.Equal(t, result.PrescriptionIds[0], prescription.PrescriptionId)
+	require.Equal(t, &chaincode.CodedMedication{System: "RxNorm", Code: "1191", Display: "Aspirin"}, prescription.Medication)
+	require.Equal(t, "aspirin 81mg", prescription.MedicationName)
+	require.Equal(t, "81 mg oral once daily for 30 days", prescription.Dosage)
+
+	// A coded medication cannot be renamed by amendment.
+	transactionContext, _ = newEndorsement(state, testTxTime, doctorIdentity("doctor1"))
+	err = smartContract.UpdatePrescription(transactionContext, "patient1", `{"PrescriptionId":"`+prescription.PrescriptionId+`","Reason":"Brand","Changes":{"MedicationName":"Disprin"}}`)
+	require.EqualError(t, err, "the medication of prescription "+prescription.PrescriptionId+" is coded and cannot be changed by name")
+}
+
+func TestCreateAssetValidatesCoding(t *testing.T) {
+	smartContract := chaincode.SmartContract{}
+	state := ledger{}
+	withCatalogue(t, state)
+
+	tests := []struct {
+		name         string
+		prescription string
+		err          string
+	}{
+		{name: "unknown code", prescription: `{"Medication":{"Code":"99999"}}`, err: "medication code 99999 is not in the code table"},
+		{name: "malformed code", prescription: `{"Medication":{"Code":"aspirin"}}`, err: "medication code 'aspirin' is neither an RxNorm nor an ATC code"},
+		{name: "wrong system", prescription: `{"Medication":{"System":"ATC","Code":"1191"}}`, err: "medication code '1191' is not a valid ATC code"},
+		{name: "dose amount", prescription: `{"MedicationName":"Aspirin","Dose":{"Amount":0,"Unit":"mg"}}`, err: "dose amount must be positive"},
+		{name: "dose unit", prescription: `{"MedicationName":"Aspirin","Dose":{"Amount":81}}`, err: "dose unit is required"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transactionContext, _ := newEndorsement(state.clone(), testTxTime, doctorIdentity("doctor1"))
+			withPHI(transactionContext, `{"PatientName":"Jane Banda","Salt":"0123456789abcdef","Diagnoses":["Angina"]}`)
+			_, err := smartContract.CreateAsset(transactionContext, `{"PatientId":"patient1","Prescriptions":[`+tt.prescription+`]}`)
+			require.EqualError(t, err, tt.err)
+		})
+	}
+}
+
+func TestCodeTableAcceptsATCCodes(t *testing.T) {
+	smartContract := chaincode.SmartContract{}
+	state := ledger{}
+
+	transactionContext, _ := newEndorsement(state, testTxTime, adminIdentity("Org1MSP", "org1admin"))
+	_, err := smartContract.ImportInteractionCatalogue(transactionContext, `{"Medications":[{"Code":"B01AC06","Name":"Acetylsalicylic acid"}]}`)
+	require.NoError(t, err)
+
+	transactionContext, _ = newEndorsement(state, testTxTime, pharmacistIdentity("pharmacist1"))
+	medication, err := smartContract.ReadMedicationCode(transactionContext, "B01AC06")
+	require.NoError(t, err)
+	require.Equal(t, "ATC", medication.System)
+
+	transactionContext, _ = newEndorsement(state, testTxTime, adminIdentity("Org1MSP", "org1admin"))
+	_, err = smartContract.ImportInteractionCatalogue(transactionContext, `{"Medications":[{"System":"RxNorm","Code":"B01AC06","Name":"Aspirin"}]}`)
+	require.EqualError(t, err, "medication code 'B01AC06' is not a valid RxNorm code")
+}
+
+func TestCodedAndLegacyMedicationsGroupTogether(t *testing.T) {
+	smartContract := chaincode.SmartContract{}
+	asset := activePatientAsset()
+	legacy := asset.Prescriptions[0]
+	legacy.MedicationName = "Warfarin"
+	coded := legacy
+	coded.PrescriptionId = "rx2"
+	coded.MedicationName = "warfarin 5mg tablets"
+	coded.Medication = &chaincode.CodedMedication{System: "RxNorm", Code: "11289", Display: "Warfarin"}
+	asset.Prescriptions = []chaincode.Prescription{legacy, coded}
+	state := patientState(t, asset)
+	withCatalogue(t, state)
+
+	transactionContext, _ := newEndorsement(state, testTxTime, doctorIdentity("doctor1"))
+	analytics, err := smartContract.GetPrescriptionAnalytics(transactionContext, "", "")
+	require.NoError(t, err)
+	require.Equal(t, map[string]int{"Warfarin": 2}, analytics.MedicationFrequency)
+
+	// The legacy free-text record reads back unchanged.
+	read := readPatient(t, state, "patient1").Prescriptions
+	require.Nil(t, read[0].Medication)
+	require.Equal(t, "Warfarin", read[0].MedicationName)
+
+	// Both are found by interaction checks, the coded one by its code.
+	transactionContext, _ = newEndorsement(state, testTxTime, doctorIdentity("doctor1"))
+	findings, err := smartContract.CheckMedicationInteractions(transactionContext, "patient1", "1191")
+	require.NoError(t, err)
+	require.Len(t, findings, 2)
+	require.Equal(t, "warfarin 5mg tablets", findings[1].InteractsWith)
+}
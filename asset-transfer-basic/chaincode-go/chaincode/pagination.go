@@ -0,0 +1,145 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric-chaincode-go/v2/shim"
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+)
+
+// maxPageSize bounds the number of records a paginated query reads in one call.
+const maxPageSize = 200
+
+// PrescriptionPage is one page of prescriptions. Bookmark is passed back to fetch the next
+// page and is empty after the last one.
+type PrescriptionPage struct {
+	Records             []*Prescription `json:"Records"`
+	FetchedRecordsCount int32           `json:"FetchedRecordsCount"`
+	Bookmark            string          `json:"Bookmark"`
+}
+
+// PrescriptionAnalyticsPage holds the analytics of the prescriptions in one page. Counts from
+// successive pages add up; latency statistics cover only the page.
+type PrescriptionAnalyticsPage struct {
+	Analytics           *PrescriptionAnalytics `json:"Analytics"`
+	FetchedRecordsCount int32                  `json:"FetchedRecordsCount"`
+	Bookmark            string                 `json:"Bookmark"`
+}
+
+func validatePageSize(pageSize int32) error {
+	if pageSize < 1 || pageSize > maxPageSize {
+		return fmt.Errorf("page size must be between 1 and %d", maxPageSize)
+	}
+	return nil
+}
+
+// readPrescriptions reads the prescriptions returned by a query iterator, keeping those that
+// match when match is set.
+func readPrescriptions(ctx contractapi.TransactionContextInterface, iterator shim.StateQueryIteratorInterface, match func(*Prescription) bool) ([]*Prescription, error) {
+	records := []*Prescription{}
+	for iterator.HasNext() {
+		queryResponse, err := iterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var prescription Prescription
+		if err := json.Unmarshal(queryResponse.Value, &prescription); err != nil {
+			return nil, err
+		}
+		if match != nil && !match(&prescription) {
+			continue
+		}
+		if err := mergePrescriptionPrivate(ctx, &prescription); err != nil {
+			return nil, err
+		}
+		records = append(records, &prescription)
+	}
+	return records, nil
+}
+
+// GetPrescriptionsByDoctorWithPagination - returns one page of the prescriptions created by the
+// specified doctor. Pass an empty bookmark for the first page and the returned bookmark for
+// the next.
+func (s *SmartContract) GetPrescriptionsByDoctorWithPagination(ctx contractapi.TransactionContextInterface, doctorId string, pageSize int32, bookmark string) (*PrescriptionPage, error) {
+	if _, err := s.authorize(ctx, "GetPrescriptionsByDoctorWithPagination"); err != nil {
+		return nil, err
+	}
+
+	return doctorQuery(doctorId).page(ctx, pageSize, bookmark)
+}
+
+// GetDispenseHistoryWithPagination - returns one page of the prescriptions dispensed by the
+// specified pharmacist, in whole or in part.
+func (s *SmartContract) GetDispenseHistoryWithPagination(ctx contractapi.TransactionContextInterface, pharmacistId string, pageSize int32, bookmark string) (*PrescriptionPage, error) {
+	if _, err := s.authorize(ctx, "GetDispenseHistoryWithPagination"); err != nil {
+		return nil, err
+	}
+
+	return pharmacistQuery(pharmacistId).page(ctx, pageSize, bookmark)
+}
+
+// QueryPrescriptionsByStatus - returns one page of the prescriptions of all patients that are
+// in the given status.
+func (s *SmartContract) QueryPrescriptionsByStatus(ctx contractapi.TransactionContextInterface, status string, pageSize int32, bookmark string) (*PrescriptionPage, error) {
+	if _, err := s.authorize(ctx, "QueryPrescriptionsByStatus"); err != nil {
+		return nil, err
+	}
+
+	prescriptionStatus, err := parseStatus(status)
+	if err != nil {
+		return nil, err
+	}
+	return statusQuery(prescriptionStatus).page(ctx, pageSize, bookmark)
+}
+
+// QueryPrescriptionsByExpiry - returns one page of the prescriptions of all patients that
+// expire between startDate and endDate inclusive, given as YYYY-MM-DD.
+func (s *SmartContract) QueryPrescriptionsByExpiry(ctx contractapi.TransactionContextInterface, startDate string, endDate string, pageSize int32, bookmark string) (*PrescriptionPage, error) {
+	if _, err := s.authorize(ctx, "QueryPrescriptionsByExpiry"); err != nil {
+		return nil, err
+	}
+
+	if _, err := parseDateRange(startDate, endDate); err != nil {
+		return nil, err
+	}
+	if startDate == "" || endDate == "" {
+		return nil, fmt.Errorf("startDate and endDate are required")
+	}
+	return expiryQuery(startDate, endDate).page(ctx, pageSize, bookmark)
+}
+
+// GetPrescriptionAnalyticsWithPagination - returns the analytics of one page of prescription
+// keys, for ledgers too large to summarise in a single call. The pages together count the same
+// prescriptions as GetPrescriptionAnalytics. Pass an empty bookmark for the first page and the
+// returned bookmark for the next.
+func (s *SmartContract) GetPrescriptionAnalyticsWithPagination(ctx contractapi.TransactionContextInterface, startDate string, endDate string, pageSize int32, bookmark string) (*PrescriptionAnalyticsPage, error) {
+	if _, err := s.authorize(ctx, "GetPrescriptionAnalyticsWithPagination"); err != nil {
+		return nil, err
+	}
+	if err := validatePageSize(pageSize); err != nil {
+		return nil, err
+	}
+
+	accumulator, err := newAnalyticsAccumulator(startDate, endDate)
+	if err != nil {
+		return nil, err
+	}
+
+	iterator, metadata, err := ctx.GetStub().GetStateByPartialCompositeKeyWithPagination(prescriptionObjectType, []string{}, pageSize, bookmark)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan prescriptions: %v", err)
+	}
+	defer iterator.Close()
+
+	if err := accumulator.addPrescriptions(ctx, iterator); err != nil {
+		return nil, err
+	}
+
+	return &PrescriptionAnalyticsPage{
+		Analytics:           accumulator.result(),
+		FetchedRecordsCount: metadata.GetFetchedRecordsCount(),
+		Bookmark:            metadata.GetBookmark(),
+	}, nil
+}
@@ -0,0 +1,132 @@
+package chaincode_test
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/hyperledger/fabric-chaincode-go/v2/shim"
+	"github.com/hyperledger/fabric-protos-go-apiv2/peer"
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode"
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode/mocks"
+	"github.com/stretchr/testify/require"
+)
+
+// withRichQueries answers rich queries from the prescriptions in state that satisfy match,
+// recording the query strings received.
+func withRichQueries(state ledger, chaincodeStub *mocks.ChaincodeStub, match func(chaincode.Prescription) bool) *[]string {
+	var queries []string
+	chaincodeStub.GetQueryResultWithPaginationCalls(func(query string, pageSize int32, bookmark string) (shim.StateQueryIteratorInterface, *peer.QueryResponseMetadata, error) {
+		queries = append(queries, query)
+		iterator, metadata := state.page(func(key string) bool {
+			var prescription chaincode.Prescription
+			return strings.HasPrefix(key, "\x00prescription\x00") &&
+				json.Unmarshal(state[key], &prescription) == nil && match(prescription)
+		}, pageSize, bookmark)
+		return iterator, metadata, nil
+	})
+	return &queries
+}
+
+func TestGetPrescriptionsByDoctorWithPagination(t *testing.T) {
+	smartContract := chaincode.SmartContract{}
+	state := analyticsState(t)
+	byDoctor1 := func(p chaincode.Prescription) bool { return p.CreatedBy == "doctor1" }
+
+	transactionContext, chaincodeStub := newEndorsement(state, testTxTime, doctorIdentity("doctor1"))
+	queries := withRichQueries(state, chaincodeStub, byDoctor1)
+	page, err := smartContract.GetPrescriptionsByDoctorWithPagination(transactionContext, "doctor1", 1, "")
+	require.NoError(t, err)
+	require.JSONEq(t, `{"selector":{"CreatedBy":"doctor1","PrescriptionId":{"$exists":true}},"use_index":["_design/indexDoctorDoc","indexDoctor"]}`, (*queries)[0])
+	require.Equal(t, int32(1), page.FetchedRecordsCount)
+	require.Len(t, page.Records, 1)
+	require.Equal(t, "rx1", page.Records[0].PrescriptionId)
+	require.Equal(t, "Otitis media", page.Records[0].Diagnosis)
+	require.NotEmpty(t, page.Bookmark)
+
+	transactionContext, chaincodeStub = newEndorsement(state, testTxTime, doctorIdentity("doctor1"))
+	withRichQueries(state, chaincodeStub, byDoctor1)
+	page, err = smartContract.GetPrescriptionsByDoctorWithPagination(transactionContext, "doctor1", 1, page.Bookmark)
+	require.NoError(t, err)
+	require.Equal(t, "rx2", page.Records[0].PrescriptionId)
+	require.Empty(t, page.Bookmark)
+
+	transactionContext, _ = newEndorsement(state, testTxTime, doctorIdentity("doctor1"))
+	_, err = smartContract.GetPrescriptionsByDoctorWithPagination(transactionContext, "doctor1", 0, "")
+	require.EqualError(t, err, "page size must be between 1 and 200")
+}
+
+func TestGetDispenseHistoryWithPagination(t *testing.T) {
+	smartContract := chaincode.SmartContract{}
+	state := analyticsState(t)
+
+	transactionContext, chaincodeStub := newEndorsement(state, testTxTime, pharmacistIdentity("pharmacist2"))
+	queries := withRichQueries(state, chaincodeStub, func(p chaincode.Prescription) bool {
+		for _, dispensation := range p.Dispensations {
+			if dispensation.PharmacistId == "pharmacist2" {
+				return true
+			}
+		}
+		return p.DispensingPharmacist == "pharmacist2"
+	})
+	page, err := smartContract.GetDispenseHistoryWithPagination(transactionContext, "pharmacist2", 10, "")
+	require.NoError(t, err)
+	require.JSONEq(t, `{"selector":{"PrescriptionId":{"$exists":true},"dispensingPharmacist":{"$gt":null},"$or":[{"dispensingPharmacist":"pharmacist2"},{"Dispensations":{"$elemMatch":{"PharmacistId":"pharmacist2"}}}]},"use_index":["_design/indexPharmacistDoc","indexPharmacist"]}`, (*queries)[0])
+	require.Equal(t, int32(2), page.FetchedRecordsCount)
+	require.Equal(t, "rx2", page.Records[0].PrescriptionId)
+	require.Equal(t, "rx4", page.Records[1].PrescriptionId)
+	require.Empty(t, page.Bookmark)
+}
+
+func TestGetPrescriptionAnalyticsWithPagination(t *testing.T) {
+	smartContract := chaincode.SmartContract{}
+	state := analyticsState(t)
+
+	transactionContext, _ := newEndorsement(state, testTxTime, doctorIdentity("doctor1"))
+	page, err := smartContract.GetPrescriptionAnalyticsWithPagination(transactionContext, "", "", 3, "")
+	require.NoError(t, err)
+	require.Equal(t, int32(3), page.FetchedRecordsCount)
+	bookmark, err := shim.CreateCompositeKey("prescription", []string{"patient2", "rx4"})
+	require.NoError(t, err)
+	require.Equal(t, bookmark, page.Bookmark)
+	require.Equal(t, 3, page.Analytics.TotalPrescriptions)
+
+	transactionContext, _ = newEndorsement(state, testTxTime, doctorIdentity("doctor1"))
+	page, err = smartContract.GetPrescriptionAnalyticsWithPagination(transactionContext, "", "", 3, page.Bookmark)
+	require.NoError(t, err)
+	require.Empty(t, page.Bookmark)
+	require.Equal(t, 1, page.Analytics.TotalPrescriptions)
+	require.Equal(t, map[string]int{"Salbutamol": 1}, page.Analytics.MedicationFrequency)
+}
+
+func TestPagedAnalyticsAddUpToGetPrescriptionAnalytics(t *testing.T) {
+	smartContract := chaincode.SmartContract{}
+	state := analyticsState(t)
+
+	transactionContext, _ := newEndorsement(state, testTxTime, doctorIdentity("doctor1"))
+	expected, err := smartContract.GetPrescriptionAnalytics(transactionContext, "2025-03-05", "")
+	require.NoError(t, err)
+
+	total := 0
+	byDoctor := map[string]int{}
+	byPharmacist := map[string]int{}
+	bookmark := ""
+	for {
+		transactionContext, _ := newEndorsement(state, testTxTime, doctorIdentity("doctor1"))
+		page, err := smartContract.GetPrescriptionAnalyticsWithPagination(transactionContext, "2025-03-05", "", 1, bookmark)
+		require.NoError(t, err)
+		total += page.Analytics.TotalPrescriptions
+		for doctorId, count := range page.Analytics.ByDoctor {
+			byDoctor[doctorId] += count
+		}
+		for pharmacistId, count := range page.Analytics.ByPharmacist {
+			byPharmacist[pharmacistId] += count
+		}
+		if bookmark = page.Bookmark; bookmark == "" {
+			break
+		}
+	}
+	require.Equal(t, expected.TotalPrescriptions, total)
+	require.Equal(t, expected.ByDoctor, byDoctor)
+	require.Equal(t, expected.ByPharmacist, byPharmacist)
+}
@@ -0,0 +1,497 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"github.com/hyperledger/fabric-chaincode-go/v2/pkg/cid"
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+)
+
+const (
+	roleAdmin = "admin"
+
+	// roleAttribute is the certificate attribute that carries the caller's role.
+	roleAttribute = "role"
+
+	// typeAttribute is set by Fabric CA to the identity type (client, peer, admin, ...).
+	typeAttribute = "hf.Type"
+
+	policyObjectType = "policy"
+	policyKeyName    = "access"
+
+	// allFunctions grants a role every contract function.
+	allFunctions = "*"
+)
+
+// RoleBinding maps identities from an MSP to a role. When Attribute is set, only
+// identities whose certificate carries that attribute with the given Value match.
+type RoleBinding struct {
+	MSPID     string `json:"MSPID"`
+	Attribute string `json:"Attribute,omitempty"`
+	Value     string `json:"Value,omitempty"`
+	Role      string `json:"Role"`
+}
+
+// RolePermission lists the contract functions a role may call, and the prescription fields
+// it may change through UpdatePrescription.
+type RolePermission struct {
+	Role            string   `json:"Role"`
+	Functions       []string `json:"Functions"`
+	UpdatableFields []string `json:"UpdatableFields,omitempty"`
+}
+
+// AccessPolicy is the ledger-stored authorization policy. Bindings are evaluated in
+// order and the first match determines the caller's role.
+type AccessPolicy struct {
+	Bindings    []RoleBinding    `json:"Bindings"`
+	Permissions []RolePermission `json:"Permissions"`
+	UpdatedBy   string           `json:"UpdatedBy,omitempty"`
+	UpdatedAt   string           `json:"UpdatedAt,omitempty"`
+}
+
+// policyAdminFunctions are the transactions that manage the access policy.
+var policyAdminFunctions = []string{
+	"GetAccessPolicy",
+	"SetAccessPolicy",
+	"SetRoleBinding",
+	"RemoveRoleBinding",
+	"SetRolePermissions",
+	"SetRoleUpdatableFields",
+}
+
+// adminFunctions are the transactions reserved for administrators.
+var adminFunctions = append([]string{
+	"MigrateAssets",
+	"SweepExpiredPrescriptions",
+	"ImportInteractionCatalogue",
+	"ImportInteractionsCSV",
+	"SetInteractionSettings",
+	"GetInteractionSettings",
+	"SetBatchSettings",
+	"GetBatchSettings",
+	"GetUserRole",
+}, policyAdminFunctions...)
+
+// defaultAccessPolicy is used until an administrator stores a policy on the ledger.
+// It grants doctors in Org1 and pharmacists in Org2 their existing operations, and
+// makes the organization admins policy administrators.
+func defaultAccessPolicy() *AccessPolicy {
+	return &AccessPolicy{
+		Bindings: []RoleBinding{
+			{MSPID: "Org1MSP", Attribute: roleAttribute, Value: roleDoctor, Role: roleDoctor},
+			{MSPID: "Org2MSP", Attribute: roleAttribute, Value: rolePharmacist, Role: rolePharmacist},
+			{MSPID: "Org1MSP", Attribute: typeAttribute, Value: roleAdmin, Role: roleAdmin},
+			{MSPID: "Org2MSP", Attribute: typeAttribute, Value: roleAdmin, Role: roleAdmin},
+		},
+		Permissions: []RolePermission{
+			{
+				Role: roleDoctor,
+				Functions: []string{
+					"CreateAsset",
+					"BatchCreatePrescriptions",
+					"ReadAsset",
+					"UpdatePrescription",
+					"RevokePrescriptionJSON",
+					"HoldPrescription",
+					"ReleasePrescription",
+					"GetAssetHistory",
+					"GetPrescriptionsByStatus",
+					"QueryPrescriptionsByStatus",
+					"QueryPrescriptionsByExpiry",
+					"GetPrescriptionsByPatient",
+					"GetPrescriptionsByDoctor",
+					"GetPrescriptionsByDoctorWithPagination",
+					"CheckPrescriptionExpiry",
+					"CheckMedicationInteractions",
+					"ReadMedicationCode",
+					"RecordAllergy",
+					"RemoveAllergy",
+					"GetPatientAllergies",
+					"GetPrescriptionAnalytics",
+					"GetPrescriptionAnalyticsWithPagination",
+					"GetUserRole",
+				},
+				UpdatableFields: updatableFields,
+			},
+			{
+				Role: rolePharmacist,
+				Functions: []string{
+					"ReadAsset",
+					"DispensePrescription",
+					"HoldPrescription",
+					"ReleasePrescription",
+					"GetAssetHistory",
+					"GetPrescriptionsByStatus",
+					"QueryPrescriptionsByStatus",
+					"QueryPrescriptionsByExpiry",
+					"GetDispenseHistory",
+					"GetDispenseHistoryWithPagination",
+					"CheckPrescriptionExpiry",
+					"CheckMedicationInteractions",
+					"ReadMedicationCode",
+					"GetPatientAllergies",
+					"GetPrescriptionAnalytics",
+					"GetPrescriptionAnalyticsWithPagination",
+					"GetUserRole",
+				},
+			},
+			{
+				Role:      roleAdmin,
+				Functions: adminFunctions,
+			},
+		},
+	}
+}
+
+// authorize is the guard run by every SmartContract transaction before it does any work.
+// It resolves the caller's role from the access policy and checks that the role may
+// call the named function.
+func (s *SmartContract) authorize(ctx contractapi.TransactionContextInterface, function string) (*caller, error) {
+	policy, err := readAccessPolicy(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := policy.identify(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if !policy.allows(c.Role, function) {
+		return nil, fmt.Errorf("caller %s with role '%s' is not permitted to call %s", c.EnrollmentID, c.Role, function)
+	}
+	return c, nil
+}
+
+// GetAccessPolicy returns the access policy currently in force.
+func (s *SmartContract) GetAccessPolicy(ctx contractapi.TransactionContextInterface) (*AccessPolicy, error) {
+	if _, err := s.authorize(ctx, "GetAccessPolicy"); err != nil {
+		return nil, err
+	}
+	return readAccessPolicy(ctx)
+}
+
+// SetAccessPolicy replaces the whole access policy.
+func (s *SmartContract) SetAccessPolicy(ctx contractapi.TransactionContextInterface, policyJSON string) error {
+	admin, err := s.authorize(ctx, "SetAccessPolicy")
+	if err != nil {
+		return err
+	}
+
+	var policy AccessPolicy
+	if err := json.Unmarshal([]byte(policyJSON), &policy); err != nil {
+		return fmt.Errorf("failed to parse access policy JSON: %v", err)
+	}
+
+	return writeAccessPolicy(ctx, admin, &policy)
+}
+
+// SetRoleBinding adds a role binding, replacing any binding for the same MSP and attribute value.
+func (s *SmartContract) SetRoleBinding(ctx contractapi.TransactionContextInterface, bindingJSON string) error {
+	admin, err := s.authorize(ctx, "SetRoleBinding")
+	if err != nil {
+		return err
+	}
+
+	var binding RoleBinding
+	if err := json.Unmarshal([]byte(bindingJSON), &binding); err != nil {
+		return fmt.Errorf("failed to parse role binding JSON: %v", err)
+	}
+
+	policy, err := readAccessPolicy(ctx)
+	if err != nil {
+		return err
+	}
+
+	replaced := false
+	for i := range policy.Bindings {
+		if policy.Bindings[i].sameSubject(binding) {
+			policy.Bindings[i] = binding
+			replaced = true
+			break
+		}
+	}
+	if !replaced {
+		policy.Bindings = append(policy.Bindings, binding)
+	}
+
+	return writeAccessPolicy(ctx, admin, policy)
+}
+
+// RemoveRoleBinding removes the binding for the given MSP and attribute value.
+func (s *SmartContract) RemoveRoleBinding(ctx contractapi.TransactionContextInterface, bindingJSON string) error {
+	admin, err := s.authorize(ctx, "RemoveRoleBinding")
+	if err != nil {
+		return err
+	}
+
+	var binding RoleBinding
+	if err := json.Unmarshal([]byte(bindingJSON), &binding); err != nil {
+		return fmt.Errorf("failed to parse role binding JSON: %v", err)
+	}
+
+	policy, err := readAccessPolicy(ctx)
+	if err != nil {
+		return err
+	}
+
+	bindings := []RoleBinding{}
+	for _, b := range policy.Bindings {
+		if !b.sameSubject(binding) {
+			bindings = append(bindings, b)
+		}
+	}
+	if len(bindings) == len(policy.Bindings) {
+		return fmt.Errorf("no role binding found for MSP %s", binding.MSPID)
+	}
+	policy.Bindings = bindings
+
+	return writeAccessPolicy(ctx, admin, policy)
+}
+
+// SetRolePermissions sets the contract functions a role may call, given as a JSON array of
+// function names. An empty array removes all permissions from the role. The fields the role
+// may update are kept.
+func (s *SmartContract) SetRolePermissions(ctx contractapi.TransactionContextInterface, role string, functionsJSON string) error {
+	admin, err := s.authorize(ctx, "SetRolePermissions")
+	if err != nil {
+		return err
+	}
+
+	var functions []string
+	if err := json.Unmarshal([]byte(functionsJSON), &functions); err != nil {
+		return fmt.Errorf("failed to parse functions JSON: %v", err)
+	}
+
+	policy, err := readAccessPolicy(ctx)
+	if err != nil {
+		return err
+	}
+
+	permissions := []RolePermission{}
+	var fields []string
+	for _, p := range policy.Permissions {
+		if p.Role != role {
+			permissions = append(permissions, p)
+		} else {
+			fields = p.UpdatableFields
+		}
+	}
+	if len(functions) > 0 {
+		permissions = append(permissions, RolePermission{Role: role, Functions: functions, UpdatableFields: fields})
+	}
+	policy.Permissions = permissions
+
+	return writeAccessPolicy(ctx, admin, policy)
+}
+
+// SetRoleUpdatableFields sets the prescription fields a role may change through
+// UpdatePrescription, given as a JSON array of field names. The role must already have
+// permissions.
+func (s *SmartContract) SetRoleUpdatableFields(ctx contractapi.TransactionContextInterface, role string, fieldsJSON string) error {
+	admin, err := s.authorize(ctx, "SetRoleUpdatableFields")
+	if err != nil {
+		return err
+	}
+
+	var fields []string
+	if err := json.Unmarshal([]byte(fieldsJSON), &fields); err != nil {
+		return fmt.Errorf("failed to parse fields JSON: %v", err)
+	}
+
+	policy, err := readAccessPolicy(ctx)
+	if err != nil {
+		return err
+	}
+
+	found := false
+	for i := range policy.Permissions {
+		if policy.Permissions[i].Role == role {
+			policy.Permissions[i].UpdatableFields = fields
+			found = true
+		}
+	}
+	if !found {
+		return fmt.Errorf("role '%s' has no permissions", role)
+	}
+
+	return writeAccessPolicy(ctx, admin, policy)
+}
+
+// readAccessPolicy loads the access policy from the ledger, or the default policy if none
+// has been stored yet.
+func readAccessPolicy(ctx contractapi.TransactionContextInterface) (*AccessPolicy, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(policyObjectType, []string{policyKeyName})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create policy key: %v", err)
+	}
+
+	policyJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read access policy: %v", err)
+	}
+	if policyJSON == nil {
+		return defaultAccessPolicy(), nil
+	}
+
+	var policy AccessPolicy
+	if err := json.Unmarshal(policyJSON, &policy); err != nil {
+		return nil, fmt.Errorf("failed to parse stored access policy: %v", err)
+	}
+	return &policy, nil
+}
+
+// writeAccessPolicy validates and stores the access policy.
+func writeAccessPolicy(ctx contractapi.TransactionContextInterface, admin *caller, policy *AccessPolicy) error {
+	if err := policy.validate(); err != nil {
+		return err
+	}
+
+	clock, err := newTxClock(ctx)
+	if err != nil {
+		return err
+	}
+	policy.UpdatedBy = admin.EnrollmentID
+	policy.UpdatedAt = clock.Timestamp()
+
+	key, err := ctx.GetStub().CreateCompositeKey(policyObjectType, []string{policyKeyName})
+	if err != nil {
+		return fmt.Errorf("failed to create policy key: %v", err)
+	}
+
+	policyJSON, err := json.Marshal(policy)
+	if err != nil {
+		return err
+	}
+	return ctx.GetStub().PutState(key, policyJSON)
+}
+
+// identify resolves the submitting identity and its role under this policy.
+func (p *AccessPolicy) identify(ctx contractapi.TransactionContextInterface) (*caller, error) {
+	mspID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get MSP ID: %v", err)
+	}
+
+	role, err := p.resolveRole(ctx.GetClientIdentity(), mspID)
+	if err != nil {
+		return nil, err
+	}
+
+	enrollmentID, err := getEnrollmentID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &caller{MSPID: mspID, Role: role, EnrollmentID: enrollmentID}, nil
+}
+
+// resolveRole returns the role of the first binding matching the identity.
+func (p *AccessPolicy) resolveRole(identity cid.ClientIdentity, mspID string) (string, error) {
+	for _, binding := range p.Bindings {
+		if binding.MSPID != mspID {
+			continue
+		}
+		if binding.Attribute == "" {
+			return binding.Role, nil
+		}
+
+		value, ok, err := identity.GetAttributeValue(binding.Attribute)
+		if err != nil {
+			return "", fmt.Errorf("failed to get %s attribute: %v", binding.Attribute, err)
+		}
+		if ok && value == binding.Value {
+			return binding.Role, nil
+		}
+	}
+
+	return "", fmt.Errorf("no role binding for identity in organization %s", mspID)
+}
+
+// allows reports whether the role may call the function.
+func (p *AccessPolicy) allows(role string, function string) bool {
+	for _, permission := range p.Permissions {
+		if permission.Role != role {
+			continue
+		}
+		for _, f := range permission.Functions {
+			if f == function || f == allFunctions {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// updatableFields returns the prescription fields the role may change.
+func (p *AccessPolicy) updatableFields(role string) map[string]bool {
+	fields := map[string]bool{}
+	for _, permission := range p.Permissions {
+		if permission.Role != role {
+			continue
+		}
+		for _, field := range permission.UpdatableFields {
+			fields[field] = true
+		}
+	}
+	return fields
+}
+
+// validate checks that the policy is well formed and that at least one binding still
+// grants a role able to manage the policy, so administrators cannot lock themselves out.
+func (p *AccessPolicy) validate() error {
+	for _, binding := range p.Bindings {
+		if binding.MSPID == "" || binding.Role == "" {
+			return fmt.Errorf("role bindings require an MSPID and a Role")
+		}
+		if binding.Attribute == "" && binding.Value != "" {
+			return fmt.Errorf("role binding for %s has a Value but no Attribute", binding.MSPID)
+		}
+	}
+
+	known := contractFunctions()
+	for _, permission := range p.Permissions {
+		if permission.Role == "" {
+			return fmt.Errorf("role permissions require a Role")
+		}
+		for _, f := range permission.Functions {
+			if f != allFunctions && !known[f] {
+				return fmt.Errorf("unknown contract function '%s' in permissions for role '%s'", f, permission.Role)
+			}
+		}
+		for _, field := range permission.UpdatableFields {
+			if !isUpdatableField(field) {
+				return fmt.Errorf("unknown updatable field '%s' for role '%s'", field, permission.Role)
+			}
+		}
+	}
+
+	for _, binding := range p.Bindings {
+		if p.allows(binding.Role, "SetAccessPolicy") {
+			return nil
+		}
+	}
+	return fmt.Errorf("access policy must bind at least one identity to a role permitted to call SetAccessPolicy")
+}
+
+// sameSubject reports whether two bindings select the same identities.
+func (b RoleBinding) sameSubject(other RoleBinding) bool {
+	return b.MSPID == other.MSPID && b.Attribute == other.Attribute && b.Value == other.Value
+}
+
+// contractFunctions returns the names of the transactions defined by SmartContract.
+func contractFunctions() map[string]bool {
+	base := reflect.TypeOf(&contractapi.Contract{})
+	contract := reflect.TypeOf(&SmartContract{})
+
+	functions := map[string]bool{}
+	for i := 0; i < contract.NumMethod(); i++ {
+		name := contract.Method(i).Name
+		if _, inherited := base.MethodByName(name); !inherited {
+			functions[name] = true
+		}
+	}
+	return functions
+}
@@ -0,0 +1,128 @@
+package chaincode_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDefaultPolicyResolvesOrganizationRoles(t *testing.T) {
+	smartContract := chaincode.SmartContract{}
+
+	transactionContext, _ := newEndorsement(ledger{}, testTxTime, doctorIdentity("doctor1"))
+	role, err := smartContract.GetUserRole(transactionContext)
+	require.NoError(t, err)
+	require.Equal(t, "doctor", role)
+
+	transactionContext, _ = newEndorsement(ledger{}, testTxTime, pharmacistIdentity("pharmacist1"))
+	role, err = smartContract.GetUserRole(transactionContext)
+	require.NoError(t, err)
+	require.Equal(t, "pharmacist", role)
+
+	transactionContext, _ = newEndorsement(ledger{}, testTxTime, adminIdentity("Org1MSP", "org1admin"))
+	role, err = smartContract.GetUserRole(transactionContext)
+	require.NoError(t, err)
+	require.Equal(t, "admin", role)
+
+	transactionContext, _ = newEndorsement(ledger{}, testTxTime, newIdentity("Org3MSP", "nurse1", map[string]string{"role": "nurse"}))
+	_, err = smartContract.GetUserRole(transactionContext)
+	require.EqualError(t, err, "no role binding for identity in organization Org3MSP")
+}
+
+func TestPolicyAdminCanOnboardNewRole(t *testing.T) {
+	smartContract := chaincode.SmartContract{}
+	state := ledger{}
+	nurse := newIdentity("Org3MSP", "nurse1", map[string]string{"role": "nurse"})
+
+	transactionContext, _ := newEndorsement(state, testTxTime, adminIdentity("Org1MSP", "org1admin"))
+	err := smartContract.SetRoleBinding(transactionContext, `{"MSPID":"Org3MSP","Attribute":"role","Value":"nurse","Role":"nurse"}`)
+	require.NoError(t, err)
+
+	transactionContext, _ = newEndorsement(state, testTxTime, nurse)
+	_, err = smartContract.ReadAsset(transactionContext, "patient1")
+	require.EqualError(t, err, "caller nurse1 with role 'nurse' is not permitted to call ReadAsset")
+
+	transactionContext, _ = newEndorsement(state, testTxTime, adminIdentity("Org1MSP", "org1admin"))
+	err = smartContract.SetRolePermissions(transactionContext, "nurse", `["ReadAsset","GetPrescriptionsByStatus"]`)
+	require.NoError(t, err)
+
+	for key, value := range activePatient(t) {
+		state[key] = value
+	}
+	transactionContext, _ = newEndorsement(state, testTxTime, nurse)
+	asset, err := smartContract.ReadAsset(transactionContext, "patient1")
+	require.NoError(t, err)
+	require.Equal(t, "patient1", asset.PatientId)
+
+	transactionContext, _ = newEndorsement(state, testTxTime, adminIdentity("Org1MSP", "org1admin"))
+	policy, err := smartContract.GetAccessPolicy(transactionContext)
+	require.NoError(t, err)
+	require.Equal(t, "org1admin", policy.UpdatedBy)
+	require.Equal(t, "2025-03-14T09:30:00Z", policy.UpdatedAt)
+}
+
+func TestPolicyManagementRequiresAdmin(t *testing.T) {
+	smartContract := chaincode.SmartContract{}
+
+	transactionContext, chaincodeStub := newEndorsement(ledger{}, testTxTime, doctorIdentity("doctor1"))
+	err := smartContract.SetRoleBinding(transactionContext, `{"MSPID":"Org1MSP","Role":"admin"}`)
+	require.EqualError(t, err, "caller doctor1 with role 'doctor' is not permitted to call SetRoleBinding")
+	require.Equal(t, 0, chaincodeStub.PutStateCallCount())
+}
+
+func TestSetAccessPolicyValidation(t *testing.T) {
+	smartContract := chaincode.SmartContract{}
+
+	tests := []struct {
+		name     string
+		policy   chaincode.AccessPolicy
+		expected string
+	}{
+		{
+			name: "unknown function",
+			policy: chaincode.AccessPolicy{
+				Bindings:    []chaincode.RoleBinding{{MSPID: "Org1MSP", Attribute: "hf.Type", Value: "admin", Role: "admin"}},
+				Permissions: []chaincode.RolePermission{{Role: "admin", Functions: []string{"SetAccessPolicy", "DeleteEverything"}}},
+			},
+			expected: "unknown contract function 'DeleteEverything' in permissions for role 'admin'",
+		},
+		{
+			name: "admin lockout",
+			policy: chaincode.AccessPolicy{
+				Bindings:    []chaincode.RoleBinding{{MSPID: "Org1MSP", Attribute: "role", Value: "doctor", Role: "doctor"}},
+				Permissions: []chaincode.RolePermission{{Role: "doctor", Functions: []string{"CreateAsset"}}},
+			},
+			expected: "access policy must bind at least one identity to a role permitted to call SetAccessPolicy",
+		},
+		{
+			name: "incomplete binding",
+			policy: chaincode.AccessPolicy{
+				Bindings:    []chaincode.RoleBinding{{MSPID: "Org1MSP"}},
+				Permissions: []chaincode.RolePermission{{Role: "admin", Functions: []string{"*"}}},
+			},
+			expected: "role bindings require an MSPID and a Role",
+		},
+		{
+			name: "unknown updatable field",
+			policy: chaincode.AccessPolicy{
+				Bindings:    []chaincode.RoleBinding{{MSPID: "Org1MSP", Attribute: "hf.Type", Value: "admin", Role: "admin"}},
+				Permissions: []chaincode.RolePermission{{Role: "admin", Functions: []string{"*"}, UpdatableFields: []string{"Dosage", "CreatedBy"}}},
+			},
+			expected: "unknown updatable field 'CreatedBy' for role 'admin'",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policyJSON, err := json.Marshal(tt.policy)
+			require.NoError(t, err)
+
+			transactionContext, chaincodeStub := newEndorsement(ledger{}, testTxTime, adminIdentity("Org1MSP", "org1admin"))
+			err = smartContract.SetAccessPolicy(transactionContext, string(policyJSON))
+			require.EqualError(t, err, tt.expected)
+			require.Equal(t, 0, chaincodeStub.PutStateCallCount())
+		})
+	}
+}
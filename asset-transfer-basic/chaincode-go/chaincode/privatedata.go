@@ -0,0 +1,234 @@
+package chaincode
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+)
+
+// Patient-identifying and clinical fields (PatientName, DateOfBirth and Diagnosis) are kept
+// in a private data collection shared by the prescribing and dispensing organizations. The
+// public records carry a salted hash of the private details in PrivateDataHash instead, so
+// the details can be proven without being disclosed to other channel members or the orderer.
+//
+// Clients submit the private fields as transient data under phiTransientKey so they are
+// never recorded in the transaction proposal. Records written before the collection existed
+// have no PrivateDataHash and keep their fields on the public record.
+const (
+	phiCollection   = "patientPHICollection"
+	phiTransientKey = "phi"
+	minSaltLength   = 16
+)
+
+// phiInput is the transient input carrying the private fields of one asset. Diagnoses
+// holds one diagnosis per submitted prescription, in the same order. AllergyOverrides allow
+// prescriptions that match the patient's allergies.
+type phiInput struct {
+	PatientName      string            `json:"PatientName"`
+	DateOfBirth      string            `json:"DateOfBirth"`
+	Salt             string            `json:"Salt"`
+	Diagnoses        []string          `json:"Diagnoses"`
+	AllergyOverrides []AllergyOverride `json:"AllergyOverrides,omitempty"`
+}
+
+// patientPrivateDetails is the private collection record of a patient.
+type patientPrivateDetails struct {
+	PatientId   string `json:"PatientId"`
+	PatientName string `json:"PatientName"`
+	DateOfBirth string `json:"DateOfBirth,omitempty"`
+	Salt        string `json:"Salt"`
+}
+
+// prescriptionPrivateDetails is the private collection record of a prescription.
+type prescriptionPrivateDetails struct {
+	PatientId        string            `json:"PatientId"`
+	PrescriptionId   string            `json:"PrescriptionId"`
+	Diagnosis        string            `json:"Diagnosis"`
+	AllergyOverrides []AllergyOverride `json:"AllergyOverrides,omitempty"`
+	Salt             string            `json:"Salt"`
+}
+
+// readPHIInput parses the transient private fields of a single asset, as submitted by
+// CreateAsset.
+func readPHIInput(ctx contractapi.TransactionContextInterface) (phiInput, error) {
+	entries, err := readPHIEntries(ctx, 1)
+	if err != nil {
+		return phiInput{}, err
+	}
+	return parsePHIInput(entries[0])
+}
+
+// readPHIEntries returns the unparsed transient private fields of count assets, one entry per
+// asset and nil where none was submitted. A single asset may be submitted as an object;
+// BatchCreatePrescriptions submits an array aligned with its assets, and each entry is
+// parsed with its asset so that a bad entry fails only that asset.
+func readPHIEntries(ctx contractapi.TransactionContextInterface, count int) ([]json.RawMessage, error) {
+	transientMap, err := ctx.GetStub().GetTransient()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get transient data: %v", err)
+	}
+	entries := make([]json.RawMessage, count)
+	phiJSON := transientMap[phiTransientKey]
+	if len(phiJSON) == 0 {
+		return entries, nil
+	}
+	if count == 1 && phiJSON[0] == '{' {
+		entries[0] = phiJSON
+		return entries, nil
+	}
+
+	var submitted []json.RawMessage
+	if err := json.Unmarshal(phiJSON, &submitted); err != nil {
+		return nil, fmt.Errorf("failed to parse transient patient details: %v", err)
+	}
+	if len(submitted) > count {
+		return nil, fmt.Errorf("transient patient details must be provided for each of the %d assets", count)
+	}
+	copy(entries, submitted)
+	return entries, nil
+}
+
+// parsePHIInput parses the transient private fields of one asset.
+func parsePHIInput(entry json.RawMessage) (phiInput, error) {
+	var input phiInput
+	if len(entry) == 0 || string(entry) == "null" {
+		return input, fmt.Errorf("patient details must be submitted in the '%s' transient field", phiTransientKey)
+	}
+	if err := json.Unmarshal(entry, &input); err != nil {
+		return input, fmt.Errorf("failed to parse transient patient details: %v", err)
+	}
+	if len(input.Salt) < minSaltLength {
+		return input, fmt.Errorf("salt must be at least %d characters", minSaltLength)
+	}
+	return input, nil
+}
+
+// rejectPublicPHI ensures an asset submitted as a public argument carries no private fields.
+func rejectPublicPHI(asset *Asset) error {
+	if asset.PatientName != "" || asset.DateOfBirth != "" {
+		return fmt.Errorf("patientName and dateOfBirth must be submitted in the '%s' transient field", phiTransientKey)
+	}
+	for _, prescription := range asset.Prescriptions {
+		if prescription.Diagnosis != "" {
+			return fmt.Errorf("diagnosis must be submitted in the '%s' transient field", phiTransientKey)
+		}
+	}
+	return nil
+}
+
+// saltedHash returns the hex SHA-256 of the JSON encoding of a private record, which
+// includes its salt.
+func saltedHash(details interface{}) (string, []byte, error) {
+	detailsJSON, err := json.Marshal(details)
+	if err != nil {
+		return "", nil, err
+	}
+	sum := sha256.Sum256(detailsJSON)
+	return hex.EncodeToString(sum[:]), detailsJSON, nil
+}
+
+// putPatientPrivate stores the patient's identifying fields in the private collection and
+// records their salted hash on the asset.
+func putPatientPrivate(ctx contractapi.TransactionContextInterface, asset *Asset, salt string) error {
+	hash, detailsJSON, err := saltedHash(patientPrivateDetails{
+		PatientId:   asset.PatientId,
+		PatientName: asset.PatientName,
+		DateOfBirth: asset.DateOfBirth,
+		Salt:        salt,
+	})
+	if err != nil {
+		return err
+	}
+	if err := ctx.GetStub().PutPrivateData(phiCollection, asset.PatientId, detailsJSON); err != nil {
+		return fmt.Errorf("failed to put private patient details: %v", err)
+	}
+	asset.PrivateDataHash = hash
+	return nil
+}
+
+// putPrescriptionPrivate stores the prescription's clinical fields in the private collection
+// and records their salted hash on the prescription.
+func putPrescriptionPrivate(ctx contractapi.TransactionContextInterface, prescription *Prescription, salt string) error {
+	key, err := prescriptionKey(ctx, prescription.PatientId, prescription.PrescriptionId)
+	if err != nil {
+		return err
+	}
+
+	hash, detailsJSON, err := saltedHash(prescriptionPrivateDetails{
+		PatientId:        prescription.PatientId,
+		PrescriptionId:   prescription.PrescriptionId,
+		Diagnosis:        prescription.Diagnosis,
+		AllergyOverrides: prescription.AllergyOverrides,
+		Salt:             salt,
+	})
+	if err != nil {
+		return err
+	}
+	if err := ctx.GetStub().PutPrivateData(phiCollection, key, detailsJSON); err != nil {
+		return fmt.Errorf("failed to put private prescription details: %v", err)
+	}
+	prescription.PrivateDataHash = hash
+	return nil
+}
+
+// readPrivateDetails loads a private record into details and checks it against the hash on
+// the public record. It returns false if this peer holds no copy of the record.
+func readPrivateDetails(ctx contractapi.TransactionContextInterface, key string, hash string, details interface{}) (bool, error) {
+	detailsJSON, err := ctx.GetStub().GetPrivateData(phiCollection, key)
+	if err != nil {
+		return false, fmt.Errorf("failed to read private details: %v", err)
+	}
+	if detailsJSON == nil {
+		return false, nil
+	}
+
+	sum := sha256.Sum256(detailsJSON)
+	if hex.EncodeToString(sum[:]) != hash {
+		return false, fmt.Errorf("private details do not match the public hash")
+	}
+	if err := json.Unmarshal(detailsJSON, details); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// mergePatientPrivate fills in the patient's identifying fields from the private collection.
+func mergePatientPrivate(ctx contractapi.TransactionContextInterface, asset *Asset) error {
+	if asset.PrivateDataHash == "" {
+		return nil
+	}
+
+	var details patientPrivateDetails
+	found, err := readPrivateDetails(ctx, asset.PatientId, asset.PrivateDataHash, &details)
+	if err != nil || !found {
+		return err
+	}
+	asset.PatientName = details.PatientName
+	asset.DateOfBirth = details.DateOfBirth
+	return nil
+}
+
+// mergePrescriptionPrivate fills in the prescription's clinical fields from the private
+// collection.
+func mergePrescriptionPrivate(ctx contractapi.TransactionContextInterface, prescription *Prescription) error {
+	if prescription.PrivateDataHash == "" {
+		return nil
+	}
+
+	key, err := prescriptionKey(ctx, prescription.PatientId, prescription.PrescriptionId)
+	if err != nil {
+		return err
+	}
+
+	var details prescriptionPrivateDetails
+	found, err := readPrivateDetails(ctx, key, prescription.PrivateDataHash, &details)
+	if err != nil || !found {
+		return err
+	}
+	prescription.Diagnosis = details.Diagnosis
+	prescription.AllergyOverrides = details.AllergyOverrides
+	return nil
+}
@@ -0,0 +1,140 @@
+package chaincode_test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/hyperledger/fabric-chaincode-go/v2/shim"
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode"
+	"github.com/stretchr/testify/require"
+)
+
+const testCollection = "patientPHICollection"
+
+func TestPrivateFieldsAreKeptOffThePublicLedger(t *testing.T) {
+	smartContract := chaincode.SmartContract{}
+	state := ledger{}
+
+	transactionContext, _ := newEndorsement(state, testTxTime, doctorIdentity("doctor1"))
+	withPHI(transactionContext, `{"PatientName":"Jane Banda","DateOfBirth":"1990-01-01","Salt":"0123456789abcdef","Diagnoses":["Otitis media"]}`)
+	result, err := smartContract.CreateAsset(transactionContext, `{"PatientId":"patient1","Prescriptions":[{"MedicationName":"Amoxicillin"}]}`)
+	require.NoError(t, err)
+
+	prescriptionKey, err := shim.CreateCompositeKey("prescription", []string{"patient1", result.PrescriptionIds[0]})
+	require.NoError(t, err)
+
+	for key, value := range state {
+		if strings.HasPrefix(key, "\x00private\x00") {
+			continue
+		}
+		require.NotContains(t, string(value), "Jane Banda")
+		require.NotContains(t, string(value), "1990-01-01")
+		require.NotContains(t, string(value), "Otitis media")
+	}
+
+	// The public records carry the salted hash of the private records.
+	var patient chaincode.Asset
+	require.NoError(t, json.Unmarshal(state["patient1"], &patient))
+	patientDetails := state[privateKey(testCollection, "patient1")]
+	require.Contains(t, string(patientDetails), "Jane Banda")
+	require.Equal(t, sha256Hex(patientDetails), patient.PrivateDataHash)
+
+	var prescription chaincode.Prescription
+	require.NoError(t, json.Unmarshal(state[prescriptionKey], &prescription))
+	prescriptionDetails := state[privateKey(testCollection, prescriptionKey)]
+	require.Contains(t, string(prescriptionDetails), "Otitis media")
+	require.Equal(t, sha256Hex(prescriptionDetails), prescription.PrivateDataHash)
+
+	asset := readPatient(t, state, "patient1")
+	require.Equal(t, "Jane Banda", asset.PatientName)
+	require.Equal(t, "1990-01-01", asset.DateOfBirth)
+	require.Equal(t, "Otitis media", asset.Prescriptions[0].Diagnosis)
+
+	// The diagnosis survives rewrites of the public prescription record.
+	transactionContext, _ = newEndorsement(state, testTxTime, pharmacistIdentity("pharmacist1"))
+	err = smartContract.DispensePrescription(transactionContext, `{"patientId":"patient1","prescriptionId":"`+result.PrescriptionIds[0]+`"}`)
+	require.NoError(t, err)
+	require.NotContains(t, string(state[prescriptionKey]), "Otitis media")
+	asset = readPatient(t, state, "patient1")
+	require.Equal(t, chaincode.StatusDispensed, asset.Prescriptions[0].Status)
+	require.Equal(t, "Otitis media", asset.Prescriptions[0].Diagnosis)
+}
+
+func TestCreateAssetRequiresTransientPrivateFields(t *testing.T) {
+	smartContract := chaincode.SmartContract{}
+
+	tests := []struct {
+		name      string
+		assetJSON string
+		phiJSON   string
+		expected  string
+	}{
+		{
+			name:      "patient name in arguments",
+			assetJSON: `{"PatientId":"patient1","PatientName":"Jane Banda","Prescriptions":[{}]}`,
+			phiJSON:   `{"Salt":"0123456789abcdef","Diagnoses":["Otitis media"]}`,
+			expected:  "patientName and dateOfBirth must be submitted in the 'phi' transient field",
+		},
+		{
+			name:      "diagnosis in arguments",
+			assetJSON: `{"PatientId":"patient1","Prescriptions":[{"Diagnosis":"Otitis media"}]}`,
+			phiJSON:   `{"Salt":"0123456789abcdef","Diagnoses":["Otitis media"]}`,
+			expected:  "diagnosis must be submitted in the 'phi' transient field",
+		},
+		{
+			name:      "missing transient data",
+			assetJSON: `{"PatientId":"patient1","Prescriptions":[{}]}`,
+			expected:  "patient details must be submitted in the 'phi' transient field",
+		},
+		{
+			name:      "short salt",
+			assetJSON: `{"PatientId":"patient1","Prescriptions":[{}]}`,
+			phiJSON:   `{"Salt":"pepper","Diagnoses":["Otitis media"]}`,
+			expected:  "salt must be at least 16 characters",
+		},
+		{
+			name:      "missing diagnosis",
+			assetJSON: `{"PatientId":"patient1","Prescriptions":[{},{}]}`,
+			phiJSON:   `{"Salt":"0123456789abcdef","Diagnoses":["Otitis media"]}`,
+			expected:  "transient patient details must include one diagnosis per prescription",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transactionContext, chaincodeStub := newEndorsement(ledger{}, testTxTime, doctorIdentity("doctor1"))
+			if tt.phiJSON != "" {
+				withPHI(transactionContext, tt.phiJSON)
+			}
+			_, err := smartContract.CreateAsset(transactionContext, tt.assetJSON)
+			require.EqualError(t, err, tt.expected)
+			require.Equal(t, 0, chaincodeStub.PutStateCallCount())
+			require.Equal(t, 0, chaincodeStub.PutPrivateDataCallCount())
+		})
+	}
+}
+
+func TestTamperedPrivateDetailsAreRejected(t *testing.T) {
+	smartContract := chaincode.SmartContract{}
+	state := ledger{}
+
+	transactionContext, _ := newEndorsement(state, testTxTime, doctorIdentity("doctor1"))
+	withPHI(transactionContext, `{"PatientName":"Jane Banda","Salt":"0123456789abcdef","Diagnoses":["Otitis media"]}`)
+	_, err := smartContract.CreateAsset(transactionContext, `{"PatientId":"patient1","Prescriptions":[{}]}`)
+	require.NoError(t, err)
+
+	key := privateKey(testCollection, "patient1")
+	state[key] = []byte(strings.Replace(string(state[key]), "Jane Banda", "John Phiri", 1))
+
+	transactionContext, _ = newEndorsement(state, testTxTime, doctorIdentity("doctor1"))
+	_, err = smartContract.ReadAsset(transactionContext, "patient1")
+	require.EqualError(t, err, "private details do not match the public hash")
+}
+
+func sha256Hex(value []byte) string {
+	sum := sha256.Sum256(value)
+	return hex.EncodeToString(sum[:])
+}
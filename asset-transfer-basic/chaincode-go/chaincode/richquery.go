@@ -0,0 +1,204 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+)
+
+// prescriptionQuery selects prescription records. On CouchDB it runs as a rich query using
+// one of the indexes packaged under META-INF/statedb/couchdb/indexes. LevelDB has no rich
+// queries, so there the query reads the chaincode's own secondary index when it has one, and
+// otherwise scans the prescription records in key order and filters them with match.
+type prescriptionQuery struct {
+	selector map[string]interface{}
+	// index names the CouchDB index the query uses; its design document is index + "Doc".
+	index string
+	// secondaryIndex and secondaryValue name the composite key index entries to read on
+	// LevelDB, if any.
+	secondaryIndex string
+	secondaryValue string
+	match          func(*Prescription) bool
+}
+
+// isPrescriptionSelector restricts a selector to prescription records.
+var isPrescriptionSelector = map[string]interface{}{"$exists": true}
+
+// doctorQuery selects the prescriptions written by a doctor, named by MSP-qualified identity
+// or, for doctors of the original prescribing organization, by enrollment ID alone.
+func doctorQuery(doctorId string) *prescriptionQuery {
+	prescriber := qualifyID(doctorId, legacyDoctorMSPID)
+	return &prescriptionQuery{
+		selector: map[string]interface{}{
+			"PrescriptionId": isPrescriptionSelector,
+			"CreatedBy":      enrollmentIDOf(prescriber),
+		},
+		index:          "indexDoctor",
+		secondaryIndex: doctorIndex,
+		secondaryValue: prescriber,
+		match:          func(p *Prescription) bool { return p.prescriber() == prescriber },
+	}
+}
+
+func statusQuery(status PrescriptionStatus) *prescriptionQuery {
+	return &prescriptionQuery{
+		selector: map[string]interface{}{
+			"PrescriptionId": isPrescriptionSelector,
+			"Status":         status,
+		},
+		index:          "indexStatus",
+		secondaryIndex: statusIndex,
+		secondaryValue: string(status),
+		match:          func(p *Prescription) bool { return p.Status == status },
+	}
+}
+
+// pharmacistQuery selects prescriptions the pharmacist dispensed in whole or in part, named by
+// MSP-qualified identity or, for pharmacists of the original dispensing organization, by
+// enrollment ID alone. The index narrows the query to dispensed prescriptions, which always
+// name their latest dispensing pharmacist.
+func pharmacistQuery(pharmacistId string) *prescriptionQuery {
+	pharmacist := qualifyID(pharmacistId, legacyPharmacistMSPID)
+	enrollmentID := enrollmentIDOf(pharmacist)
+	return &prescriptionQuery{
+		selector: map[string]interface{}{
+			"PrescriptionId":       isPrescriptionSelector,
+			"dispensingPharmacist": map[string]interface{}{"$gt": nil},
+			"$or": []interface{}{
+				map[string]interface{}{"dispensingPharmacist": enrollmentID},
+				map[string]interface{}{"Dispensations": map[string]interface{}{"$elemMatch": map[string]interface{}{"PharmacistId": enrollmentID}}},
+			},
+		},
+		index:          "indexPharmacist",
+		secondaryIndex: pharmacistIndex,
+		secondaryValue: pharmacist,
+		match: func(p *Prescription) bool {
+			for _, id := range p.pharmacists() {
+				if id == pharmacist {
+					return true
+				}
+			}
+			return false
+		},
+	}
+}
+
+// expiryQuery selects prescriptions expiring between the YYYY-MM-DD dates, inclusive.
+func expiryQuery(startDate string, endDate string) *prescriptionQuery {
+	return &prescriptionQuery{
+		selector: map[string]interface{}{
+			"PrescriptionId": isPrescriptionSelector,
+			"ExpiryDate":     map[string]interface{}{"$gte": startDate, "$lte": endDate},
+		},
+		index: "indexExpiry",
+		match: func(p *Prescription) bool { return p.ExpiryDate >= startDate && p.ExpiryDate <= endDate },
+	}
+}
+
+// queryString returns the CouchDB query for the selector and index.
+func (q *prescriptionQuery) queryString() (string, error) {
+	query, err := json.Marshal(map[string]interface{}{
+		"selector":  q.selector,
+		"use_index": []string{"_design/" + q.index + "Doc", q.index},
+	})
+	if err != nil {
+		return "", err
+	}
+	return string(query), nil
+}
+
+// isUnsupportedQueryError reports whether the peer rejected a rich query because its state
+// database is LevelDB.
+func isUnsupportedQueryError(err error) bool {
+	return strings.Contains(strings.ToLower(err.Error()), "not supported for leveldb")
+}
+
+// page returns one page of the prescriptions selected by the query. On LevelDB without a
+// secondary index a page scans pageSize prescription records and returns those that match,
+// so it may hold fewer records, or none, while a bookmark for the next page remains.
+func (q *prescriptionQuery) page(ctx contractapi.TransactionContextInterface, pageSize int32, bookmark string) (*PrescriptionPage, error) {
+	if err := validatePageSize(pageSize); err != nil {
+		return nil, err
+	}
+
+	query, err := q.queryString()
+	if err != nil {
+		return nil, err
+	}
+
+	iterator, metadata, err := ctx.GetStub().GetQueryResultWithPagination(query, pageSize, bookmark)
+	if err != nil {
+		if isUnsupportedQueryError(err) {
+			return q.scanPage(ctx, pageSize, bookmark)
+		}
+		return nil, fmt.Errorf("failed to query prescriptions: %v", err)
+	}
+	defer iterator.Close()
+
+	// The selector matches enrollment IDs, which may be shared by identities of other MSPs.
+	records, err := readPrescriptions(ctx, iterator, q.match)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PrescriptionPage{
+		Records:             records,
+		FetchedRecordsCount: metadata.GetFetchedRecordsCount(),
+		Bookmark:            metadata.GetBookmark(),
+	}, nil
+}
+
+// scanPage is the LevelDB fallback for page.
+func (q *prescriptionQuery) scanPage(ctx contractapi.TransactionContextInterface, pageSize int32, bookmark string) (*PrescriptionPage, error) {
+	if q.secondaryIndex != "" {
+		return q.indexPage(ctx, pageSize, bookmark)
+	}
+
+	iterator, metadata, err := ctx.GetStub().GetStateByPartialCompositeKeyWithPagination(prescriptionObjectType, []string{}, pageSize, bookmark)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan prescriptions: %v", err)
+	}
+	defer iterator.Close()
+
+	records, err := readPrescriptions(ctx, iterator, q.match)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PrescriptionPage{
+		Records:             records,
+		FetchedRecordsCount: metadata.GetFetchedRecordsCount(),
+		Bookmark:            metadata.GetBookmark(),
+	}, nil
+}
+
+// indexPage reads one page of the query's secondary index entries and the prescriptions they
+// refer to.
+func (q *prescriptionQuery) indexPage(ctx contractapi.TransactionContextInterface, pageSize int32, bookmark string) (*PrescriptionPage, error) {
+	iterator, metadata, err := ctx.GetStub().GetStateByPartialCompositeKeyWithPagination(q.secondaryIndex, []string{q.secondaryValue}, pageSize, bookmark)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s index: %v", q.secondaryIndex, err)
+	}
+	defer iterator.Close()
+
+	records := []*Prescription{}
+	for iterator.HasNext() {
+		queryResponse, err := iterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		prescription, err := readIndexedPrescription(ctx, queryResponse.Key)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, prescription)
+	}
+
+	return &PrescriptionPage{
+		Records:             records,
+		FetchedRecordsCount: metadata.GetFetchedRecordsCount(),
+		Bookmark:            metadata.GetBookmark(),
+	}, nil
+}
@@ -0,0 +1,129 @@
+package chaincode_test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode"
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode/mocks"
+	"github.com/stretchr/testify/require"
+)
+
+const indexDir = "../META-INF/statedb/couchdb/indexes"
+
+func TestRichQueriesUsePackagedIndexes(t *testing.T) {
+	smartContract := chaincode.SmartContract{}
+
+	tests := []struct {
+		name     string
+		identity *mocks.ClientIdentity
+		query    func(ctx contractapi.TransactionContextInterface) (*chaincode.PrescriptionPage, error)
+	}{
+		{
+			name:     "doctor",
+			identity: doctorIdentity("doctor1"),
+			query: func(ctx contractapi.TransactionContextInterface) (*chaincode.PrescriptionPage, error) {
+				return smartContract.GetPrescriptionsByDoctorWithPagination(ctx, "doctor1", 10, "")
+			},
+		},
+		{
+			name:     "pharmacist",
+			identity: pharmacistIdentity("pharmacist1"),
+			query: func(ctx contractapi.TransactionContextInterface) (*chaincode.PrescriptionPage, error) {
+				return smartContract.GetDispenseHistoryWithPagination(ctx, "pharmacist1", 10, "")
+			},
+		},
+		{
+			name:     "status",
+			identity: pharmacistIdentity("pharmacist1"),
+			query: func(ctx contractapi.TransactionContextInterface) (*chaincode.PrescriptionPage, error) {
+				return smartContract.QueryPrescriptionsByStatus(ctx, "Active", 10, "")
+			},
+		},
+		{
+			name:     "expiry",
+			identity: pharmacistIdentity("pharmacist1"),
+			query: func(ctx contractapi.TransactionContextInterface) (*chaincode.PrescriptionPage, error) {
+				return smartContract.QueryPrescriptionsByExpiry(ctx, "2025-03-01", "2025-03-31", 10, "")
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state := ledger{}
+			transactionContext, chaincodeStub := newEndorsement(state, testTxTime, tt.identity)
+			received := withRichQueries(state, chaincodeStub, func(chaincode.Prescription) bool { return true })
+			_, err := tt.query(transactionContext)
+			require.NoError(t, err)
+
+			var sent struct {
+				Selector map[string]interface{} `json:"selector"`
+				UseIndex []string               `json:"use_index"`
+			}
+			require.NoError(t, json.Unmarshal([]byte((*received)[0]), &sent))
+			require.Len(t, sent.UseIndex, 2)
+
+			indexJSON, err := os.ReadFile(filepath.Join(indexDir, sent.UseIndex[1]+".json"))
+			require.NoError(t, err)
+			var index struct {
+				Index struct {
+					Fields []string `json:"fields"`
+				} `json:"index"`
+				Ddoc string `json:"ddoc"`
+				Name string `json:"name"`
+			}
+			require.NoError(t, json.Unmarshal(indexJSON, &index))
+			require.Equal(t, "_design/"+index.Ddoc, sent.UseIndex[0])
+			require.Equal(t, index.Name, sent.UseIndex[1])
+			for _, field := range index.Index.Fields {
+				require.Contains(t, sent.Selector, field)
+			}
+		})
+	}
+}
+
+func TestRichQueriesFallBackOnLevelDB(t *testing.T) {
+	smartContract := chaincode.SmartContract{}
+	state := analyticsState(t)
+
+	// The default ledger rejects rich queries as LevelDB does, so lookups by doctor read the
+	// doctor~prescription index and each page holds only the doctor's prescriptions.
+	transactionContext, _ := newEndorsement(state, testTxTime, doctorIdentity("doctor1"))
+	page, err := smartContract.GetPrescriptionsByDoctorWithPagination(transactionContext, "doctor1", 1, "")
+	require.NoError(t, err)
+	require.Equal(t, int32(1), page.FetchedRecordsCount)
+	require.Len(t, page.Records, 1)
+	require.Equal(t, "rx1", page.Records[0].PrescriptionId)
+	require.Equal(t, "Otitis media", page.Records[0].Diagnosis)
+	require.NotEmpty(t, page.Bookmark)
+
+	transactionContext, _ = newEndorsement(state, testTxTime, doctorIdentity("doctor1"))
+	page, err = smartContract.GetPrescriptionsByDoctorWithPagination(transactionContext, "doctor1", 1, page.Bookmark)
+	require.NoError(t, err)
+	require.Len(t, page.Records, 1)
+	require.Equal(t, "rx2", page.Records[0].PrescriptionId)
+	require.Empty(t, page.Bookmark)
+
+	// Expiry has no secondary index, so a page scans prescription records and keeps those
+	// that match.
+	transactionContext, _ = newEndorsement(state, testTxTime, pharmacistIdentity("pharmacist1"))
+	page, err = smartContract.QueryPrescriptionsByExpiry(transactionContext, "2025-04-01", "2025-04-30", 2, "")
+	require.NoError(t, err)
+	require.Equal(t, int32(2), page.FetchedRecordsCount)
+	require.Empty(t, page.Records)
+	require.NotEmpty(t, page.Bookmark)
+
+	transactionContext, _ = newEndorsement(state, testTxTime, pharmacistIdentity("pharmacist1"))
+	page, err = smartContract.QueryPrescriptionsByStatus(transactionContext, "PartiallyDispensed", 10, "")
+	require.NoError(t, err)
+	require.Len(t, page.Records, 1)
+	require.Equal(t, "rx2", page.Records[0].PrescriptionId)
+
+	transactionContext, _ = newEndorsement(state, testTxTime, pharmacistIdentity("pharmacist1"))
+	_, err = smartContract.QueryPrescriptionsByExpiry(transactionContext, "2025-04-01", "", 10, "")
+	require.EqualError(t, err, "startDate and endDate are required")
+}
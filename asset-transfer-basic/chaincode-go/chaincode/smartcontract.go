@@ -3,9 +3,9 @@ package chaincode
 import (
     "encoding/json"
     "fmt"
+    "sort"
     "time"
     "github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
-    "math/rand"
 )
 
 type SmartContract struct {
@@ -13,6 +13,10 @@ type SmartContract struct {
 }
 
 // An asset is a patient's medical prescription record, with the following attributes:
+// Only the demographics are stored under the PatientId key; prescriptions are stored under
+// their own keys and aggregated into Prescriptions when the asset is read.
+// PatientName and DateOfBirth are kept in the private data collection; the public record
+// holds their salted hash in PrivateDataHash.
 type Asset struct {
     DoctorId      string         `json:"DoctorId"`      
     PatientName   string         `json:"PatientName"`  
@@ -20,237 +24,413 @@ type Asset struct {
     DateOfBirth   string         `json:"DateOfBirth,omitempty"` 
     Prescriptions []Prescription `json:"Prescriptions"` 
     LastUpdated   string         `json:"LastUpdated"`   
+    PrivateDataHash string       `json:"PrivateDataHash,omitempty"`
 }
 
 // Prescription structure
+// Diagnosis and AllergyOverrides are kept in the private data collection; the public record
+// holds their salted hash in PrivateDataHash. The prescriber is CreatedBy within the MSP
+// CreatedByMSP, which is empty on records written before it was recorded.
 type Prescription struct {
     PrescriptionId      string `json:"PrescriptionId"`
+    PatientId           string `json:"PatientId,omitempty"`
     MedicationName      string `json:"MedicationName"`
     Dosage              string `json:"Dosage"`
+    Medication          *CodedMedication `json:"Medication,omitempty"`
+    Dose                *Dose  `json:"Dose,omitempty"`
     Instructions        string `json:"Instructions"`
     Diagnosis           string `json:"Diagnosis"`       
-    Status              string `json:"Status"`    
+    Status              PrescriptionStatus `json:"Status"`    
     CreatedBy           string `json:"CreatedBy"` 
+    CreatedByMSP        string `json:"CreatedByMSP,omitempty"`
     TxID                string `json:"TxID"`
     Timestamp           string `json:"Timestamp"`
+    CreatedAt           string `json:"CreatedAt,omitempty"`
     ExpiryDate          string `json:"ExpiryDate,omitempty"`
+    Quantity            int    `json:"Quantity,omitempty"`
+    Refills             int    `json:"Refills,omitempty"`
+    Dispensations       []Dispensation `json:"Dispensations,omitempty"`
     DispensingPharmacist string `json:"dispensingPharmacist,omitempty"`
     DispensingTimestamp  string `json:"dispensingTimestamp,omitempty"`  
+    PrivateDataHash      string `json:"PrivateDataHash,omitempty"`
+    Amendments           []Amendment `json:"Amendments,omitempty"`
+    AllergyOverrides     []AllergyOverride `json:"AllergyOverrides,omitempty"`
+}
+
+// CreateAssetResult is returned by CreateAsset with the IDs assigned to the new prescriptions,
+// in the order they were submitted. InteractionWarnings lists the interactions found when the
+// interaction catalogue is enforced that were not severe enough to block them.
+type CreateAssetResult struct {
+    PatientId           string               `json:"PatientId"`
+    PrescriptionIds     []string             `json:"PrescriptionIds"`
+    InteractionWarnings []InteractionFinding `json:"InteractionWarnings,omitempty"`
 }
 
 // IssuePrescription - this function allows a doctor to issue a new prescription for a patient
 // It requires the doctor to be authenticated and authorized to perform this action.
-func (s *SmartContract) CreateAsset(ctx contractapi.TransactionContextInterface, assetJSON string) error {
+// The prescribing doctor is taken from the client certificate; a DoctorId in the payload
+// must match it. Prescription IDs are assigned by the chaincode and returned to the caller.
+// PatientName, DateOfBirth and the diagnoses are submitted as transient data under "phi".
+func (s *SmartContract) CreateAsset(ctx contractapi.TransactionContextInterface, assetJSON string) (*CreateAssetResult, error) {
+    doctor, err := s.authorize(ctx, "CreateAsset")
+    if err != nil {
+        return nil, err
+    }
+
     // Parse the new asset data
     var newAsset Asset
-    err := json.Unmarshal([]byte(assetJSON), &newAsset)
+    err = json.Unmarshal([]byte(assetJSON), &newAsset)
+    if err != nil {
+        return nil, fmt.Errorf("failed to parse asset JSON: %v", err)
+    }
+    if err := rejectPublicPHI(&newAsset); err != nil {
+        return nil, err
+    }
+
+    phi, err := readPHIInput(ctx)
+    if err != nil {
+        return nil, err
+    }
+
+    result, err := s.createAsset(ctx, doctor, newAsset, phi, 0)
+    if err != nil {
+        return nil, err
+    }
+
+    clock, err := newTxClock(ctx)
     if err != nil {
-        return fmt.Errorf("failed to parse asset JSON: %v", err)
+        return nil, err
+    }
+    if err := emitPrescriptionEvent(ctx, eventPrescriptionCreated, doctor, clock, createdEntries(result)); err != nil {
+        return nil, err
     }
 
+    return result, nil
+}
+
+// createAsset - stores a new asset's prescriptions on behalf of an authorized doctor
+// position is the index of the first prescription within the transaction, so that every
+// prescription created by one transaction gets a distinct ID. phi carries the private fields
+// submitted as transient data.
+func (s *SmartContract) createAsset(ctx contractapi.TransactionContextInterface, doctor *caller, newAsset Asset, phi phiInput, position int) (*CreateAssetResult, error) {
     // Validate required fields
-    if newAsset.PatientId == "" || newAsset.DoctorId == "" {
-        return fmt.Errorf("patientId and doctorId are required")
-    }
-
-    // Check if asset already exists
-    existingAsset, err := s.ReadAsset(ctx, newAsset.PatientId)
-    if err == nil {
-        // Asset exists - merge prescriptions
-        for _, prescription := range newAsset.Prescriptions {
-            // Validate required prescription fields
-            if prescription.Diagnosis == "" {
-                return fmt.Errorf("diagnosis is required for all prescriptions")
-            }
-            
-            // Add metadata to new prescription
-            prescription.TxID = ctx.GetStub().GetTxID()
-            prescription.Timestamp = time.Now().Format(time.RFC3339)
-            prescription.Status = "Active"
-            prescription.CreatedBy = newAsset.DoctorId
-            
-            if prescription.ExpiryDate == "" {
-                prescription.ExpiryDate = time.Now().AddDate(0, 1, 0).Format("2006-01-02")
+    if newAsset.PatientId == "" {
+        return nil, fmt.Errorf("patientId is required")
+    }
+    if err := doctor.checkClaim("doctorId", newAsset.DoctorId); err != nil {
+        return nil, err
+    }
+    if newAsset.PatientId == doctor.EnrollmentID {
+        return nil, fmt.Errorf("doctors may not issue prescriptions to themselves")
+    }
+    newAsset.DoctorId = doctor.EnrollmentID
+
+    clock, err := newTxClock(ctx)
+    if err != nil {
+        return nil, err
+    }
+
+    // Validate required prescription fields
+    if len(phi.Diagnoses) != len(newAsset.Prescriptions) {
+        return nil, fmt.Errorf("transient patient details must include one diagnosis per prescription")
+    }
+    for i := range newAsset.Prescriptions {
+        prescription := &newAsset.Prescriptions[i]
+        if prescription.PrescriptionId != "" {
+            return nil, fmt.Errorf("prescriptionId is assigned by the chaincode and must not be supplied")
+        }
+        if phi.Diagnoses[i] == "" {
+            return nil, fmt.Errorf("diagnosis is required for all prescriptions")
+        }
+        if prescription.ExpiryDate != "" {
+            if _, err := time.Parse(dateLayout, prescription.ExpiryDate); err != nil {
+                return nil, fmt.Errorf("invalid expiry date '%s': expected YYYY-MM-DD", prescription.ExpiryDate)
             }
-            
-            // Add to existing prescriptions
-            existingAsset.Prescriptions = append(existingAsset.Prescriptions, prescription)
         }
-        
-        // Update last updated time
-        existingAsset.LastUpdated = time.Now().Format(time.RFC3339)
-        
-        // Save merged asset
-        assetJSONBytes, err := json.Marshal(existingAsset)
-        if err != nil {
-            return err
+        if err := prescription.validateQuantities(); err != nil {
+            return nil, err
         }
-        return ctx.GetStub().PutState(newAsset.PatientId, assetJSONBytes)
-    } else {
+        if err := prescription.applyCoding(ctx); err != nil {
+            return nil, err
+        }
+    }
+
+    overrides, err := checkAllergies(ctx, doctor, clock, newAsset.PatientId, newAsset.Prescriptions, phi.AllergyOverrides)
+    if err != nil {
+        return nil, err
+    }
+    for i := range newAsset.Prescriptions {
+        newAsset.Prescriptions[i].AllergyOverrides = overrides[i]
+    }
+
+    warnings, err := screenNewPrescriptions(ctx, newAsset.PatientId, newAsset.Prescriptions)
+    if err != nil {
+        return nil, err
+    }
+
+    // Check if asset already exists. New prescriptions for an existing patient are written
+    // to their own keys without touching the patient record.
+    _, err = readPatient(ctx, newAsset.PatientId)
+    if err != nil {
         // Asset doesn't exist - create new
-        
-        // Add metadata to new prescriptions
-        for i := range newAsset.Prescriptions {
-            if newAsset.Prescriptions[i].Diagnosis == "" {
-                return fmt.Errorf("diagnosis is required for all prescriptions")
-            }
-            newAsset.Prescriptions[i].TxID = ctx.GetStub().GetTxID()
-            newAsset.Prescriptions[i].Timestamp = time.Now().Format(time.RFC3339)
-            newAsset.Prescriptions[i].Status = "Active"
-            newAsset.Prescriptions[i].CreatedBy = newAsset.DoctorId
-            
-            if newAsset.Prescriptions[i].ExpiryDate == "" {
-                newAsset.Prescriptions[i].ExpiryDate = time.Now().AddDate(0, 1, 0).Format("2006-01-02")
-            }
+        newAsset.PatientName = phi.PatientName
+        newAsset.DateOfBirth = phi.DateOfBirth
+        newAsset.LastUpdated = clock.Timestamp()
+        if err := putPatientPrivate(ctx, &newAsset, phi.Salt); err != nil {
+            return nil, err
+        }
+        if err := putPatient(ctx, &newAsset); err != nil {
+            return nil, err
         }
-        
-        newAsset.LastUpdated = time.Now().Format(time.RFC3339)
-        
-        assetJSONBytes, err := json.Marshal(newAsset)
+    }
+
+    result := &CreateAssetResult{PatientId: newAsset.PatientId, PrescriptionIds: []string{}, InteractionWarnings: warnings}
+
+    // Add metadata to new prescriptions
+    for i, prescription := range newAsset.Prescriptions {
+        prescription.PrescriptionId = newPrescriptionId(ctx.GetStub().GetTxID(), position+i)
+        prescription.PatientId = newAsset.PatientId
+        prescription.Diagnosis = phi.Diagnoses[i]
+        prescription.TxID = ctx.GetStub().GetTxID()
+        prescription.Timestamp = clock.Timestamp()
+        prescription.CreatedAt = clock.Timestamp()
+        prescription.Status = StatusActive
+        prescription.CreatedBy = doctor.EnrollmentID
+        prescription.CreatedByMSP = doctor.MSPID
+        prescription.Dispensations = nil
+        prescription.Amendments = nil
+        prescription.DispensingPharmacist = ""
+        prescription.DispensingTimestamp = ""
+
+        if prescription.ExpiryDate == "" {
+            prescription.ExpiryDate = clock.DefaultExpiryDate()
+        }
+
+        exists, err := prescriptionExists(ctx, prescription.PatientId, prescription.PrescriptionId)
         if err != nil {
-            return err
+            return nil, err
+        }
+        if exists {
+            return nil, fmt.Errorf("prescription %s already exists for patient %s", prescription.PrescriptionId, prescription.PatientId)
+        }
+
+        if err := putPrescriptionPrivate(ctx, &prescription, phi.Salt); err != nil {
+            return nil, err
+        }
+        if err := putPrescription(ctx, &prescription); err != nil {
+            return nil, err
         }
-        return ctx.GetStub().PutState(newAsset.PatientId, assetJSONBytes)
+        result.PrescriptionIds = append(result.PrescriptionIds, prescription.PrescriptionId)
     }
+
+    return result, nil
 }
 
 // ReadAsset - returns world state information for an asset, patientId as key
 func (s *SmartContract) ReadAsset(ctx contractapi.TransactionContextInterface, patientId string) (*Asset, error) {
-    assetJSON, err := ctx.GetStub().GetState(patientId)
-    if err != nil {
-        return nil, fmt.Errorf("failed to read from world state: %v", err)
-    }
-    if assetJSON == nil {
-        return nil, fmt.Errorf("asset %s does not exist", patientId)
+    if _, err := s.authorize(ctx, "ReadAsset"); err != nil {
+        return nil, err
     }
+    return s.readAsset(ctx, patientId)
+}
 
-    var asset Asset
-    err = json.Unmarshal(assetJSON, &asset)
+// readAsset - loads a patient's asset with all of its prescriptions without authorizing the
+// caller, for use by transactions that have already run their own authorization check
+func (s *SmartContract) readAsset(ctx contractapi.TransactionContextInterface, patientId string) (*Asset, error) {
+    patient, err := readPatient(ctx, patientId)
     if err != nil {
         return nil, err
     }
 
-    return &asset, nil
+    return aggregateAsset(ctx, patient)
 }
 
 // UpdatePrescription  - may be used to update prescription details, incase of a change in dosage or instructions
-// Prescriptions are immutable, but we can update the status or other non-immutable fields
-func (s *SmartContract) UpdatePrescription(ctx contractapi.TransactionContextInterface, patientId string, prescriptionJSON string) error {
-    // Get existing asset
-    asset, err := s.ReadAsset(ctx, patientId)
+// Prescriptions are immutable except for the fields the caller's role may update, as listed in
+// the access policy. The update is a patch naming only the fields to change and the reason,
+// and each update is recorded as an amendment with the previous values. The prescribing doctor
+// is the only doctor who may update a prescription. Medication, dosage and instructions cannot
+// change once the prescription has been dispensed, and prescriptions in a terminal status
+// cannot be updated at all. The diagnosis is kept in the private data collection and is
+// not changed by an update. A new medication is checked against the patient's allergies and
+// the interaction catalogue as in CreateAsset; allergy overrides are submitted as transient
+// data under "phi" with a salt.
+func (s *SmartContract) UpdatePrescription(ctx contractapi.TransactionContextInterface, patientId string, updateJSON string) error {
+    c, err := s.authorize(ctx, "UpdatePrescription")
     if err != nil {
         return err
     }
 
-    // Parse new prescription
-    var newPrescription Prescription
-    err = json.Unmarshal([]byte(prescriptionJSON), &newPrescription)
+    // Parse the update
+    var update PrescriptionUpdate
+    err = json.Unmarshal([]byte(updateJSON), &update)
     if err != nil {
-        return fmt.Errorf("failed to parse prescription JSON: %v", err)
+        return fmt.Errorf("failed to parse prescription update JSON: %v", err)
+    }
+    if update.PrescriptionId == "" {
+        return fmt.Errorf("prescriptionId is required")
+    }
+    if len(update.Changes) == 0 {
+        return fmt.Errorf("an update must change at least one field")
+    }
+    if update.Reason == "" {
+        return fmt.Errorf("a reason is required to amend a prescription")
     }
 
-    // Find and update prescription
-    found := false
-    for i := range asset.Prescriptions {
-        if asset.Prescriptions[i].PrescriptionId == newPrescription.PrescriptionId {
-            // Preserve immutable fields
-            newPrescription.CreatedBy = asset.Prescriptions[i].CreatedBy
-            newPrescription.TxID = ctx.GetStub().GetTxID()
-            newPrescription.Timestamp = time.Now().Format(time.RFC3339)
-            asset.Prescriptions[i] = newPrescription
-            found = true
-            break
-        }
+    policy, err := readAccessPolicy(ctx)
+    if err != nil {
+        return err
     }
 
-    if !found {
-        return fmt.Errorf("prescription %s not found", newPrescription.PrescriptionId)
+    clock, err := newTxClock(ctx)
+    if err != nil {
+        return err
+    }
+
+    // Get existing prescription
+    prescription, err := readPrescription(ctx, patientId, update.PrescriptionId)
+    if err != nil {
+        return err
+    }
+    if c.Role == roleDoctor && !c.prescribed(prescription) {
+        return fmt.Errorf("only the prescribing doctor can update this prescription")
+    }
+    if prescription.Status.IsTerminal() {
+        return fmt.Errorf("prescription %s is %s and can no longer be updated", prescription.PrescriptionId, prescription.Status)
     }
 
-    asset.LastUpdated = time.Now().Format(time.RFC3339)
-    assetJSON, err := json.Marshal(asset)
+    previousStatus := prescription.Status
+    changes, err := prescription.applyUpdate(&update, policy.updatableFields(c.Role), c.Role)
     if err != nil {
         return err
     }
+    if len(changes) == 0 {
+        return fmt.Errorf("update does not change prescription %s", prescription.PrescriptionId)
+    }
+    if changesMedication(changes) {
+        if err := screenMedicationChange(ctx, c, clock, prescription); err != nil {
+            return err
+        }
+    }
+
+    prescription.Amendments = append(prescription.Amendments, Amendment{
+        TxID:      ctx.GetStub().GetTxID(),
+        Timestamp: clock.Timestamp(),
+        AmendedBy: c.EnrollmentID,
+        Role:      c.Role,
+        Reason:    update.Reason,
+        Changes:   changes,
+    })
+    prescription.TxID = ctx.GetStub().GetTxID()
+    prescription.Timestamp = clock.Timestamp()
+
+    if err := putPrescription(ctx, prescription); err != nil {
+        return err
+    }
 
-    return ctx.GetStub().PutState(patientId, assetJSON)
+    return emitPrescriptionEvent(ctx, eventPrescriptionUpdated, c, clock, []PrescriptionEventEntry{newEventEntry(prescription, previousStatus)})
 }
 
 // DispensePrescription - this function allows a pharmacist to dispense a prescription
-// It checks if the prescription is active before dispensing and updates the status to "Dispensed"
+// Each call records a dispensation of the given quantity, or of the rest of the current fill
+// when no quantity is given. The prescription stays "PartiallyDispensed" until the authorized
+// quantity and all refills have been handed out, and then becomes "Dispensed". Prescriptions
+// without a quantity are dispensed in full by a single call.
+// The dispensing pharmacist is taken from the client certificate; a pharmacistId in the
+// payload must match it.
 func (s *SmartContract) DispensePrescription(ctx contractapi.TransactionContextInterface, dispensationJSON string) error {
+    pharmacist, err := s.authorize(ctx, "DispensePrescription")
+    if err != nil {
+        return err
+    }
+
     // Parse the dispensation JSON
     var dispensation struct {
         PatientId       string `json:"patientId"`
         PrescriptionId string `json:"prescriptionId"`
         PharmacistId   string `json:"pharmacistId"`
+        PharmacyId     string `json:"pharmacyId,omitempty"`
+        Quantity       int    `json:"quantity,omitempty"`
         Note           string `json:"note,omitempty"`
     }
     
-    err := json.Unmarshal([]byte(dispensationJSON), &dispensation)
+    err = json.Unmarshal([]byte(dispensationJSON), &dispensation)
     if err != nil {
         return fmt.Errorf("failed to parse dispensation JSON: %v", err)
     }
     
     // Validate fields
-    if dispensation.PatientId == "" || dispensation.PrescriptionId == "" || dispensation.PharmacistId == "" {
-        return fmt.Errorf("patientId, prescriptionId, and pharmacistId are required")
+    if dispensation.PatientId == "" || dispensation.PrescriptionId == "" {
+        return fmt.Errorf("patientId and prescriptionId are required")
+    }
+    if err := pharmacist.checkClaim("pharmacistId", dispensation.PharmacistId); err != nil {
+        return err
     }
 
-    // Get the asset
-    asset, err := s.ReadAsset(ctx, dispensation.PatientId)
+    clock, err := newTxClock(ctx)
     if err != nil {
         return err
     }
 
-    // Find and update prescription
-    found := false
-    for i := range asset.Prescriptions {
-        if asset.Prescriptions[i].PrescriptionId == dispensation.PrescriptionId {
-            // Check prescription status
-            if asset.Prescriptions[i].Status == "Revoked" {
-                return fmt.Errorf("cannot dispense a revoked prescription")
-            }
-            if asset.Prescriptions[i].Status != "Active" {
-                return fmt.Errorf("can only dispense active prescriptions")
-            }
-            
-            // Update prescription status and pharmacist info
-            now := time.Now().Format(time.RFC3339)
-            asset.Prescriptions[i].Status = "Dispensed"
-            asset.Prescriptions[i].TxID = ctx.GetStub().GetTxID()
-            asset.Prescriptions[i].Timestamp = now
-            asset.Prescriptions[i].DispensingPharmacist = dispensation.PharmacistId
-            asset.Prescriptions[i].DispensingTimestamp = now
-            found = true
-            break
-        }
+    // Get the prescription
+    prescription, err := readPrescription(ctx, dispensation.PatientId, dispensation.PrescriptionId)
+    if err != nil {
+        return err
     }
 
-    if !found {
-        return fmt.Errorf("prescription not found")
+    // Record the dispensation; the status follows from what remains to be dispensed.
+    // The pharmacy defaults to the pharmacist's organization.
+    now := clock.Timestamp()
+    previousStatus := prescription.Status
+    err = prescription.dispense(Dispensation{
+        Quantity:     dispensation.Quantity,
+        PharmacistId:  pharmacist.EnrollmentID,
+        PharmacistMSP: pharmacist.MSPID,
+        PharmacyId:    firstNonEmpty(dispensation.PharmacyId, pharmacist.MSPID),
+        TxID:          ctx.GetStub().GetTxID(),
+        Timestamp:     now,
+        Note:          dispensation.Note,
+    })
+    if err != nil {
+        return err
     }
+    prescription.TxID = ctx.GetStub().GetTxID()
+    prescription.Timestamp = now
 
-    // Update asset and save to state
-    asset.LastUpdated = time.Now().Format(time.RFC3339)
-    assetJSON, err := json.Marshal(asset)
-    if err != nil {
+    if err := putPrescription(ctx, prescription); err != nil {
         return err
     }
 
-    return ctx.GetStub().PutState(dispensation.PatientId, assetJSON) 
+    return emitPrescriptionEvent(ctx, eventPrescriptionDispensed, pharmacist, clock, []PrescriptionEventEntry{newEventEntry(prescription, previousStatus)})
 }
 
 // GetAssetHistory - obtain the history of a specific asset(patientId) from the ledger 
+// The history of the patient record is combined with the history of each of the patient's
+// prescriptions, ordered by the time of each write.
 func (s *SmartContract) GetAssetHistory(ctx contractapi.TransactionContextInterface, patientId string) ([]map[string]interface{}, error) {
+    if _, err := s.authorize(ctx, "GetAssetHistory"); err != nil {
+        return nil, err
+    }
+
+    // Earlier versions of the public records do not carry the private fields; they are
+    // shown from the current private details, which updates do not change.
+    patient, err := s.readAsset(ctx, patientId)
+    if err != nil {
+        return nil, err
+    }
+
+    type historyEntry struct {
+        time   time.Time
+        record map[string]interface{}
+    }
+    var entries []historyEntry
+
     historyIterator, err := ctx.GetStub().GetHistoryForKey(patientId)
     if err != nil {
         return nil, err
     }
     defer historyIterator.Close()
 
-    var history []map[string]interface{}
-
     for historyIterator.HasNext() {
         historyData, err := historyIterator.Next()
         if err != nil {
@@ -263,49 +443,116 @@ func (s *SmartContract) GetAssetHistory(ctx contractapi.TransactionContextInterf
                 return nil, err
             }
         }
-
-        record := map[string]interface{}{
-            "patientId":     asset.PatientId,
-            "patientName":   asset.PatientName,
-            "doctorId":      asset.DoctorId,
-            "lastUpdated":   asset.LastUpdated,
-            "prescriptions": []map[string]interface{}{},
-            "timestamp":     historyData.Timestamp.String(),
-            "txId":         historyData.TxId,
+        if asset.PrivateDataHash != "" {
+            asset.PatientName = patient.PatientName
         }
 
+        record := historyRecord(&asset, historyData.Timestamp.String(), historyData.TxId)
         for _, prescription := range asset.Prescriptions {
-            prescriptionRecord := map[string]interface{}{
-                "prescriptionId": prescription.PrescriptionId,
-                "medicationName": prescription.MedicationName,
-                "dosage":        prescription.Dosage,
-                "instructions":  prescription.Instructions,
-                "diagnosis":     prescription.Diagnosis,
-                "status":       prescription.Status,
-                "createdBy":    prescription.CreatedBy,
-                "timestamp":    prescription.Timestamp,
-                "expiryDate":   prescription.ExpiryDate,
+            record["prescriptions"] = append(record["prescriptions"].([]map[string]interface{}), prescriptionHistoryRecord(prescription))
+        }
+        entries = append(entries, historyEntry{time: historyData.Timestamp.AsTime(), record: record})
+    }
+
+    prescriptions, err := listPrescriptions(ctx, patientId)
+    if err != nil {
+        return nil, err
+    }
+    for _, current := range prescriptions {
+        key, err := prescriptionKey(ctx, patientId, current.PrescriptionId)
+        if err != nil {
+            return nil, err
+        }
+
+        prescriptionIterator, err := ctx.GetStub().GetHistoryForKey(key)
+        if err != nil {
+            return nil, err
+        }
+
+        for prescriptionIterator.HasNext() {
+            historyData, err := prescriptionIterator.Next()
+            if err != nil {
+                prescriptionIterator.Close()
+                return nil, err
+            }
+
+            var prescription Prescription
+            if historyData.Value != nil {
+                if err := json.Unmarshal(historyData.Value, &prescription); err != nil {
+                    prescriptionIterator.Close()
+                    return nil, err
+                }
+            }
+            if prescription.PrivateDataHash != "" {
+                prescription.Diagnosis = current.Diagnosis
             }
-            record["prescriptions"] = append(record["prescriptions"].([]map[string]interface{}), prescriptionRecord)
+
+            record := historyRecord(patient, historyData.Timestamp.String(), historyData.TxId)
+            record["prescriptions"] = []map[string]interface{}{prescriptionHistoryRecord(prescription)}
+            entries = append(entries, historyEntry{time: historyData.Timestamp.AsTime(), record: record})
         }
+        prescriptionIterator.Close()
+    }
 
-        history = append(history, record)
+    sort.SliceStable(entries, func(i, j int) bool {
+        return entries[i].time.Before(entries[j].time)
+    })
+
+    var history []map[string]interface{}
+    for _, entry := range entries {
+        history = append(history, entry.record)
     }
 
     return history, nil
 }
 
+// Helper function to build a history record for a version of the patient record
+func historyRecord(asset *Asset, timestamp string, txId string) map[string]interface{} {
+    return map[string]interface{}{
+        "patientId":     asset.PatientId,
+        "patientName":   asset.PatientName,
+        "doctorId":      asset.DoctorId,
+        "lastUpdated":   asset.LastUpdated,
+        "prescriptions": []map[string]interface{}{},
+        "timestamp":     timestamp,
+        "txId":          txId,
+    }
+}
+
+// Helper function to build the history view of a prescription
+func prescriptionHistoryRecord(prescription Prescription) map[string]interface{} {
+    return map[string]interface{}{
+        "prescriptionId": prescription.PrescriptionId,
+        "medicationName": prescription.MedicationName,
+        "dosage":         prescription.Dosage,
+        "instructions":   prescription.Instructions,
+        "diagnosis":      prescription.Diagnosis,
+        "status":         prescription.Status,
+        "createdBy":      prescription.CreatedBy,
+        "timestamp":      prescription.Timestamp,
+        "expiryDate":     prescription.ExpiryDate,
+    }
+}
+
 // GetPrescriptionsByStatus - obtain prescriptions by status
 // This function allows filtering prescriptions based on their status (e.g., Active, Dispensed, Revoked, Expired)
 func (s *SmartContract) GetPrescriptionsByStatus(ctx contractapi.TransactionContextInterface, patientId string, status string) ([]Prescription, error) {
-    asset, err := s.ReadAsset(ctx, patientId)
+    if _, err := s.authorize(ctx, "GetPrescriptionsByStatus"); err != nil {
+        return nil, err
+    }
+    wanted, err := parseStatus(status)
+    if err != nil {
+        return nil, err
+    }
+
+    asset, err := s.readAsset(ctx, patientId)
     if err != nil {
         return nil, err
     }
 
     var filtered []Prescription
     for _, prescription := range asset.Prescriptions {
-        if prescription.Status == status {
+        if prescription.Status == wanted {
             filtered = append(filtered, prescription)
         }
     }
@@ -316,8 +563,13 @@ func (s *SmartContract) GetPrescriptionsByStatus(ctx contractapi.TransactionCont
 // RevokePrescription - revoke an active prescription
 // This function allows a doctor to revoke a prescription, changing its status to "Revoked"
 // and ensuring that only the original prescriber can perform this action.
-// It also checks if the prescription is currently active before revoking it.
+// It also checks that the lifecycle allows revoking the prescription in its current status.
 func (s *SmartContract) RevokePrescriptionJSON(ctx contractapi.TransactionContextInterface, revocationJSON string) error {
+    doctor, err := s.authorize(ctx, "RevokePrescriptionJSON")
+    if err != nil {
+        return err
+    }
+
     // Parse the revocation JSON
     var revocation struct {
         PatientId      string `json:"patientId"`
@@ -325,108 +577,130 @@ func (s *SmartContract) RevokePrescriptionJSON(ctx contractapi.TransactionContex
         DoctorId       string `json:"doctorId"`
     }
     
-    err := json.Unmarshal([]byte(revocationJSON), &revocation)
+    err = json.Unmarshal([]byte(revocationJSON), &revocation)
     if err != nil {
         return fmt.Errorf("failed to parse revocation JSON: %v", err)
     }
     
     // Validate fields
-    if revocation.PatientId == "" || revocation.PrescriptionId == "" || revocation.DoctorId == "" {
-        return fmt.Errorf("patientId, prescriptionId, and doctorId are required")
+    if revocation.PatientId == "" || revocation.PrescriptionId == "" {
+        return fmt.Errorf("patientId and prescriptionId are required")
+    }
+    if err := doctor.checkClaim("doctorId", revocation.DoctorId); err != nil {
+        return err
     }
 
-    // Get the asset
-    asset, err := s.ReadAsset(ctx, revocation.PatientId)
+    clock, err := newTxClock(ctx)
     if err != nil {
         return err
     }
 
-    // Find and update prescription
-    found := false
-    for i := range asset.Prescriptions {
-        if asset.Prescriptions[i].PrescriptionId == revocation.PrescriptionId {
-            // Verify the revoking doctor is the original prescriber
-            if asset.Prescriptions[i].CreatedBy != revocation.DoctorId {
-                return fmt.Errorf("only the prescribing doctor can revoke this prescription")
-            }
-            
-            if asset.Prescriptions[i].Status != "Active" {
-                return fmt.Errorf("can only revoke active prescriptions")
-            }
-            
-            asset.Prescriptions[i].Status = "Revoked"
-            asset.Prescriptions[i].TxID = ctx.GetStub().GetTxID()
-            asset.Prescriptions[i].Timestamp = time.Now().Format(time.RFC3339)
-            found = true
-            break
-        }
+    // Get the prescription
+    prescription, err := readPrescription(ctx, revocation.PatientId, revocation.PrescriptionId)
+    if err != nil {
+        return err
     }
 
-    if !found {
-        return fmt.Errorf("prescription not found")
+    // Verify the revoking doctor is the original prescriber
+    if !doctor.prescribed(prescription) {
+        return fmt.Errorf("only the prescribing doctor can revoke this prescription")
     }
 
-    asset.LastUpdated = time.Now().Format(time.RFC3339)
-    assetJSON, err := json.Marshal(asset)
+    previousStatus := prescription.Status
+    if err := prescription.transition(StatusRevoked, OperationRevoke); err != nil {
+        return err
+    }
+    prescription.TxID = ctx.GetStub().GetTxID()
+    prescription.Timestamp = clock.Timestamp()
+
+    if err := putPrescription(ctx, prescription); err != nil {
+        return err
+    }
+
+    return emitPrescriptionEvent(ctx, eventPrescriptionRevoked, doctor, clock, []PrescriptionEventEntry{newEventEntry(prescription, previousStatus)})
+}
+
+// HoldPrescription - puts a prescription on hold so that it cannot be dispensed until it is released
+func (s *SmartContract) HoldPrescription(ctx contractapi.TransactionContextInterface, patientId string, prescriptionId string) error {
+    c, err := s.authorize(ctx, "HoldPrescription")
     if err != nil {
         return err
     }
+    return changeStatus(ctx, c, patientId, prescriptionId, StatusOnHold, OperationHold, eventPrescriptionOnHold)
+}
 
-    return ctx.GetStub().PutState(revocation.PatientId, assetJSON)
+// ReleasePrescription - releases a prescription from hold, so that it can be dispensed again
+func (s *SmartContract) ReleasePrescription(ctx contractapi.TransactionContextInterface, patientId string, prescriptionId string) error {
+    c, err := s.authorize(ctx, "ReleasePrescription")
+    if err != nil {
+        return err
+    }
+    prescription, err := readPrescription(ctx, patientId, prescriptionId)
+    if err != nil {
+        return err
+    }
+    if prescription.Status != StatusOnHold {
+        return fmt.Errorf("prescription %s is %s, not %s", prescriptionId, prescription.Status, StatusOnHold)
+    }
+    // A prescription that was partly dispensed before the hold returns to PartiallyDispensed
+    next := StatusActive
+    if prescription.hasBeenDispensed() {
+        next = StatusPartiallyDispensed
+    }
+    return changeStatus(ctx, c, patientId, prescriptionId, next, OperationRelease, eventPrescriptionReleased)
 }
 
-// GetUserRole retrieves the user's role from their certificate attributes
-func (s *SmartContract) GetUserRole(ctx contractapi.TransactionContextInterface) (string, error) {
-    // Get the MSP ID and certificate
-    mspID, err := ctx.GetClientIdentity().GetMSPID()
+// Helper function to move a prescription to a new status on behalf of an authorized caller
+// and emit the corresponding event
+func changeStatus(ctx contractapi.TransactionContextInterface, c *caller, patientId string, prescriptionId string, next PrescriptionStatus, operation string, eventName string) error {
+    clock, err := newTxClock(ctx)
     if err != nil {
-        return "", fmt.Errorf("failed to get MSP ID: %v", err)
+        return err
     }
 
-    // Get role attribute from certificate
-    role, ok, err := ctx.GetClientIdentity().GetAttributeValue("role")
+    prescription, err := readPrescription(ctx, patientId, prescriptionId)
     if err != nil {
-        return "", fmt.Errorf("failed to get role attribute: %v", err)
+        return err
     }
-    if !ok {
-        return "", fmt.Errorf("role attribute not found in certificate")
+    // Doctors may only hold or release their own prescriptions
+    if c.Role == roleDoctor && !c.prescribed(prescription) {
+        return fmt.Errorf("only the prescribing doctor can hold or release this prescription")
     }
 
-    // Validate role based on MSP
-    switch mspID {
-    case "Org1MSP": // Doctor's organization
-        if role != "doctor" {
-            return "", fmt.Errorf("invalid role '%s' for organization %s", role, mspID)
-        }
-    case "Org2MSP": // Pharmacist's organization
-        if role != "pharmacist" {
-            return "", fmt.Errorf("invalid role '%s' for organization %s", role, mspID)
-        }
-    default:
-        return "", fmt.Errorf("unknown MSP ID: %s", mspID)
+    previousStatus := prescription.Status
+    if err := prescription.transition(next, operation); err != nil {
+        return err
     }
+    prescription.TxID = ctx.GetStub().GetTxID()
+    prescription.Timestamp = clock.Timestamp()
 
-    return role, nil
+    if err := putPrescription(ctx, prescription); err != nil {
+        return err
+    }
+
+    return emitPrescriptionEvent(ctx, eventName, c, clock, []PrescriptionEventEntry{newEventEntry(prescription, previousStatus)})
 }
 
-// GetPrescriptionsByPatient - get all prescriptions for a patient that a doctor has prescribed
-func (s *SmartContract) GetPrescriptionsByPatient(ctx contractapi.TransactionContextInterface, patientId string) (*Asset, error) {
-    // Get caller's identity and role
-    callerId, err := ctx.GetClientIdentity().GetID()
+// GetUserRole retrieves the user's role, as resolved by the access policy from their MSP ID
+// and certificate attributes
+func (s *SmartContract) GetUserRole(ctx contractapi.TransactionContextInterface) (string, error) {
+    c, err := s.authorize(ctx, "GetUserRole")
     if err != nil {
-        return nil, fmt.Errorf("failed to get caller identity: %v", err)
+        return "", err
     }
+    return c.Role, nil
+}
 
-    role, err := s.GetUserRole(ctx)
+// GetPrescriptionsByPatient - get all prescriptions for a patient that a doctor has prescribed
+func (s *SmartContract) GetPrescriptionsByPatient(ctx contractapi.TransactionContextInterface, patientId string) (*Asset, error) {
+    // Get caller's identity and role
+    doctor, err := s.authorize(ctx, "GetPrescriptionsByPatient")
     if err != nil {
         return nil, err
     }
-    if role != "doctor" {
-        return nil, fmt.Errorf("only doctors can access patient prescriptions")
-    }
 
     // Get the asset
-    asset, err := s.ReadAsset(ctx, patientId)
+    asset, err := s.readAsset(ctx, patientId)
     if err != nil {
         return nil, err
     }
@@ -434,7 +708,7 @@ func (s *SmartContract) GetPrescriptionsByPatient(ctx contractapi.TransactionCon
     // Filter prescriptions to only show those created by this doctor
     filteredPrescriptions := []Prescription{}
     for _, prescription := range asset.Prescriptions {
-        if prescription.CreatedBy == callerId {
+        if doctor.prescribed(&prescription) {
             filteredPrescriptions = append(filteredPrescriptions, prescription)
         }
     }
@@ -444,193 +718,106 @@ func (s *SmartContract) GetPrescriptionsByPatient(ctx contractapi.TransactionCon
 }
 
 // CheckPrescriptionExpiry - checks if a prescription has expired
+// Prescriptions that are already in a terminal status are left unchanged.
 func (s *SmartContract) CheckPrescriptionExpiry(ctx contractapi.TransactionContextInterface, patientId string, prescriptionId string) error {
-    asset, err := s.ReadAsset(ctx, patientId)
+    c, err := s.authorize(ctx, "CheckPrescriptionExpiry")
     if err != nil {
         return err
     }
 
-    for i := range asset.Prescriptions {
-        if asset.Prescriptions[i].PrescriptionId == prescriptionId {
-            expiryDate, err := time.Parse("2006-01-02", asset.Prescriptions[i].ExpiryDate)
-            if err != nil {
-                return fmt.Errorf("invalid expiry date format: %v", err)
-            }
-
-            if time.Now().After(expiryDate) {
-                asset.Prescriptions[i].Status = "Expired"
-                asset.Prescriptions[i].TxID = ctx.GetStub().GetTxID()
-                asset.Prescriptions[i].Timestamp = time.Now().Format(time.RFC3339)
-
-                assetJSON, err := json.Marshal(asset)
-                if err != nil {
-                    return err
-                }
-                return ctx.GetStub().PutState(patientId, assetJSON)
-            }
-            return nil
-        }
-    }
-
-    return fmt.Errorf("prescription not found")
-}
-
-// GetPrescriptionAnalytics - get analytics for prescriptions by doctor/pharmacist
-func (s *SmartContract) GetPrescriptionAnalytics(ctx contractapi.TransactionContextInterface, startDate string, endDate string) (map[string]interface{}, error) {
-    iterator, err := ctx.GetStub().GetStateByRange("", "")
+    prescription, err := readPrescription(ctx, patientId, prescriptionId)
     if err != nil {
-        return nil, err
-    }
-    defer iterator.Close()
-
-    analytics := map[string]interface{}{
-        "totalPrescriptions": 0,
-        "activeCount": 0,
-        "dispensedCount": 0,
-        "expiryCount": 0,
-        "medicationFrequency": make(map[string]int),
-        "diagnosisFrequency": make(map[string]int),
-        "averageDispenseTime": 0.0,
-    }
-
-    for iterator.HasNext() {
-        queryResponse, err := iterator.Next()
-        if err != nil {
-            continue
-        }
-
-        var asset Asset
-        if err := json.Unmarshal(queryResponse.Value, &asset); err != nil {
-            continue
-        }
-
-        for _, prescription := range asset.Prescriptions {
-            analytics["totalPrescriptions"] = analytics["totalPrescriptions"].(int) + 1
-            
-            // Track medication frequency
-            if count, exists := analytics["medicationFrequency"].(map[string]int)[prescription.MedicationName]; exists {
-                analytics["medicationFrequency"].(map[string]int)[prescription.MedicationName] = count + 1
-            } else {
-                analytics["medicationFrequency"].(map[string]int)[prescription.MedicationName] = 1
-            }
-
-            // Track diagnosis frequency
-            if count, exists := analytics["diagnosisFrequency"].(map[string]int)[prescription.Diagnosis]; exists {
-                analytics["diagnosisFrequency"].(map[string]int)[prescription.Diagnosis] = count + 1
-            } else {
-                analytics["diagnosisFrequency"].(map[string]int)[prescription.Diagnosis] = 1
-            }
-
-            // Track status counts
-            switch prescription.Status {
-            case "Active":
-                analytics["activeCount"] = analytics["activeCount"].(int) + 1
-            case "Dispensed":
-                analytics["dispensedCount"] = analytics["dispensedCount"].(int) + 1
-            case "Expired":
-                analytics["expiryCount"] = analytics["expiryCount"].(int) + 1
-            }
-        }
+        return err
     }
 
-    return analytics, nil
-}
-
-// CheckMedicationInteractions - checks for potential interactions between medications
-func (s *SmartContract) CheckMedicationInteractions(ctx contractapi.TransactionContextInterface, patientId string, newMedication string) ([]string, error) {
-    asset, err := s.ReadAsset(ctx, patientId)
+    clock, err := newTxClock(ctx)
     if err != nil {
-        return nil, err
+        return err
     }
 
-    // Sample interaction check - in production would connect to a medical database
-    knownInteractions := map[string][]string{
-        "Aspirin": {"Warfarin", "Heparin"},
-        "Ibuprofen": {"Aspirin", "Warfarin"},
-        "Warfarin": {"Aspirin", "Ibuprofen"},
+    expired, err := clock.IsExpired(prescription.ExpiryDate)
+    if err != nil {
+        return err
     }
-
-    var interactions []string
-    if interactsWith, exists := knownInteractions[newMedication]; exists {
-        for _, prescription := range asset.Prescriptions {
-            if prescription.Status == "Active" {
-                for _, interactor := range interactsWith {
-                    if prescription.MedicationName == interactor {
-                        interactions = append(interactions, fmt.Sprintf("Warning: %s interacts with active medication %s (prescribed for %s)", newMedication, interactor, prescription.Diagnosis))
-                    }
-                }
-            }
-        }
+    if !expired || !prescription.Status.CanTransitionTo(StatusExpired) {
+        return nil
     }
 
-    return interactions, nil
-}
-
-// BatchCreatePrescriptions - create multiple prescriptions in a single transaction
-func (s *SmartContract) BatchCreatePrescriptions(ctx contractapi.TransactionContextInterface, assetsJSON string) error {
-    var assets []Asset
-    err := json.Unmarshal([]byte(assetsJSON), &assets)
-    if err != nil {
-        return fmt.Errorf("failed to parse assets JSON: %v", err)
+    previousStatus := prescription.Status
+    if err := prescription.transition(StatusExpired, OperationExpire); err != nil {
+        return err
     }
+    prescription.TxID = ctx.GetStub().GetTxID()
+    prescription.Timestamp = clock.Timestamp()
 
-    for _, asset := range assets {
-        assetJSON, err := json.Marshal(asset)
-        if err != nil {
-            return err
-        }
-        if err := s.CreateAsset(ctx, string(assetJSON)); err != nil {
-            return err
-        }
+    if err := putPrescription(ctx, prescription); err != nil {
+        return err
     }
 
-    return nil
+    return emitPrescriptionEvent(ctx, eventPrescriptionExpired, c, clock, []PrescriptionEventEntry{newEventEntry(prescription, previousStatus)})
 }
 
+// CheckMedicationInteractions - checks for potential interactions between medications
+// The medication is looked up in the interaction catalogue by name, alias or code and checked
+// against each of the patient's active, on-hold and partially dispensed prescriptions, in
+// either direction. Medications the catalogue does not know have no findings.
+func (s *SmartContract) CheckMedicationInteractions(ctx contractapi.TransactionContextInterface, patientId string, newMedication string) ([]InteractionFinding, error) {
+    if _, err := s.authorize(ctx, "CheckMedicationInteractions"); err != nil {
+        return nil, err
+    }
+
+    asset, err := s.readAsset(ctx, patientId)
+    if err != nil {
+        return nil, err
+    }
+
+    interactions, err := findInteractions(newMedicationCodes(ctx), &Prescription{MedicationName: newMedication}, asset.Prescriptions)
+    if err != nil {
+        return nil, err
+    }
+    if interactions == nil {
+        interactions = []InteractionFinding{}
+    }
+    return interactions, nil
+}
+
 // GetPrescriptionsByDoctor - returns all prescriptions created by the specified doctor
+// The doctor is named by MSP-qualified identity, such as Org1MSP/doctor1; a bare enrollment ID
+// names an Org1MSP doctor. The prescriptions are found through the doctor~prescription index
+// rather than by scanning the ledger. Legacy prescriptions are indexed when MigrateAssets moves
+// them to their own keys.
 func (s *SmartContract) GetPrescriptionsByDoctor(ctx contractapi.TransactionContextInterface, doctorId string) ([]map[string]interface{}, error) {
-    iterator, err := ctx.GetStub().GetStateByRange("", "")
+    if _, err := s.authorize(ctx, "GetPrescriptionsByDoctor"); err != nil {
+        return nil, err
+    }
+
+    prescriptions, err := listIndexedPrescriptions(ctx, doctorIndex, qualifyID(doctorId, legacyDoctorMSPID))
     if err != nil {
-        return nil, fmt.Errorf("failed to get state by range: %v", err)
+        return nil, err
     }
-    defer iterator.Close()
+    names := newPatientNames(ctx)
 
     var results []map[string]interface{}
-
-    for iterator.HasNext() {
-        queryResponse, err := iterator.Next()
+    for _, prescription := range prescriptions {
+        patientName, err := names.get(prescription.PatientId)
         if err != nil {
-            return nil, fmt.Errorf("failed to get next result: %v", err)
-        }
-
-        var asset Asset
-        if err := json.Unmarshal(queryResponse.Value, &asset); err != nil {
-            continue // Skip malformed records but continue processing others
+            return nil, err
         }
 
-        for _, prescription := range asset.Prescriptions {
-            if prescription.CreatedBy == doctorId {
-                // Validate required fields
-                if prescription.PrescriptionId == "" {
-                    continue // Skip prescriptions without IDs
-                }
-
-                prescriptionData := map[string]interface{}{
-                    "Diagnosis":       firstNonEmpty(prescription.Diagnosis, "Not specified"),
-                    "Dosage":          firstNonEmpty(prescription.Dosage, "Not specified"),
-                    "ExpiryDate":      prescription.ExpiryDate,
-                    "Instructions":    firstNonEmpty(prescription.Instructions, "Not specified"),
-                    "MedicationName":  firstNonEmpty(prescription.MedicationName, "Not specified"),
-                    "PatientId":       asset.PatientId,
-                    "PatientName":     firstNonEmpty(asset.PatientName, "Unknown"),
-                    "PrescriptionId":  prescription.PrescriptionId,
-                    "Status":          firstNonEmpty(prescription.Status, "Unknown"),
-                    "Timestamp":       firstNonEmpty(prescription.Timestamp, time.Now().Format(time.RFC3339)),
-                    "TxID":            firstNonEmpty(prescription.TxID, "Not available"),
-                }
-                results = append(results, prescriptionData)
-            }
+        prescriptionData := map[string]interface{}{
+            "Diagnosis":       firstNonEmpty(prescription.Diagnosis, "Not specified"),
+            "Dosage":          firstNonEmpty(prescription.Dosage, "Not specified"),
+            "ExpiryDate":      prescription.ExpiryDate,
+            "Instructions":    firstNonEmpty(prescription.Instructions, "Not specified"),
+            "MedicationName":  firstNonEmpty(prescription.MedicationName, "Not specified"),
+            "PatientId":       prescription.PatientId,
+            "PatientName":     firstNonEmpty(patientName, "Unknown"),
+            "PrescriptionId":  prescription.PrescriptionId,
+            "Status":          firstNonEmpty(string(prescription.Status), "Unknown"),
+            "Timestamp":       firstNonEmpty(prescription.Timestamp, "Not available"),
+            "TxID":            firstNonEmpty(prescription.TxID, "Not available"),
         }
+        results = append(results, prescriptionData)
     }
 
     if len(results) == 0 {
@@ -650,52 +837,54 @@ func firstNonEmpty(values ...string) string {
     return ""
 }
 
-// Helper function to generate random ID
-func generateId() string {
-    return fmt.Sprintf("%x", rand.Int63())
+// Helper function to derive a prescription ID from the transaction ID and the prescription's
+// position within the transaction. Every endorser computes the same ID.
+func newPrescriptionId(txId string, position int) string {
+    if len(txId) > 16 {
+        txId = txId[:16]
+    }
+    return fmt.Sprintf("RX-%s-%d", txId, position)
 }
 
 // GetDispenseHistory - get all prescriptions dispensed by a specific pharmacist
+// This includes prescriptions the pharmacist dispensed in part. The pharmacist is named by
+// MSP-qualified identity, such as Org2MSP/pharmacist1; a bare enrollment ID names an Org2MSP
+// pharmacist. They are found through the pharmacist~prescription index rather than by
+// scanning the ledger.
 func (s *SmartContract) GetDispenseHistory(ctx contractapi.TransactionContextInterface, pharmacistId string) ([]map[string]interface{}, error) {
-    iterator, err := ctx.GetStub().GetStateByRange("", "")
+    if _, err := s.authorize(ctx, "GetDispenseHistory"); err != nil {
+        return nil, err
+    }
+
+    prescriptions, err := listIndexedPrescriptions(ctx, pharmacistIndex, qualifyID(pharmacistId, legacyPharmacistMSPID))
     if err != nil {
         return nil, err
     }
-    defer iterator.Close()
+    names := newPatientNames(ctx)
 
     var dispensedPrescriptions []map[string]interface{}
-
-    for iterator.HasNext() {
-        queryResponse, err := iterator.Next()
+    for _, prescription := range prescriptions {
+        patientName, err := names.get(prescription.PatientId)
         if err != nil {
-            continue
+            return nil, err
         }
 
-        var asset Asset
-        if err := json.Unmarshal(queryResponse.Value, &asset); err != nil {
-            continue
+        prescriptionData := map[string]interface{}{
+            "PrescriptionId":      prescription.PrescriptionId,
+            "PatientId":           prescription.PatientId,
+            "PatientName":         patientName,
+            "MedicationName":      prescription.MedicationName,
+            "Dosage":              prescription.Dosage,
+            "Instructions":        prescription.Instructions,
+            "Diagnosis":           prescription.Diagnosis,
+            "Status":              prescription.Status,
+            "CreatedBy":           prescription.CreatedBy,
+            "DispensingTimestamp": prescription.DispensingTimestamp,
+            "TxID":                prescription.TxID,
         }
 
-        for _, prescription := range asset.Prescriptions {
-            if prescription.DispensingPharmacist == pharmacistId {
-                prescriptionData := map[string]interface{}{
-                    "PrescriptionId":      prescription.PrescriptionId,
-                    "PatientId":           asset.PatientId,
-                    "PatientName":         asset.PatientName,
-                    "MedicationName":      prescription.MedicationName,
-                    "Dosage":              prescription.Dosage,
-                    "Instructions":        prescription.Instructions,
-                    "Diagnosis":           prescription.Diagnosis,
-                    "Status":              prescription.Status,
-                    "CreatedBy":           prescription.CreatedBy,
-                    "DispensingTimestamp": prescription.DispensingTimestamp,
-                    "TxID":                prescription.TxID,
-                }
-                
-                dispensedPrescriptions = append(dispensedPrescriptions, prescriptionData)
-            }
-        }
+        dispensedPrescriptions = append(dispensedPrescriptions, prescriptionData)
     }
 
     return dispensedPrescriptions, nil
-}
\ No newline at end of file
+}
\ No newline at end of file
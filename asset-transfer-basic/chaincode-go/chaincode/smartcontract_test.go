@@ -0,0 +1,590 @@
+package chaincode_test
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric-chaincode-go/v2/pkg/cid"
+	"github.com/hyperledger/fabric-chaincode-go/v2/shim"
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+	"github.com/hyperledger/fabric-protos-go-apiv2/ledger/queryresult"
+	"github.com/hyperledger/fabric-protos-go-apiv2/peer"
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode"
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode/mocks"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+//go:generate counterfeiter -o mocks/transaction.go -fake-name TransactionContext . transactionContext
+type transactionContext interface {
+	contractapi.TransactionContextInterface
+}
+
+//go:generate counterfeiter -o mocks/chaincodestub.go -fake-name ChaincodeStub . chaincodeStub
+type chaincodeStub interface {
+	shim.ChaincodeStubInterface
+}
+
+//go:generate counterfeiter -o mocks/clientidentity.go -fake-name ClientIdentity . clientIdentity
+type clientIdentity interface {
+	cid.ClientIdentity
+}
+
+//go:generate counterfeiter -o mocks/statequeryiterator.go -fake-name StateQueryIterator . stateQueryIterator
+type stateQueryIterator interface {
+	shim.StateQueryIteratorInterface
+}
+
+const testTxID = "4a4e3bdbd2f6e1d3a3f1b2c0e5f6a7b8c9d0e1f2a3b4c5d6e7f8091a2b3c4d5e"
+
+var testTxTime = time.Date(2025, time.March, 14, 9, 30, 0, 0, time.UTC)
+
+// ledger is a minimal in-memory world state backing a mocks.ChaincodeStub.
+type ledger map[string][]byte
+
+func (l ledger) clone() ledger {
+	c := ledger{}
+	for k, v := range l {
+		c[k] = append([]byte(nil), v...)
+	}
+	return c
+}
+
+// iterator returns the entries whose keys match, in key order, as the peer would.
+func (l ledger) iterator(match func(key string) bool) *mocks.StateQueryIterator {
+	var keys []string
+	for key := range l {
+		if match(key) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	iterator := &mocks.StateQueryIterator{}
+	iterator.HasNextCalls(func() bool {
+		return len(keys) > 0
+	})
+	iterator.NextCalls(func() (*queryresult.KV, error) {
+		key := keys[0]
+		keys = keys[1:]
+		return &queryresult.KV{Key: key, Value: l[key]}, nil
+	})
+	return iterator
+}
+
+// page returns up to pageSize matching entries, starting at the bookmark key, and the
+// metadata carrying the key that starts the next page, as a paginated query does.
+func (l ledger) page(match func(key string) bool, pageSize int32, bookmark string) (*mocks.StateQueryIterator, *peer.QueryResponseMetadata) {
+	var keys []string
+	for key := range l {
+		if match(key) && key >= bookmark {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	next := ""
+	if len(keys) > int(pageSize) {
+		next = keys[pageSize]
+		keys = keys[:pageSize]
+	}
+	selected := map[string]bool{}
+	for _, key := range keys {
+		selected[key] = true
+	}
+	return l.iterator(func(key string) bool { return selected[key] }), &peer.QueryResponseMetadata{FetchedRecordsCount: int32(len(keys)), Bookmark: next}
+}
+
+// privateKey returns the key under which a ledger holds private data of a collection. It
+// starts with a null byte so that range and partial composite key queries skip it.
+func privateKey(collection string, key string) string {
+	return "\x00private\x00" + collection + "\x00" + key
+}
+
+// newIdentity returns a client identity carrying the attributes Fabric CA puts in an
+// enrolled user's certificate.
+func newIdentity(mspID string, enrollmentID string, attributes map[string]string) *mocks.ClientIdentity {
+	identity := &mocks.ClientIdentity{}
+	identity.GetMSPIDReturns(mspID, nil)
+	identity.GetAttributeValueCalls(func(name string) (string, bool, error) {
+		if name == "hf.EnrollmentID" {
+			return enrollmentID, true, nil
+		}
+		value, ok := attributes[name]
+		return value, ok, nil
+	})
+	return identity
+}
+
+func doctorIdentity(enrollmentID string) *mocks.ClientIdentity {
+	return newIdentity("Org1MSP", enrollmentID, map[string]string{"role": "doctor", "hf.Type": "client"})
+}
+
+func pharmacistIdentity(enrollmentID string) *mocks.ClientIdentity {
+	return newIdentity("Org2MSP", enrollmentID, map[string]string{"role": "pharmacist", "hf.Type": "client"})
+}
+
+func adminIdentity(mspID string, enrollmentID string) *mocks.ClientIdentity {
+	return newIdentity(mspID, enrollmentID, map[string]string{"hf.Type": "admin"})
+}
+
+// newEndorsement prepares a transaction context as a single endorsing peer would see it
+// for the proposal identified by testTxID and txTime, submitted by identity. As on a peer,
+// reads and queries see the state committed before the proposal and not its own writes;
+// the writes are applied to state, as if the transaction then committed.
+func newEndorsement(state ledger, txTime time.Time, identity *mocks.ClientIdentity) (*mocks.TransactionContext, *mocks.ChaincodeStub) {
+	chaincodeStub := &mocks.ChaincodeStub{}
+	chaincodeStub.GetTxIDReturns(testTxID)
+	chaincodeStub.GetTxTimestampReturns(timestamppb.New(txTime), nil)
+	chaincodeStub.CreateCompositeKeyCalls(shim.CreateCompositeKey)
+	chaincodeStub.SplitCompositeKeyCalls((&shim.ChaincodeStub{}).SplitCompositeKey)
+	committed := state.clone()
+	chaincodeStub.GetStateCalls(func(key string) ([]byte, error) {
+		return committed[key], nil
+	})
+	chaincodeStub.PutStateCalls(func(key string, value []byte) error {
+		state[key] = value
+		return nil
+	})
+	chaincodeStub.DelStateCalls(func(key string) error {
+		delete(state, key)
+		return nil
+	})
+	chaincodeStub.GetPrivateDataCalls(func(collection string, key string) ([]byte, error) {
+		return committed[privateKey(collection, key)], nil
+	})
+	chaincodeStub.PutPrivateDataCalls(func(collection string, key string, value []byte) error {
+		state[privateKey(collection, key)] = value
+		return nil
+	})
+	chaincodeStub.GetStateByRangeCalls(func(startKey string, endKey string) (shim.StateQueryIteratorInterface, error) {
+		return committed.iterator(func(key string) bool {
+			// Range queries only cover simple keys; composite keys start with a null byte.
+			return !strings.HasPrefix(key, "\x00") && key >= startKey && (endKey == "" || key < endKey)
+		}), nil
+	})
+	chaincodeStub.GetStateByRangeWithPaginationCalls(func(startKey string, endKey string, pageSize int32, bookmark string) (shim.StateQueryIteratorInterface, *peer.QueryResponseMetadata, error) {
+		iterator, metadata := committed.page(func(key string) bool {
+			return !strings.HasPrefix(key, "\x00") && key >= startKey && (endKey == "" || key < endKey)
+		}, pageSize, bookmark)
+		return iterator, metadata, nil
+	})
+	// The ledger behaves like LevelDB, which rejects rich queries.
+	chaincodeStub.GetQueryResultWithPaginationReturns(nil, nil, errors.New("ExecuteQueryWithPagination not supported for leveldb"))
+	chaincodeStub.GetStateByPartialCompositeKeyWithPaginationCalls(func(objectType string, attributes []string, pageSize int32, bookmark string) (shim.StateQueryIteratorInterface, *peer.QueryResponseMetadata, error) {
+		prefix, err := shim.CreateCompositeKey(objectType, attributes)
+		if err != nil {
+			return nil, nil, err
+		}
+		iterator, metadata := committed.page(func(key string) bool {
+			return strings.HasPrefix(key, prefix)
+		}, pageSize, bookmark)
+		return iterator, metadata, nil
+	})
+	chaincodeStub.GetStateByPartialCompositeKeyCalls(func(objectType string, attributes []string) (shim.StateQueryIteratorInterface, error) {
+		prefix, err := shim.CreateCompositeKey(objectType, attributes)
+		if err != nil {
+			return nil, err
+		}
+		return committed.iterator(func(key string) bool {
+			return strings.HasPrefix(key, prefix)
+		}), nil
+	})
+
+	transactionContext := &mocks.TransactionContext{}
+	transactionContext.GetStubReturns(chaincodeStub)
+	transactionContext.GetClientIdentityReturns(identity)
+	return transactionContext, chaincodeStub
+}
+
+// withPHI submits phiJSON as the transient private fields of the proposal.
+func withPHI(ctx contractapi.TransactionContextInterface, phiJSON string) {
+	ctx.GetStub().(*mocks.ChaincodeStub).GetTransientReturns(map[string][]byte{"phi": []byte(phiJSON)}, nil)
+}
+
+// endorseTwice simulates two peers endorsing the same proposal against the same
+// initial state and returns the resulting world states.
+func endorseTwice(t *testing.T, initial ledger, identity *mocks.ClientIdentity, invoke func(ctx contractapi.TransactionContextInterface) error) (ledger, ledger) {
+	t.Helper()
+
+	first := initial.clone()
+	ctx, _ := newEndorsement(first, testTxTime, identity)
+	require.NoError(t, invoke(ctx))
+
+	second := initial.clone()
+	ctx, _ = newEndorsement(second, testTxTime, identity)
+	require.NoError(t, invoke(ctx))
+
+	return first, second
+}
+
+// patientState stores a patient the way the chaincode does, with each prescription under
+// its own key.
+func patientState(t *testing.T, asset chaincode.Asset) ledger {
+	t.Helper()
+	state := ledger{}
+	for _, prescription := range asset.Prescriptions {
+		prescription.PatientId = asset.PatientId
+		key, err := shim.CreateCompositeKey("prescription", []string{asset.PatientId, prescription.PrescriptionId})
+		require.NoError(t, err)
+		state[key], err = json.Marshal(prescription)
+		require.NoError(t, err)
+		for _, indexKey := range indexKeys(t, prescription) {
+			state[indexKey] = []byte{0x00}
+		}
+	}
+
+	asset.Prescriptions = nil
+	assetJSON, err := json.Marshal(asset)
+	require.NoError(t, err)
+	state[asset.PatientId] = assetJSON
+	return state
+}
+
+// indexKeys returns the secondary index entries the chaincode keeps for a stored prescription.
+func indexKeys(t *testing.T, prescription chaincode.Prescription) []string {
+	t.Helper()
+	doctorMSP := prescription.CreatedByMSP
+	if doctorMSP == "" {
+		doctorMSP = "Org1MSP"
+	}
+	entries := [][]string{{"doctor~prescription", doctorMSP + "/" + prescription.CreatedBy}, {"status~prescription", string(prescription.Status)}}
+	if prescription.ExpiryDate != "" && prescription.Status.CanTransitionTo(chaincode.StatusExpired) {
+		entries = append(entries, []string{"expiry~prescription", prescription.ExpiryDate})
+	}
+	pharmacists := map[string]bool{}
+	if prescription.DispensingPharmacist != "" && len(prescription.Dispensations) == 0 {
+		pharmacists["Org2MSP/"+prescription.DispensingPharmacist] = true
+	}
+	for _, dispensation := range prescription.Dispensations {
+		pharmacistMSP := dispensation.PharmacistMSP
+		if pharmacistMSP == "" {
+			pharmacistMSP = "Org2MSP"
+		}
+		pharmacists[pharmacistMSP+"/"+dispensation.PharmacistId] = true
+	}
+	for pharmacistId := range pharmacists {
+		entries = append(entries, []string{"pharmacist~prescription", pharmacistId})
+	}
+
+	var keys []string
+	for _, entry := range entries {
+		key, err := shim.CreateCompositeKey(entry[0], []string{entry[1], prescription.PatientId, prescription.PrescriptionId})
+		require.NoError(t, err)
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// legacyPatientState stores a patient with its prescriptions inline, as records written
+// before prescriptions had their own keys.
+func legacyPatientState(t *testing.T, asset chaincode.Asset) ledger {
+	t.Helper()
+	assetJSON, err := json.Marshal(asset)
+	require.NoError(t, err)
+	return ledger{asset.PatientId: assetJSON}
+}
+
+func activePatient(t *testing.T) ledger {
+	return patientState(t, activePatientAsset())
+}
+
+func activePatientAsset() chaincode.Asset {
+	return chaincode.Asset{
+		DoctorId:    "doctor1",
+		PatientName: "Jane Banda",
+		PatientId:   "patient1",
+		Prescriptions: []chaincode.Prescription{
+			{
+				PrescriptionId: "rx1",
+				MedicationName: "Amoxicillin",
+				Dosage:         "500mg",
+				Diagnosis:      "Otitis media",
+				Status:         "Active",
+				CreatedBy:      "doctor1",
+				TxID:           "previous",
+				Timestamp:      "2025-03-01T08:00:00Z",
+				ExpiryDate:     "2025-04-01",
+			},
+		},
+		LastUpdated: "2025-03-01T08:00:00Z",
+	}
+}
+
+// readPatient returns the aggregated asset as ReadAsset presents it.
+func readPatient(t *testing.T, state ledger, patientId string) chaincode.Asset {
+	t.Helper()
+	transactionContext, _ := newEndorsement(state, testTxTime, doctorIdentity("doctor1"))
+	smartContract := chaincode.SmartContract{}
+	asset, err := smartContract.ReadAsset(transactionContext, patientId)
+	require.NoError(t, err)
+	return *asset
+}
+
+func TestCreateAssetUsesTransactionTimestamp(t *testing.T) {
+	state := ledger{}
+	transactionContext, _ := newEndorsement(state, testTxTime, doctorIdentity("doctor1"))
+
+	smartContract := chaincode.SmartContract{}
+	withPHI(transactionContext, `{"PatientName":"Jane Banda","Salt":"0123456789abcdef","Diagnoses":["Otitis media"]}`)
+	_, err := smartContract.CreateAsset(transactionContext, `{"PatientId":"patient1","DoctorId":"doctor1","Prescriptions":[{"MedicationName":"Amoxicillin"}]}`)
+	require.NoError(t, err)
+
+	asset := readPatient(t, state, "patient1")
+	require.Equal(t, "2025-03-14T09:30:00Z", asset.LastUpdated)
+	require.Len(t, asset.Prescriptions, 1)
+	require.Equal(t, "2025-03-14T09:30:00Z", asset.Prescriptions[0].Timestamp)
+	require.Equal(t, "2025-04-14", asset.Prescriptions[0].ExpiryDate)
+	require.Equal(t, testTxID, asset.Prescriptions[0].TxID)
+}
+
+func TestCreateAssetFailsWithoutTransactionTimestamp(t *testing.T) {
+	transactionContext, chaincodeStub := newEndorsement(ledger{}, testTxTime, doctorIdentity("doctor1"))
+	chaincodeStub.GetTxTimestampReturns(nil, nil)
+
+	smartContract := chaincode.SmartContract{}
+	withPHI(transactionContext, `{"Salt":"0123456789abcdef","Diagnoses":["Otitis media"]}`)
+	_, err := smartContract.CreateAsset(transactionContext, `{"PatientId":"patient1","DoctorId":"doctor1","Prescriptions":[{}]}`)
+	require.EqualError(t, err, "transaction timestamp is not set")
+	require.Equal(t, 0, chaincodeStub.PutStateCallCount())
+}
+
+func TestEndorsementsProduceIdenticalState(t *testing.T) {
+	smartContract := chaincode.SmartContract{}
+
+	tests := []struct {
+		name     string
+		initial  ledger
+		identity *mocks.ClientIdentity
+		invoke   func(ctx contractapi.TransactionContextInterface) error
+	}{
+		{
+			name:     "CreateAsset new patient",
+			initial:  ledger{},
+			identity: doctorIdentity("doctor1"),
+			invoke: func(ctx contractapi.TransactionContextInterface) error {
+				withPHI(ctx, `{"PatientName":"Jane Banda","Salt":"0123456789abcdef","Diagnoses":["Otitis media"]}`)
+				_, err := smartContract.CreateAsset(ctx, `{"PatientId":"patient1","DoctorId":"doctor1","Prescriptions":[{}]}`)
+				return err
+			},
+		},
+		{
+			name:     "CreateAsset existing patient",
+			initial:  activePatient(t),
+			identity: doctorIdentity("doctor1"),
+			invoke: func(ctx contractapi.TransactionContextInterface) error {
+				withPHI(ctx, `{"Salt":"0123456789abcdef","Diagnoses":["Hypertension"]}`)
+				_, err := smartContract.CreateAsset(ctx, `{"PatientId":"patient1","DoctorId":"doctor1","Prescriptions":[{}]}`)
+				return err
+			},
+		},
+		{
+			name:     "UpdatePrescription",
+			initial:  activePatient(t),
+			identity: doctorIdentity("doctor1"),
+			invoke: func(ctx contractapi.TransactionContextInterface) error {
+				return smartContract.UpdatePrescription(ctx, "patient1", `{"PrescriptionId":"rx1","Reason":"Dose adjusted for weight","Changes":{"Dosage":"250mg"}}`)
+			},
+		},
+		{
+			name:     "DispensePrescription",
+			initial:  activePatient(t),
+			identity: pharmacistIdentity("pharmacist1"),
+			invoke: func(ctx contractapi.TransactionContextInterface) error {
+				return smartContract.DispensePrescription(ctx, `{"patientId":"patient1","prescriptionId":"rx1","pharmacistId":"pharmacist1"}`)
+			},
+		},
+		{
+			name:     "RevokePrescriptionJSON",
+			initial:  activePatient(t),
+			identity: doctorIdentity("doctor1"),
+			invoke: func(ctx contractapi.TransactionContextInterface) error {
+				return smartContract.RevokePrescriptionJSON(ctx, `{"patientId":"patient1","prescriptionId":"rx1","doctorId":"doctor1"}`)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			first, second := endorseTwice(t, tt.initial, tt.identity, tt.invoke)
+			require.Equal(t, first, second)
+			require.NotEqual(t, tt.initial, first, "transaction should have written state")
+			asset := readPatient(t, first, "patient1")
+			require.Equal(t, "2025-03-14T09:30:00Z", asset.LastUpdated)
+		})
+	}
+}
+
+func TestCheckPrescriptionExpiryUsesTransactionTimestamp(t *testing.T) {
+	smartContract := chaincode.SmartContract{}
+
+	// Expiry date 2025-04-01 has not passed at the transaction time.
+	state := activePatient(t)
+	transactionContext, chaincodeStub := newEndorsement(state, testTxTime, pharmacistIdentity("pharmacist1"))
+	require.NoError(t, smartContract.CheckPrescriptionExpiry(transactionContext, "patient1", "rx1"))
+	require.Equal(t, 0, chaincodeStub.PutStateCallCount())
+
+	// The same prescription checked in a later transaction is expired, identically on every peer.
+	later := testTxTime.AddDate(0, 1, 0)
+	first := activePatient(t)
+	transactionContext, _ = newEndorsement(first, later, pharmacistIdentity("pharmacist1"))
+	require.NoError(t, smartContract.CheckPrescriptionExpiry(transactionContext, "patient1", "rx1"))
+
+	second := activePatient(t)
+	transactionContext, _ = newEndorsement(second, later, pharmacistIdentity("pharmacist1"))
+	require.NoError(t, smartContract.CheckPrescriptionExpiry(transactionContext, "patient1", "rx1"))
+
+	require.Equal(t, first, second)
+	asset := readPatient(t, first, "patient1")
+	require.Equal(t, chaincode.StatusExpired, asset.Prescriptions[0].Status)
+	require.Equal(t, "2025-04-14T09:30:00Z", asset.Prescriptions[0].Timestamp)
+}
+
+func TestCreateAssetRecordsCertificateIdentity(t *testing.T) {
+	state := ledger{}
+	transactionContext, _ := newEndorsement(state, testTxTime, doctorIdentity("doctor1"))
+
+	smartContract := chaincode.SmartContract{}
+	withPHI(transactionContext, `{"Salt":"0123456789abcdef","Diagnoses":["Otitis media"]}`)
+	_, err := smartContract.CreateAsset(transactionContext, `{"PatientId":"patient1","Prescriptions":[{}]}`)
+	require.NoError(t, err)
+
+	asset := readPatient(t, state, "patient1")
+	require.Equal(t, "doctor1", asset.DoctorId)
+	require.Equal(t, "doctor1", asset.Prescriptions[0].CreatedBy)
+}
+
+func TestCreateAssetRejectsImpersonation(t *testing.T) {
+	smartContract := chaincode.SmartContract{}
+
+	transactionContext, chaincodeStub := newEndorsement(ledger{}, testTxTime, doctorIdentity("doctor2"))
+	withPHI(transactionContext, `{"Salt":"0123456789abcdef","Diagnoses":["Otitis media"]}`)
+	_, err := smartContract.CreateAsset(transactionContext, `{"PatientId":"patient1","DoctorId":"doctor1","Prescriptions":[{}]}`)
+	require.EqualError(t, err, "doctorId 'doctor1' does not match the submitting identity 'doctor2'")
+	require.Equal(t, 0, chaincodeStub.PutStateCallCount())
+
+	transactionContext, chaincodeStub = newEndorsement(ledger{}, testTxTime, pharmacistIdentity("pharmacist1"))
+	_, err = smartContract.CreateAsset(transactionContext, `{"PatientId":"patient1","Prescriptions":[{}]}`)
+	require.EqualError(t, err, "caller pharmacist1 with role 'pharmacist' is not permitted to call CreateAsset")
+	require.Equal(t, 0, chaincodeStub.PutStateCallCount())
+
+	transactionContext, chaincodeStub = newEndorsement(ledger{}, testTxTime, newIdentity("Org2MSP", "mallory", map[string]string{"role": "doctor"}))
+	_, err = smartContract.CreateAsset(transactionContext, `{"PatientId":"patient1","Prescriptions":[{}]}`)
+	require.EqualError(t, err, "no role binding for identity in organization Org2MSP")
+	require.Equal(t, 0, chaincodeStub.PutStateCallCount())
+}
+
+func TestDispensePrescriptionRecordsCertificateIdentity(t *testing.T) {
+	smartContract := chaincode.SmartContract{}
+
+	transactionContext, _ := newEndorsement(activePatient(t), testTxTime, pharmacistIdentity("pharmacist1"))
+	err := smartContract.DispensePrescription(transactionContext, `{"patientId":"patient1","prescriptionId":"rx1","pharmacistId":"pharmacist2"}`)
+	require.EqualError(t, err, "pharmacistId 'pharmacist2' does not match the submitting identity 'pharmacist1'")
+
+	state := activePatient(t)
+	transactionContext, _ = newEndorsement(state, testTxTime, pharmacistIdentity("pharmacist1"))
+	err = smartContract.DispensePrescription(transactionContext, `{"patientId":"patient1","prescriptionId":"rx1"}`)
+	require.NoError(t, err)
+
+	asset := readPatient(t, state, "patient1")
+	require.Equal(t, chaincode.StatusDispensed, asset.Prescriptions[0].Status)
+	require.Equal(t, "pharmacist1", asset.Prescriptions[0].DispensingPharmacist)
+}
+
+func TestRevokePrescriptionRequiresPrescriber(t *testing.T) {
+	smartContract := chaincode.SmartContract{}
+
+	transactionContext, chaincodeStub := newEndorsement(activePatient(t), testTxTime, doctorIdentity("doctor2"))
+	err := smartContract.RevokePrescriptionJSON(transactionContext, `{"patientId":"patient1","prescriptionId":"rx1"}`)
+	require.EqualError(t, err, "only the prescribing doctor can revoke this prescription")
+	require.Equal(t, 0, chaincodeStub.PutStateCallCount())
+}
+
+func TestOwnershipChecksCompareMSPQualifiedIdentities(t *testing.T) {
+	smartContract := chaincode.SmartContract{}
+	state := activePatient(t)
+
+	transactionContext, _ := newEndorsement(state, testTxTime, adminIdentity("Org1MSP", "org1admin"))
+	require.NoError(t, smartContract.SetRoleBinding(transactionContext, `{"MSPID":"Org3MSP","Attribute":"role","Value":"doctor","Role":"doctor"}`))
+
+	// Enrollment IDs are unique only within a CA, so Org3MSP may have its own doctor1.
+	impostor := newIdentity("Org3MSP", "doctor1", map[string]string{"role": "doctor"})
+	attempts := map[string]func(ctx *mocks.TransactionContext) error{
+		"only the prescribing doctor can revoke this prescription": func(ctx *mocks.TransactionContext) error {
+			return smartContract.RevokePrescriptionJSON(ctx, `{"patientId":"patient1","prescriptionId":"rx1"}`)
+		},
+		"only the prescribing doctor can update this prescription": func(ctx *mocks.TransactionContext) error {
+			return smartContract.UpdatePrescription(ctx, "patient1", `{"PrescriptionId":"rx1","Reason":"Dose adjusted","Changes":{"Dosage":"250mg"}}`)
+		},
+		"only the prescribing doctor can hold or release this prescription": func(ctx *mocks.TransactionContext) error {
+			return smartContract.HoldPrescription(ctx, "patient1", "rx1")
+		},
+	}
+	for expected, attempt := range attempts {
+		transactionContext, chaincodeStub := newEndorsement(state, testTxTime, impostor)
+		require.EqualError(t, attempt(transactionContext), expected)
+		require.Equal(t, 0, chaincodeStub.PutStateCallCount())
+	}
+
+	// Lookups by a bare enrollment ID name the original doctors' organization.
+	transactionContext, _ = newEndorsement(state, testTxTime, impostor)
+	_, err := smartContract.GetPrescriptionsByDoctor(transactionContext, "Org3MSP/doctor1")
+	require.EqualError(t, err, "no prescriptions found for doctor Org3MSP/doctor1")
+	transactionContext, _ = newEndorsement(state, testTxTime, impostor)
+	prescriptions, err := smartContract.GetPrescriptionsByDoctor(transactionContext, "Org1MSP/doctor1")
+	require.NoError(t, err)
+	require.Len(t, prescriptions, 1)
+}
+
+func TestCreateAssetAssignsPrescriptionIds(t *testing.T) {
+	smartContract := chaincode.SmartContract{}
+	state := ledger{}
+
+	transactionContext, _ := newEndorsement(state, testTxTime, doctorIdentity("doctor1"))
+	withPHI(transactionContext, `{"Salt":"0123456789abcdef","Diagnoses":["Otitis media","Hypertension"]}`)
+	result, err := smartContract.CreateAsset(transactionContext, `{"PatientId":"patient1","Prescriptions":[{},{}]}`)
+	require.NoError(t, err)
+	require.Equal(t, &chaincode.CreateAssetResult{
+		PatientId:       "patient1",
+		PrescriptionIds: []string{"RX-4a4e3bdbd2f6e1d3-0", "RX-4a4e3bdbd2f6e1d3-1"},
+	}, result)
+
+	asset := readPatient(t, state, "patient1")
+	require.Equal(t, "RX-4a4e3bdbd2f6e1d3-0", asset.Prescriptions[0].PrescriptionId)
+	require.Equal(t, "Otitis media", asset.Prescriptions[0].Diagnosis)
+	require.Equal(t, "RX-4a4e3bdbd2f6e1d3-1", asset.Prescriptions[1].PrescriptionId)
+	require.Equal(t, "Hypertension", asset.Prescriptions[1].Diagnosis)
+
+	// Replaying the same transaction would produce the same IDs, which are rejected as duplicates.
+	transactionContext, _ = newEndorsement(state, testTxTime, doctorIdentity("doctor1"))
+	withPHI(transactionContext, `{"Salt":"0123456789abcdef","Diagnoses":["Otitis media"]}`)
+	_, err = smartContract.CreateAsset(transactionContext, `{"PatientId":"patient1","Prescriptions":[{}]}`)
+	require.EqualError(t, err, "prescription RX-4a4e3bdbd2f6e1d3-0 already exists for patient patient1")
+}
+
+func TestCreateAssetRejectsClientPrescriptionIds(t *testing.T) {
+	smartContract := chaincode.SmartContract{}
+
+	transactionContext, chaincodeStub := newEndorsement(ledger{}, testTxTime, doctorIdentity("doctor1"))
+	withPHI(transactionContext, `{"Salt":"0123456789abcdef","Diagnoses":["Otitis media"]}`)
+	_, err := smartContract.CreateAsset(transactionContext, `{"PatientId":"patient1","Prescriptions":[{"PrescriptionId":"rx1"}]}`)
+	require.EqualError(t, err, "prescriptionId is assigned by the chaincode and must not be supplied")
+	require.Equal(t, 0, chaincodeStub.PutStateCallCount())
+}
+
+func TestBatchCreatePrescriptionsNumbersAcrossBatch(t *testing.T) {
+	smartContract := chaincode.SmartContract{}
+	state := ledger{}
+
+	transactionContext, _ := newEndorsement(state, testTxTime, doctorIdentity("doctor1"))
+	withPHI(transactionContext, `[{"Salt":"0123456789abcdef","Diagnoses":["Otitis media"]},{"Salt":"fedcba9876543210","Diagnoses":["Asthma","Eczema"]}]`)
+	report, err := smartContract.BatchCreatePrescriptions(transactionContext, `[{"PatientId":"patient1","Prescriptions":[{}]},{"PatientId":"patient2","Prescriptions":[{},{}]}]`)
+	require.NoError(t, err)
+	require.Len(t, report.Items, 2)
+	require.Equal(t, []string{"RX-4a4e3bdbd2f6e1d3-0"}, report.Items[0].PrescriptionIds)
+	require.Equal(t, []string{"RX-4a4e3bdbd2f6e1d3-1", "RX-4a4e3bdbd2f6e1d3-2"}, report.Items[1].PrescriptionIds)
+}
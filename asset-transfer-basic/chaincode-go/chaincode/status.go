@@ -0,0 +1,131 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// PrescriptionStatus is the lifecycle state of a prescription.
+type PrescriptionStatus string
+
+const (
+	StatusActive             PrescriptionStatus = "Active"
+	StatusOnHold             PrescriptionStatus = "OnHold"
+	StatusPartiallyDispensed PrescriptionStatus = "PartiallyDispensed"
+	StatusDispensed          PrescriptionStatus = "Dispensed"
+	StatusRevoked            PrescriptionStatus = "Revoked"
+	StatusExpired            PrescriptionStatus = "Expired"
+)
+
+// Operations are the transactions that change a prescription's status. They are reported in
+// TransitionError.Operation.
+const (
+	OperationDispense = "Dispense"
+	OperationHold     = "Hold"
+	OperationRelease  = "Release"
+	OperationRevoke   = "Revoke"
+	OperationExpire   = "Expire"
+)
+
+// statusTransition is a move to status To that only Operation may make.
+type statusTransition struct {
+	To        PrescriptionStatus
+	Operation string
+}
+
+// statusTransitions is the single source of truth for the prescription lifecycle: it lists
+// the statuses each status may move to and the operation that makes each move, so that for
+// example only dispensing can make a prescription Dispensed and only the expiry check or
+// sweep can make it Expired. Releasing a hold restores the status the dispensing counters
+// imply. Statuses that may not move anywhere are terminal.
+var statusTransitions = map[PrescriptionStatus][]statusTransition{
+	StatusActive: {
+		{StatusOnHold, OperationHold},
+		{StatusPartiallyDispensed, OperationDispense},
+		{StatusDispensed, OperationDispense},
+		{StatusRevoked, OperationRevoke},
+		{StatusExpired, OperationExpire},
+	},
+	StatusOnHold: {
+		{StatusActive, OperationRelease},
+		{StatusPartiallyDispensed, OperationRelease},
+		{StatusRevoked, OperationRevoke},
+		{StatusExpired, OperationExpire},
+	},
+	StatusPartiallyDispensed: {
+		{StatusOnHold, OperationHold},
+		{StatusPartiallyDispensed, OperationDispense},
+		{StatusDispensed, OperationDispense},
+		{StatusRevoked, OperationRevoke},
+		{StatusExpired, OperationExpire},
+	},
+	StatusDispensed: nil,
+	StatusRevoked:   nil,
+	StatusExpired:   nil,
+}
+
+// parseStatus returns the status named by value, or an error if it is not a known status.
+func parseStatus(value string) (PrescriptionStatus, error) {
+	status := PrescriptionStatus(value)
+	if _, ok := statusTransitions[status]; !ok {
+		return "", fmt.Errorf("unknown prescription status '%s'", value)
+	}
+	return status, nil
+}
+
+// IsTerminal reports whether a prescription in this status can no longer change.
+func (status PrescriptionStatus) IsTerminal() bool {
+	return len(statusTransitions[status]) == 0
+}
+
+// CanTransitionTo reports whether the lifecycle allows moving from status to next.
+func (status PrescriptionStatus) CanTransitionTo(next PrescriptionStatus) bool {
+	for _, transition := range statusTransitions[status] {
+		if transition.To == next {
+			return true
+		}
+	}
+	return false
+}
+
+// TransitionError reports an illegal status transition. Its message is a JSON object so
+// that clients can tell the failure apart from other errors and read its fields. Allowed lists
+// the statuses the operation may move the prescription to.
+type TransitionError struct {
+	PrescriptionId string               `json:"PrescriptionId"`
+	Operation      string               `json:"Operation"`
+	From           PrescriptionStatus   `json:"From"`
+	To             PrescriptionStatus   `json:"To"`
+	Allowed        []PrescriptionStatus `json:"Allowed"`
+}
+
+func (e *TransitionError) Error() string {
+	detail, _ := json.Marshal(struct {
+		Code string `json:"Code"`
+		*TransitionError
+	}{"IllegalStatusTransition", e})
+	return string(detail)
+}
+
+// transition moves the prescription to next on behalf of operation, or returns a
+// TransitionError if the lifecycle does not let the operation make that move.
+func (prescription *Prescription) transition(next PrescriptionStatus, operation string) error {
+	allowed := []PrescriptionStatus{}
+	for _, transition := range statusTransitions[prescription.Status] {
+		if transition.Operation != operation {
+			continue
+		}
+		if transition.To == next {
+			prescription.Status = next
+			return nil
+		}
+		allowed = append(allowed, transition.To)
+	}
+	return &TransitionError{
+		PrescriptionId: prescription.PrescriptionId,
+		Operation:      operation,
+		From:           prescription.Status,
+		To:             next,
+		Allowed:        allowed,
+	}
+}
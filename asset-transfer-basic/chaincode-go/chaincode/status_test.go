@@ -0,0 +1,208 @@
+package chaincode_test
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode"
+	"github.com/stretchr/testify/require"
+)
+
+// patientWithStatus returns the active patient with rx1 moved to status.
+func patientWithStatus(t *testing.T, status chaincode.PrescriptionStatus) ledger {
+	asset := activePatientAsset()
+	asset.Prescriptions[0].Status = status
+	return patientState(t, asset)
+}
+
+func TestStatusTransitions(t *testing.T) {
+	allowed := map[chaincode.PrescriptionStatus][]chaincode.PrescriptionStatus{
+		chaincode.StatusActive:             {chaincode.StatusOnHold, chaincode.StatusPartiallyDispensed, chaincode.StatusDispensed, chaincode.StatusRevoked, chaincode.StatusExpired},
+		chaincode.StatusOnHold:             {chaincode.StatusActive, chaincode.StatusPartiallyDispensed, chaincode.StatusRevoked, chaincode.StatusExpired},
+		chaincode.StatusPartiallyDispensed: {chaincode.StatusOnHold, chaincode.StatusPartiallyDispensed, chaincode.StatusDispensed, chaincode.StatusRevoked, chaincode.StatusExpired},
+		chaincode.StatusDispensed:          {},
+		chaincode.StatusRevoked:            {},
+		chaincode.StatusExpired:            {},
+	}
+
+	for from, targets := range allowed {
+		require.Equal(t, len(targets) == 0, from.IsTerminal(), "terminal %s", from)
+		for to := range allowed {
+			require.Equal(t, contains(targets, to), from.CanTransitionTo(to), "%s -> %s", from, to)
+		}
+	}
+}
+
+func contains(statuses []chaincode.PrescriptionStatus, status chaincode.PrescriptionStatus) bool {
+	for _, s := range statuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+func TestTransitionsAreReservedToTheirOperation(t *testing.T) {
+	type edge struct {
+		from, to  chaincode.PrescriptionStatus
+		operation string
+	}
+	allowed := map[edge]bool{
+		{chaincode.StatusActive, chaincode.StatusOnHold, chaincode.OperationHold}:                             true,
+		{chaincode.StatusActive, chaincode.StatusPartiallyDispensed, chaincode.OperationDispense}:             true,
+		{chaincode.StatusActive, chaincode.StatusDispensed, chaincode.OperationDispense}:                      true,
+		{chaincode.StatusActive, chaincode.StatusRevoked, chaincode.OperationRevoke}:                          true,
+		{chaincode.StatusActive, chaincode.StatusExpired, chaincode.OperationExpire}:                          true,
+		{chaincode.StatusOnHold, chaincode.StatusActive, chaincode.OperationRelease}:                          true,
+		{chaincode.StatusOnHold, chaincode.StatusPartiallyDispensed, chaincode.OperationRelease}:              true,
+		{chaincode.StatusOnHold, chaincode.StatusRevoked, chaincode.OperationRevoke}:                          true,
+		{chaincode.StatusOnHold, chaincode.StatusExpired, chaincode.OperationExpire}:                          true,
+		{chaincode.StatusPartiallyDispensed, chaincode.StatusOnHold, chaincode.OperationHold}:                 true,
+		{chaincode.StatusPartiallyDispensed, chaincode.StatusPartiallyDispensed, chaincode.OperationDispense}: true,
+		{chaincode.StatusPartiallyDispensed, chaincode.StatusDispensed, chaincode.OperationDispense}:          true,
+		{chaincode.StatusPartiallyDispensed, chaincode.StatusRevoked, chaincode.OperationRevoke}:              true,
+		{chaincode.StatusPartiallyDispensed, chaincode.StatusExpired, chaincode.OperationExpire}:              true,
+	}
+	statuses := []chaincode.PrescriptionStatus{
+		chaincode.StatusActive, chaincode.StatusOnHold, chaincode.StatusPartiallyDispensed,
+		chaincode.StatusDispensed, chaincode.StatusRevoked, chaincode.StatusExpired,
+	}
+	operations := []string{
+		chaincode.OperationDispense, chaincode.OperationHold, chaincode.OperationRelease,
+		chaincode.OperationRevoke, chaincode.OperationExpire,
+	}
+
+	for _, from := range statuses {
+		for _, to := range statuses {
+			for _, operation := range operations {
+				prescription := &chaincode.Prescription{PrescriptionId: "rx1", Status: from}
+				err := prescription.Transition(to, operation)
+				if allowed[edge{from, to, operation}] {
+					require.NoError(t, err, "%s: %s -> %s", operation, from, to)
+					require.Equal(t, to, prescription.Status)
+					continue
+				}
+				var transitionError *chaincode.TransitionError
+				require.True(t, errors.As(err, &transitionError), "%s: %s -> %s should be rejected", operation, from, to)
+				require.Equal(t, from, prescription.Status)
+				for _, status := range transitionError.Allowed {
+					require.True(t, allowed[edge{from, status, operation}], "%s: %s listed as allowed from %s", operation, status, from)
+				}
+			}
+		}
+	}
+}
+
+func TestIllegalTransitionsReturnTransitionErrors(t *testing.T) {
+	smartContract := chaincode.SmartContract{}
+
+	transactionContext, chaincodeStub := newEndorsement(patientWithStatus(t, chaincode.StatusRevoked), testTxTime, pharmacistIdentity("pharmacist1"))
+	err := smartContract.DispensePrescription(transactionContext, `{"patientId":"patient1","prescriptionId":"rx1"}`)
+	require.Equal(t, 0, chaincodeStub.PutStateCallCount())
+
+	var transitionError *chaincode.TransitionError
+	require.True(t, errors.As(err, &transitionError))
+	require.Equal(t, &chaincode.TransitionError{
+		PrescriptionId: "rx1",
+		Operation:      chaincode.OperationDispense,
+		From:           chaincode.StatusRevoked,
+		To:             chaincode.StatusDispensed,
+		Allowed:        []chaincode.PrescriptionStatus{},
+	}, transitionError)
+
+	// The message is JSON so that clients receive the same fields.
+	var detail map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(err.Error()), &detail))
+	require.Equal(t, "IllegalStatusTransition", detail["Code"])
+	require.Equal(t, "Revoked", detail["From"])
+	require.Equal(t, "Dispensed", detail["To"])
+
+	transactionContext, _ = newEndorsement(patientWithStatus(t, chaincode.StatusDispensed), testTxTime, doctorIdentity("doctor1"))
+	err = smartContract.RevokePrescriptionJSON(transactionContext, `{"patientId":"patient1","prescriptionId":"rx1"}`)
+	require.True(t, errors.As(err, &transitionError))
+	require.Equal(t, chaincode.StatusDispensed, transitionError.From)
+	require.Equal(t, chaincode.StatusRevoked, transitionError.To)
+}
+
+func TestUpdatePrescriptionCannotReviveRevokedPrescription(t *testing.T) {
+	smartContract := chaincode.SmartContract{}
+
+	transactionContext, chaincodeStub := newEndorsement(patientWithStatus(t, chaincode.StatusRevoked), testTxTime, doctorIdentity("doctor1"))
+	err := smartContract.UpdatePrescription(transactionContext, "patient1", `{"PrescriptionId":"rx1","Reason":"Revoked in error","Changes":{"ExpiryDate":"2025-05-01"}}`)
+	require.EqualError(t, err, "prescription rx1 is Revoked and can no longer be updated")
+	require.Equal(t, 0, chaincodeStub.PutStateCallCount())
+
+	// An omitted status keeps the current one.
+	state := activePatient(t)
+	transactionContext, _ = newEndorsement(state, testTxTime, doctorIdentity("doctor1"))
+	err = smartContract.UpdatePrescription(transactionContext, "patient1", `{"PrescriptionId":"rx1","Reason":"Dose adjusted for weight","Changes":{"Dosage":"250mg"}}`)
+	require.NoError(t, err)
+	require.Equal(t, chaincode.StatusActive, readPatient(t, state, "patient1").Prescriptions[0].Status)
+}
+
+func TestHoldBlocksDispensingUntilReleased(t *testing.T) {
+	smartContract := chaincode.SmartContract{}
+	state := activePatient(t)
+
+	transactionContext, _ := newEndorsement(state, testTxTime, doctorIdentity("doctor1"))
+	require.NoError(t, smartContract.HoldPrescription(transactionContext, "patient1", "rx1"))
+	require.Equal(t, chaincode.StatusOnHold, readPatient(t, state, "patient1").Prescriptions[0].Status)
+
+	transactionContext, _ = newEndorsement(state, testTxTime, pharmacistIdentity("pharmacist1"))
+	err := smartContract.DispensePrescription(transactionContext, `{"patientId":"patient1","prescriptionId":"rx1"}`)
+	var transitionError *chaincode.TransitionError
+	require.True(t, errors.As(err, &transitionError))
+	require.Equal(t, chaincode.StatusOnHold, transitionError.From)
+
+	transactionContext, chaincodeStub := newEndorsement(state, testTxTime, pharmacistIdentity("pharmacist1"))
+	require.NoError(t, smartContract.ReleasePrescription(transactionContext, "patient1", "rx1"))
+	name, event, _ := emittedEvent(t, chaincodeStub)
+	require.Equal(t, "PrescriptionReleased", name)
+	require.Equal(t, chaincode.StatusOnHold, event.Prescriptions[0].PreviousStatus)
+
+	transactionContext, _ = newEndorsement(state, testTxTime, pharmacistIdentity("pharmacist1"))
+	require.NoError(t, smartContract.DispensePrescription(transactionContext, `{"patientId":"patient1","prescriptionId":"rx1"}`))
+
+	transactionContext, _ = newEndorsement(state, testTxTime, pharmacistIdentity("pharmacist1"))
+	err = smartContract.ReleasePrescription(transactionContext, "patient1", "rx1")
+	require.EqualError(t, err, "prescription rx1 is Dispensed, not OnHold")
+}
+
+func TestExpiryLeavesTerminalPrescriptionsUnchanged(t *testing.T) {
+	smartContract := chaincode.SmartContract{}
+
+	transactionContext, chaincodeStub := newEndorsement(patientWithStatus(t, chaincode.StatusDispensed), testTxTime.AddDate(0, 1, 0), pharmacistIdentity("pharmacist1"))
+	require.NoError(t, smartContract.CheckPrescriptionExpiry(transactionContext, "patient1", "rx1"))
+	require.Equal(t, 0, chaincodeStub.PutStateCallCount())
+}
+
+func TestGetPrescriptionsByStatusRejectsUnknownStatus(t *testing.T) {
+	smartContract := chaincode.SmartContract{}
+
+	transactionContext, _ := newEndorsement(activePatient(t), testTxTime, doctorIdentity("doctor1"))
+	_, err := smartContract.GetPrescriptionsByStatus(transactionContext, "patient1", "active")
+	require.EqualError(t, err, "unknown prescription status 'active'")
+}
+
+func TestOnlyThePrescriberCanHoldOrRelease(t *testing.T) {
+	smartContract := chaincode.SmartContract{}
+	state := activePatient(t)
+
+	transactionContext, chaincodeStub := newEndorsement(state, testTxTime, doctorIdentity("doctor2"))
+	err := smartContract.HoldPrescription(transactionContext, "patient1", "rx1")
+	require.EqualError(t, err, "only the prescribing doctor can hold or release this prescription")
+	require.Equal(t, 0, chaincodeStub.PutStateCallCount())
+
+	// Pharmacists may hold any prescription they are asked to dispense.
+	transactionContext, _ = newEndorsement(state, testTxTime, pharmacistIdentity("pharmacist1"))
+	require.NoError(t, smartContract.HoldPrescription(transactionContext, "patient1", "rx1"))
+
+	transactionContext, chaincodeStub = newEndorsement(state, testTxTime, doctorIdentity("doctor2"))
+	err = smartContract.ReleasePrescription(transactionContext, "patient1", "rx1")
+	require.EqualError(t, err, "only the prescribing doctor can hold or release this prescription")
+	require.Equal(t, 0, chaincodeStub.PutStateCallCount())
+
+	transactionContext, _ = newEndorsement(state, testTxTime, doctorIdentity("doctor1"))
+	require.NoError(t, smartContract.ReleasePrescription(transactionContext, "patient1", "rx1"))
+}
@@ -0,0 +1,371 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+)
+
+// Patients are stored under their PatientId with demographics only. Each prescription is
+// stored under its own composite key so that concurrent transactions on different
+// prescriptions of the same patient do not conflict.
+//
+// Records written before the split keep their prescriptions inline in the patient record.
+// They stay readable until MigrateAssets moves them to their own keys.
+const prescriptionObjectType = "prescription"
+
+// prescriptionKey returns the ledger key of a prescription.
+func prescriptionKey(ctx contractapi.TransactionContextInterface, patientId string, prescriptionId string) (string, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(prescriptionObjectType, []string{patientId, prescriptionId})
+	if err != nil {
+		return "", fmt.Errorf("failed to create prescription key: %v", err)
+	}
+	return key, nil
+}
+
+// readPatient loads the public patient record stored under patientId. Prescriptions holds
+// any legacy inline prescriptions that have not been migrated yet.
+func readPatient(ctx contractapi.TransactionContextInterface, patientId string) (*Asset, error) {
+	assetJSON, err := ctx.GetStub().GetState(patientId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from world state: %v", err)
+	}
+	if assetJSON == nil {
+		return nil, fmt.Errorf("asset %s does not exist", patientId)
+	}
+
+	var asset Asset
+	if err := json.Unmarshal(assetJSON, &asset); err != nil {
+		return nil, err
+	}
+	return &asset, nil
+}
+
+// putPatient stores the patient demographics. Prescriptions are never written to the
+// patient record, nor are identifying fields kept in the private collection.
+func putPatient(ctx contractapi.TransactionContextInterface, asset *Asset) error {
+	record := *asset
+	record.Prescriptions = nil
+	if record.PrivateDataHash != "" {
+		record.PatientName = ""
+		record.DateOfBirth = ""
+	}
+
+	assetJSON, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return ctx.GetStub().PutState(asset.PatientId, assetJSON)
+}
+
+// readPrescription loads a single prescription, falling back to the legacy inline copy in
+// the patient record if it has not been migrated.
+func readPrescription(ctx contractapi.TransactionContextInterface, patientId string, prescriptionId string) (*Prescription, error) {
+	key, err := prescriptionKey(ctx, patientId, prescriptionId)
+	if err != nil {
+		return nil, err
+	}
+
+	prescriptionJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read prescription: %v", err)
+	}
+	if prescriptionJSON != nil {
+		var prescription Prescription
+		if err := json.Unmarshal(prescriptionJSON, &prescription); err != nil {
+			return nil, err
+		}
+		if err := mergePrescriptionPrivate(ctx, &prescription); err != nil {
+			return nil, err
+		}
+		return &prescription, nil
+	}
+
+	patient, err := readPatient(ctx, patientId)
+	if err != nil {
+		return nil, err
+	}
+	for _, prescription := range patient.Prescriptions {
+		if prescription.PrescriptionId == prescriptionId {
+			prescription.PatientId = patientId
+			return &prescription, nil
+		}
+	}
+
+	return nil, fmt.Errorf("prescription %s not found", prescriptionId)
+}
+
+// putPrescription stores a prescription under its own key, without the clinical fields kept
+// in the private collection, and updates its secondary index entries.
+func putPrescription(ctx contractapi.TransactionContextInterface, prescription *Prescription) error {
+	if prescription.PatientId == "" || prescription.PrescriptionId == "" {
+		return fmt.Errorf("prescription requires a patientId and prescriptionId to be stored")
+	}
+
+	record := *prescription
+	if record.PrivateDataHash != "" {
+		record.Diagnosis = ""
+		record.AllergyOverrides = nil
+	}
+
+	key, err := prescriptionKey(ctx, prescription.PatientId, prescription.PrescriptionId)
+	if err != nil {
+		return err
+	}
+
+	previous, err := readStoredPrescription(ctx, key)
+	if err != nil {
+		return err
+	}
+
+	prescriptionJSON, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	if err := ctx.GetStub().PutState(key, prescriptionJSON); err != nil {
+		return err
+	}
+	return updateIndexes(ctx, previous, &record)
+}
+
+// listPrescriptions returns the prescriptions stored under the patient's composite keys,
+// ordered by prescription ID, with their private fields.
+func listPrescriptions(ctx contractapi.TransactionContextInterface, patientId string) ([]Prescription, error) {
+	iterator, err := ctx.GetStub().GetStateByPartialCompositeKey(prescriptionObjectType, []string{patientId})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get prescriptions for patient %s: %v", patientId, err)
+	}
+	defer iterator.Close()
+
+	prescriptions := []Prescription{}
+	for iterator.HasNext() {
+		queryResponse, err := iterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var prescription Prescription
+		if err := json.Unmarshal(queryResponse.Value, &prescription); err != nil {
+			return nil, err
+		}
+		if err := mergePrescriptionPrivate(ctx, &prescription); err != nil {
+			return nil, err
+		}
+		prescriptions = append(prescriptions, prescription)
+	}
+	return prescriptions, nil
+}
+
+// aggregateAsset combines a public patient record with its private fields and its
+// prescriptions into the single Asset shape returned by ReadAsset. Prescriptions stored
+// under their own key take precedence over legacy inline copies with the same ID.
+func aggregateAsset(ctx contractapi.TransactionContextInterface, patient *Asset) (*Asset, error) {
+	stored, err := listPrescriptions(ctx, patient.PatientId)
+	if err != nil {
+		return nil, err
+	}
+
+	byId := map[string]Prescription{}
+	for _, prescription := range patient.Prescriptions {
+		prescription.PatientId = patient.PatientId
+		byId[prescription.PrescriptionId] = prescription
+	}
+	for _, prescription := range stored {
+		byId[prescription.PrescriptionId] = prescription
+	}
+
+	asset := *patient
+	if err := mergePatientPrivate(ctx, &asset); err != nil {
+		return nil, err
+	}
+	asset.Prescriptions = make([]Prescription, 0, len(byId))
+	for _, prescription := range byId {
+		asset.Prescriptions = append(asset.Prescriptions, prescription)
+		if prescription.Timestamp > asset.LastUpdated {
+			asset.LastUpdated = prescription.Timestamp
+		}
+	}
+	sort.Slice(asset.Prescriptions, func(i, j int) bool {
+		return asset.Prescriptions[i].PrescriptionId < asset.Prescriptions[j].PrescriptionId
+	})
+
+	return &asset, nil
+}
+
+// defaultMigrationBatchSize bounds the patient records MigrateAssets scans in one transaction.
+const defaultMigrationBatchSize = 100
+
+// MigrationReport summarizes one MigrateAssets transaction.
+type MigrationReport struct {
+	PatientsScanned       int    `json:"PatientsScanned"`
+	PatientsMigrated      int    `json:"PatientsMigrated"`
+	PrescriptionsMigrated int    `json:"PrescriptionsMigrated"`
+	PrescriptionsIndexed  int    `json:"PrescriptionsIndexed"`
+	NextStartKey          string `json:"NextStartKey,omitempty"`
+}
+
+// MigrateAssets moves legacy inline prescriptions into their own keys and rewrites the patient
+// records with demographics only. Legacy prescriptions without an ID, or repeating an earlier
+// prescription's ID, are stored under an ID derived from the patient and their position in the
+// record. Prescriptions stored under their own keys before the secondary indexes existed get
+// their index entries written. It scans at most limit patient records starting at startKey;
+// call it again with the returned NextStartKey until that is empty.
+func (s *SmartContract) MigrateAssets(ctx contractapi.TransactionContextInterface, startKey string, limit int) (*MigrationReport, error) {
+	if _, err := s.authorize(ctx, "MigrateAssets"); err != nil {
+		return nil, err
+	}
+	if limit <= 0 {
+		limit = defaultMigrationBatchSize
+	}
+
+	iterator, err := ctx.GetStub().GetStateByRange(startKey, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get state by range: %v", err)
+	}
+	defer iterator.Close()
+
+	report := &MigrationReport{}
+	for iterator.HasNext() {
+		queryResponse, err := iterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		if report.PatientsScanned == limit {
+			report.NextStartKey = queryResponse.Key
+			break
+		}
+		report.PatientsScanned++
+
+		var patient Asset
+		if err := json.Unmarshal(queryResponse.Value, &patient); err != nil {
+			return nil, fmt.Errorf("failed to parse patient record %s: %v", queryResponse.Key, err)
+		}
+
+		indexed, err := indexStoredPrescriptions(ctx, patient.PatientId)
+		if err != nil {
+			return nil, err
+		}
+		report.PrescriptionsIndexed += indexed
+
+		if len(patient.Prescriptions) == 0 {
+			continue
+		}
+
+		seen := map[string]bool{}
+		for i, prescription := range patient.Prescriptions {
+			if prescription.PrescriptionId == "" || seen[prescription.PrescriptionId] {
+				// Legacy records allowed missing and repeated IDs. The ID is derived from the
+				// patient and position so that a retried migration assigns the same one.
+				prescription.PrescriptionId = newPrescriptionId(patient.PatientId, i)
+			}
+			seen[prescription.PrescriptionId] = true
+
+			key, err := prescriptionKey(ctx, patient.PatientId, prescription.PrescriptionId)
+			if err != nil {
+				return nil, err
+			}
+			existing, err := ctx.GetStub().GetState(key)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read prescription: %v", err)
+			}
+			if existing != nil {
+				// Already rewritten since the split; the stored copy is newer.
+				continue
+			}
+
+			prescription.PatientId = patient.PatientId
+			if err := putPrescription(ctx, &prescription); err != nil {
+				return nil, err
+			}
+			report.PrescriptionsMigrated++
+		}
+
+		if err := putPatient(ctx, &patient); err != nil {
+			return nil, err
+		}
+		report.PatientsMigrated++
+	}
+
+	return report, nil
+}
+
+// indexStoredPrescriptions writes the missing index entries of the prescriptions stored under
+// the patient's composite keys and returns how many prescriptions needed entries.
+func indexStoredPrescriptions(ctx contractapi.TransactionContextInterface, patientId string) (int, error) {
+	iterator, err := ctx.GetStub().GetStateByPartialCompositeKey(prescriptionObjectType, []string{patientId})
+	if err != nil {
+		return 0, fmt.Errorf("failed to get prescriptions for patient %s: %v", patientId, err)
+	}
+	defer iterator.Close()
+
+	indexed := 0
+	for iterator.HasNext() {
+		queryResponse, err := iterator.Next()
+		if err != nil {
+			return 0, err
+		}
+		var prescription Prescription
+		if err := json.Unmarshal(queryResponse.Value, &prescription); err != nil {
+			return 0, err
+		}
+
+		keys, err := indexEntries(ctx, &prescription)
+		if err != nil {
+			return 0, err
+		}
+		missing := false
+		for _, key := range keys {
+			value, err := ctx.GetStub().GetState(key)
+			if err != nil {
+				return 0, fmt.Errorf("failed to read index entry: %v", err)
+			}
+			if value == nil {
+				missing = true
+				if err := ctx.GetStub().PutState(key, indexValue); err != nil {
+					return 0, fmt.Errorf("failed to write index entry: %v", err)
+				}
+			}
+		}
+		if missing {
+			indexed++
+		}
+	}
+	return indexed, nil
+}
+
+// prescriptionExists reports whether a prescription is already stored for the patient,
+// either under its own key or inline in a legacy patient record.
+func prescriptionExists(ctx contractapi.TransactionContextInterface, patientId string, prescriptionId string) (bool, error) {
+	key, err := prescriptionKey(ctx, patientId, prescriptionId)
+	if err != nil {
+		return false, err
+	}
+
+	prescriptionJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return false, fmt.Errorf("failed to read prescription: %v", err)
+	}
+	if prescriptionJSON != nil {
+		return true, nil
+	}
+
+	patientJSON, err := ctx.GetStub().GetState(patientId)
+	if err != nil {
+		return false, fmt.Errorf("failed to read from world state: %v", err)
+	}
+	if patientJSON == nil {
+		return false, nil
+	}
+	var patient Asset
+	if err := json.Unmarshal(patientJSON, &patient); err != nil {
+		return false, err
+	}
+	for _, prescription := range patient.Prescriptions {
+		if prescription.PrescriptionId == prescriptionId {
+			return true, nil
+		}
+	}
+	return false, nil
+}
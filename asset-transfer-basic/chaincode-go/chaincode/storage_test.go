@@ -0,0 +1,161 @@
+package chaincode_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/hyperledger/fabric-chaincode-go/v2/shim"
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode"
+	"github.com/stretchr/testify/require"
+)
+
+func twoPrescriptionPatient() chaincode.Asset {
+	asset := activePatientAsset()
+	second := asset.Prescriptions[0]
+	second.PrescriptionId = "rx2"
+	second.MedicationName = "Metformin"
+	asset.Prescriptions = append(asset.Prescriptions, second)
+	return asset
+}
+
+func TestPrescriptionsAreStoredUnderCompositeKeys(t *testing.T) {
+	smartContract := chaincode.SmartContract{}
+	state := activePatient(t)
+
+	transactionContext, chaincodeStub := newEndorsement(state, testTxTime, doctorIdentity("doctor1"))
+	withPHI(transactionContext, `{"Salt":"0123456789abcdef","Diagnoses":["Hypertension"]}`)
+	result, err := smartContract.CreateAsset(transactionContext, `{"PatientId":"patient1","Prescriptions":[{}]}`)
+	require.NoError(t, err)
+	require.Len(t, result.PrescriptionIds, 1)
+
+	// Adding a prescription for an existing patient leaves the patient record untouched; only
+	// the prescription and its index entries are written.
+	require.Equal(t, 4, chaincodeStub.PutStateCallCount())
+	key, _ := chaincodeStub.PutStateArgsForCall(0)
+	expectedKey, err := shim.CreateCompositeKey("prescription", []string{"patient1", result.PrescriptionIds[0]})
+	require.NoError(t, err)
+	require.Equal(t, expectedKey, key)
+	for i := 1; i < chaincodeStub.PutStateCallCount(); i++ {
+		key, _ := chaincodeStub.PutStateArgsForCall(i)
+		require.True(t, strings.HasSuffix(key, "\x00patient1\x00"+result.PrescriptionIds[0]+"\x00"), "unexpected write to %q", key)
+	}
+
+	asset := readPatient(t, state, "patient1")
+	require.Len(t, asset.Prescriptions, 2)
+	require.Equal(t, result.PrescriptionIds[0], asset.Prescriptions[0].PrescriptionId)
+	require.Equal(t, "rx1", asset.Prescriptions[1].PrescriptionId)
+}
+
+func TestDispensesOfSamePatientDoNotConflict(t *testing.T) {
+	smartContract := chaincode.SmartContract{}
+	initial := patientState(t, twoPrescriptionPatient())
+
+	written := func(prescriptionId string) []string {
+		transactionContext, chaincodeStub := newEndorsement(initial.clone(), testTxTime, pharmacistIdentity("pharmacist1"))
+		err := smartContract.DispensePrescription(transactionContext, `{"patientId":"patient1","prescriptionId":"`+prescriptionId+`"}`)
+		require.NoError(t, err)
+
+		var keys []string
+		for i := 0; i < chaincodeStub.PutStateCallCount(); i++ {
+			key, _ := chaincodeStub.PutStateArgsForCall(i)
+			keys = append(keys, key)
+		}
+		return keys
+	}
+
+	first := written("rx1")
+	second := written("rx2")
+	require.NotEmpty(t, first)
+	for _, key := range first {
+		require.NotContains(t, second, key)
+	}
+	require.NotContains(t, first, "patient1")
+}
+
+func TestLegacyAssetsRemainReadableAndMigrate(t *testing.T) {
+	smartContract := chaincode.SmartContract{}
+	legacy := twoPrescriptionPatient()
+	state := legacyPatientState(t, legacy)
+	before := readPatient(t, state, "patient1")
+	require.Len(t, before.Prescriptions, 2)
+
+	// A legacy prescription can be dispensed before migration.
+	transactionContext, _ := newEndorsement(state, testTxTime, pharmacistIdentity("pharmacist1"))
+	err := smartContract.DispensePrescription(transactionContext, `{"patientId":"patient1","prescriptionId":"rx1"}`)
+	require.NoError(t, err)
+	dispensed := readPatient(t, state, "patient1")
+	require.Equal(t, chaincode.StatusDispensed, dispensed.Prescriptions[0].Status)
+	require.Equal(t, chaincode.StatusActive, dispensed.Prescriptions[1].Status)
+
+	transactionContext, _ = newEndorsement(state, testTxTime, doctorIdentity("doctor1"))
+	_, err = smartContract.MigrateAssets(transactionContext, "", 0)
+	require.EqualError(t, err, "caller doctor1 with role 'doctor' is not permitted to call MigrateAssets")
+
+	transactionContext, _ = newEndorsement(state, testTxTime, adminIdentity("Org1MSP", "org1admin"))
+	report, err := smartContract.MigrateAssets(transactionContext, "", 0)
+	require.NoError(t, err)
+	require.Equal(t, &chaincode.MigrationReport{PatientsScanned: 1, PatientsMigrated: 1, PrescriptionsMigrated: 1}, report)
+
+	// The patient record now holds demographics only and reads back the same.
+	require.NotContains(t, string(state["patient1"]), "rx1")
+	require.Equal(t, dispensed, readPatient(t, state, "patient1"))
+}
+
+func TestMigrateAssetsResumesFromNextStartKey(t *testing.T) {
+	smartContract := chaincode.SmartContract{}
+	state := ledger{}
+	for _, patientId := range []string{"patient1", "patient2", "patient3"} {
+		asset := activePatientAsset()
+		asset.PatientId = patientId
+		for key, value := range legacyPatientState(t, asset) {
+			state[key] = value
+		}
+	}
+
+	transactionContext, _ := newEndorsement(state, testTxTime, adminIdentity("Org1MSP", "org1admin"))
+	report, err := smartContract.MigrateAssets(transactionContext, "", 2)
+	require.NoError(t, err)
+	require.Equal(t, 2, report.PatientsMigrated)
+	require.Equal(t, "patient3", report.NextStartKey)
+
+	report, err = smartContract.MigrateAssets(transactionContext, report.NextStartKey, 2)
+	require.NoError(t, err)
+	require.Equal(t, 1, report.PatientsMigrated)
+	require.Empty(t, report.NextStartKey)
+}
+
+func TestMigrateAssetsAssignsIdsToLegacyPrescriptions(t *testing.T) {
+	smartContract := chaincode.SmartContract{}
+	legacy := twoPrescriptionPatient()
+	third := legacy.Prescriptions[0]
+	third.PrescriptionId = ""
+	third.MedicationName = "Salbutamol"
+	duplicate := legacy.Prescriptions[1]
+	duplicate.MedicationName = "Insulin"
+	legacy.Prescriptions = append(legacy.Prescriptions, third, duplicate)
+
+	migrate := func(state ledger) {
+		transactionContext, _ := newEndorsement(state, testTxTime, adminIdentity("Org1MSP", "org1admin"))
+		report, err := smartContract.MigrateAssets(transactionContext, "", 0)
+		require.NoError(t, err)
+		require.Equal(t, &chaincode.MigrationReport{PatientsScanned: 1, PatientsMigrated: 1, PrescriptionsMigrated: 4}, report)
+	}
+	state := legacyPatientState(t, legacy)
+	migrate(state)
+
+	medications := map[string]string{}
+	for _, prescription := range readPatient(t, state, "patient1").Prescriptions {
+		medications[prescription.PrescriptionId] = prescription.MedicationName
+	}
+	require.Equal(t, map[string]string{
+		"rx1":           "Amoxicillin",
+		"rx2":           "Metformin",
+		"RX-patient1-2": "Salbutamol",
+		"RX-patient1-3": "Insulin",
+	}, medications)
+
+	// A retried migration of the same record assigns the same IDs.
+	retried := legacyPatientState(t, legacy)
+	migrate(retried)
+	require.Equal(t, state, retried)
+}
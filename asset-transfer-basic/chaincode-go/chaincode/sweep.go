@@ -0,0 +1,144 @@
+package chaincode
+
+import (
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+)
+
+const (
+	// defaultSweepBatchSize is the number of prescriptions SweepExpiredPrescriptions expires in
+	// one transaction when no limit is given.
+	defaultSweepBatchSize = 100
+
+	// maxSweepBatchSize bounds the write set of a single sweep transaction.
+	maxSweepBatchSize = 500
+)
+
+// SweepReport summarises one SweepExpiredPrescriptions batch. Bookmark names the next due
+// prescription when the batch stopped at its limit, and is empty once no due prescriptions
+// remain. Malformed lists the index keys passed over because they do not name a valid
+// expiry date, patient and prescription.
+type SweepReport struct {
+	Expired       int                      `json:"Expired"`
+	Prescriptions []PrescriptionEventEntry `json:"Prescriptions"`
+	Bookmark      string                   `json:"Bookmark,omitempty"`
+	Malformed     []string                 `json:"Malformed,omitempty"`
+}
+
+// SweepExpiredPrescriptions - expires up to limit prescriptions whose expiry date has passed,
+// oldest first, reading them from the expiry index. Pass an empty bookmark to start and the
+// returned bookmark to continue with the next batch. Legacy prescriptions stored inline in the
+// patient record are not indexed until MigrateAssets has run.
+func (s *SmartContract) SweepExpiredPrescriptions(ctx contractapi.TransactionContextInterface, bookmark string, limit int) (*SweepReport, error) {
+	c, err := s.authorize(ctx, "SweepExpiredPrescriptions")
+	if err != nil {
+		return nil, err
+	}
+	if limit <= 0 {
+		limit = defaultSweepBatchSize
+	}
+	if limit > maxSweepBatchSize {
+		return nil, fmt.Errorf("limit must be at most %d", maxSweepBatchSize)
+	}
+
+	clock, err := newTxClock(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if bookmark != "" {
+		objectType, attributes, err := ctx.GetStub().SplitCompositeKey(bookmark)
+		if err != nil || objectType != expiryIndex || len(attributes) != 3 {
+			return nil, fmt.Errorf("invalid bookmark %q", bookmark)
+		}
+	}
+
+	// Paginated queries are not allowed in transactions that write, and range queries do not
+	// cover composite keys, so the bookmark is the index key to resume from and earlier entries
+	// are skipped. Entries expired by previous batches have already been deleted, so there are
+	// rarely any to skip.
+	iterator, err := ctx.GetStub().GetStateByPartialCompositeKey(expiryIndex, []string{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s index: %v", expiryIndex, err)
+	}
+	defer iterator.Close()
+
+	report := &SweepReport{Prescriptions: []PrescriptionEventEntry{}}
+	for iterator.HasNext() {
+		queryResponse, err := iterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		if queryResponse.Key < bookmark {
+			continue
+		}
+
+		// A malformed entry is reported and left in place so that it cannot stop the sweep.
+		_, attributes, err := ctx.GetStub().SplitCompositeKey(queryResponse.Key)
+		if err != nil || len(attributes) != 3 {
+			report.Malformed = append(report.Malformed, queryResponse.Key)
+			continue
+		}
+		expired, err := clock.IsExpired(attributes[0])
+		if err != nil {
+			report.Malformed = append(report.Malformed, queryResponse.Key)
+			continue
+		}
+		if !expired {
+			// Entries are in expiry date order, so nothing after this one is due.
+			break
+		}
+		if report.Expired == limit {
+			report.Bookmark = queryResponse.Key
+			break
+		}
+
+		entry, err := expirePrescription(ctx, clock, queryResponse.Key, attributes[1], attributes[2])
+		if err != nil {
+			return nil, err
+		}
+		if entry != nil {
+			report.Prescriptions = append(report.Prescriptions, *entry)
+			report.Expired++
+		}
+	}
+
+	if err := emitPrescriptionEvent(ctx, eventPrescriptionExpired, c, clock, report.Prescriptions); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// expirePrescription moves a stored prescription found through the expiry index to Expired.
+// It deletes the index entry instead if the prescription can no longer expire, and returns
+// nil in that case.
+func expirePrescription(ctx contractapi.TransactionContextInterface, clock *txClock, indexKey string, patientId string, prescriptionId string) (*PrescriptionEventEntry, error) {
+	key, err := prescriptionKey(ctx, patientId, prescriptionId)
+	if err != nil {
+		return nil, err
+	}
+	prescription, err := readStoredPrescription(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if prescription == nil || !prescription.Status.CanTransitionTo(StatusExpired) {
+		if err := ctx.GetStub().DelState(indexKey); err != nil {
+			return nil, fmt.Errorf("failed to delete index entry: %v", err)
+		}
+		return nil, nil
+	}
+
+	previousStatus := prescription.Status
+	if err := prescription.transition(StatusExpired, OperationExpire); err != nil {
+		return nil, err
+	}
+	prescription.TxID = ctx.GetStub().GetTxID()
+	prescription.Timestamp = clock.Timestamp()
+
+	if err := putPrescription(ctx, prescription); err != nil {
+		return nil, err
+	}
+	entry := newEventEntry(prescription, previousStatus)
+	return &entry, nil
+}
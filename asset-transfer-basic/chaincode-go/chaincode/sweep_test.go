@@ -0,0 +1,143 @@
+package chaincode_test
+
+import (
+	"testing"
+
+	"github.com/hyperledger/fabric-chaincode-go/v2/shim"
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode"
+	"github.com/stretchr/testify/require"
+)
+
+// sweepState holds prescriptions for patient1 around testTxTime, 2025-03-14.
+func sweepState(t *testing.T) ledger {
+	asset := activePatientAsset()
+	due := asset.Prescriptions[0]
+	due.ExpiryDate = "2025-03-01"
+
+	held := due
+	held.PrescriptionId = "rx2"
+	held.Status = chaincode.StatusOnHold
+	held.ExpiryDate = "2025-03-10"
+
+	current := due
+	current.PrescriptionId = "rx3"
+	current.ExpiryDate = "2025-04-01"
+
+	dispensed := due
+	dispensed.PrescriptionId = "rx4"
+	dispensed.Status = chaincode.StatusDispensed
+	dispensed.ExpiryDate = "2025-01-01"
+
+	asset.Prescriptions = []chaincode.Prescription{due, held, current, dispensed}
+	return patientState(t, asset)
+}
+
+func TestSweepExpiredPrescriptionsInBatches(t *testing.T) {
+	smartContract := chaincode.SmartContract{}
+	state := sweepState(t)
+
+	transactionContext, chaincodeStub := newEndorsement(state, testTxTime, adminIdentity("Org1MSP", "org1admin"))
+	report, err := smartContract.SweepExpiredPrescriptions(transactionContext, "", 1)
+	require.NoError(t, err)
+	require.Equal(t, 1, report.Expired)
+	require.Equal(t, "rx1", report.Prescriptions[0].PrescriptionId)
+	require.Equal(t, indexKey(t, "expiry~prescription", "2025-03-10", "rx2"), report.Bookmark)
+	name, event, _ := emittedEvent(t, chaincodeStub)
+	require.Equal(t, "PrescriptionExpired", name)
+	require.Equal(t, report.Prescriptions, event.Prescriptions)
+
+	transactionContext, _ = newEndorsement(state, testTxTime, adminIdentity("Org1MSP", "org1admin"))
+	report, err = smartContract.SweepExpiredPrescriptions(transactionContext, report.Bookmark, 1)
+	require.NoError(t, err)
+	require.Equal(t, 1, report.Expired)
+	require.Equal(t, chaincode.PrescriptionEventEntry{PatientId: "patient1", PrescriptionId: "rx2", PreviousStatus: chaincode.StatusOnHold, Status: chaincode.StatusExpired}, report.Prescriptions[0])
+	require.Empty(t, report.Bookmark)
+
+	prescriptions := readPatient(t, state, "patient1").Prescriptions
+	require.Equal(t, chaincode.StatusExpired, prescriptions[0].Status)
+	require.Equal(t, testTxID, prescriptions[0].TxID)
+	require.Equal(t, chaincode.StatusExpired, prescriptions[1].Status)
+	require.Equal(t, chaincode.StatusActive, prescriptions[2].Status)
+	require.Equal(t, chaincode.StatusDispensed, prescriptions[3].Status)
+	require.NotContains(t, state, indexKey(t, "expiry~prescription", "2025-03-01", "rx1"))
+	require.Contains(t, state, indexKey(t, "expiry~prescription", "2025-04-01", "rx3"))
+
+	// Nothing else is due, so a further sweep changes nothing and emits no event.
+	transactionContext, chaincodeStub = newEndorsement(state, testTxTime, adminIdentity("Org1MSP", "org1admin"))
+	report, err = smartContract.SweepExpiredPrescriptions(transactionContext, "", 0)
+	require.NoError(t, err)
+	require.Zero(t, report.Expired)
+	require.Zero(t, chaincodeStub.SetEventCallCount())
+	require.Zero(t, chaincodeStub.PutStateCallCount())
+}
+
+func TestSweepExpiredPrescriptionsStartsAtTheBookmark(t *testing.T) {
+	smartContract := chaincode.SmartContract{}
+	state := sweepState(t)
+
+	// Entries before the bookmark are skipped, and the index is read once.
+	bookmark := indexKey(t, "expiry~prescription", "2025-03-10", "rx2")
+	transactionContext, chaincodeStub := newEndorsement(state, testTxTime, adminIdentity("Org1MSP", "org1admin"))
+	report, err := smartContract.SweepExpiredPrescriptions(transactionContext, bookmark, 0)
+	require.NoError(t, err)
+	require.Equal(t, 1, report.Expired)
+	require.Equal(t, "rx2", report.Prescriptions[0].PrescriptionId)
+	require.Equal(t, 1, chaincodeStub.GetStateByPartialCompositeKeyCallCount())
+	require.Equal(t, chaincode.StatusActive, readPatient(t, state, "patient1").Prescriptions[0].Status)
+
+	transactionContext, _ = newEndorsement(state, testTxTime, adminIdentity("Org1MSP", "org1admin"))
+	_, err = smartContract.SweepExpiredPrescriptions(transactionContext, indexKey(t, "doctor~prescription", "Org1MSP/doctor1", "rx1"), 0)
+	require.ErrorContains(t, err, "invalid bookmark")
+}
+
+func TestSweepExpiredPrescriptionsSkipsMalformedEntries(t *testing.T) {
+	smartContract := chaincode.SmartContract{}
+	state := sweepState(t)
+	badDate := indexKey(t, "expiry~prescription", "0000-99-99", "rx9")
+	state[badDate] = []byte{0x00}
+	shortKey, err := shim.CreateCompositeKey("expiry~prescription", []string{"2025-02-01"})
+	require.NoError(t, err)
+	state[shortKey] = []byte{0x00}
+
+	transactionContext, _ := newEndorsement(state, testTxTime, adminIdentity("Org1MSP", "org1admin"))
+	report, err := smartContract.SweepExpiredPrescriptions(transactionContext, "", 0)
+	require.NoError(t, err)
+	require.Equal(t, 2, report.Expired)
+	require.Equal(t, []string{badDate, shortKey}, report.Malformed)
+	require.Contains(t, state, badDate)
+}
+
+func TestCreateAssetRejectsInvalidExpiryDate(t *testing.T) {
+	smartContract := chaincode.SmartContract{}
+
+	transactionContext, chaincodeStub := newEndorsement(ledger{}, testTxTime, doctorIdentity("doctor1"))
+	withPHI(transactionContext, `{"Salt":"0123456789abcdef","Diagnoses":["Otitis media"]}`)
+	_, err := smartContract.CreateAsset(transactionContext, `{"PatientId":"patient1","Prescriptions":[{"MedicationName":"Amoxicillin","ExpiryDate":"0000-99-99"}]}`)
+	require.EqualError(t, err, "invalid expiry date '0000-99-99': expected YYYY-MM-DD")
+	require.Zero(t, chaincodeStub.PutStateCallCount())
+}
+
+func TestSweepExpiredPrescriptionsDropsStaleEntries(t *testing.T) {
+	smartContract := chaincode.SmartContract{}
+	state := sweepState(t)
+	stale := indexKey(t, "expiry~prescription", "2025-02-01", "rx9")
+	state[stale] = []byte{0x00}
+
+	transactionContext, _ := newEndorsement(state, testTxTime, adminIdentity("Org1MSP", "org1admin"))
+	report, err := smartContract.SweepExpiredPrescriptions(transactionContext, "", 0)
+	require.NoError(t, err)
+	require.Equal(t, 2, report.Expired)
+	require.NotContains(t, state, stale)
+}
+
+func TestSweepExpiredPrescriptionsIsBounded(t *testing.T) {
+	smartContract := chaincode.SmartContract{}
+
+	transactionContext, _ := newEndorsement(sweepState(t), testTxTime, doctorIdentity("doctor1"))
+	_, err := smartContract.SweepExpiredPrescriptions(transactionContext, "", 1)
+	require.EqualError(t, err, "caller doctor1 with role 'doctor' is not permitted to call SweepExpiredPrescriptions")
+
+	transactionContext, _ = newEndorsement(sweepState(t), testTxTime, adminIdentity("Org1MSP", "org1admin"))
+	_, err = smartContract.SweepExpiredPrescriptions(transactionContext, "", 501)
+	require.EqualError(t, err, "limit must be at most 500")
+}
@@ -0,0 +1,121 @@
+// Command sweeper periodically submits SweepExpiredPrescriptions so that prescriptions past
+// their expiry date stop being dispensable even when nobody checks them individually.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"rest-api-go/web"
+)
+
+// sweepReport is the part of the chaincode's SweepReport the sweeper uses.
+type sweepReport struct {
+	Expired  int    `json:"Expired"`
+	Bookmark string `json:"Bookmark"`
+}
+
+// submitter submits a transaction and returns its result once committed.
+type submitter interface {
+	SubmitTransaction(name string, args ...string) ([]byte, error)
+}
+
+// sweep submits batches of at most limit prescriptions until no due prescriptions remain, and
+// returns how many were expired.
+func sweep(contract submitter, limit int) (int, error) {
+	expired := 0
+	bookmark := ""
+	for {
+		result, err := contract.SubmitTransaction("SweepExpiredPrescriptions", bookmark, strconv.Itoa(limit))
+		if err != nil {
+			return expired, fmt.Errorf("failed to submit sweep: %w", err)
+		}
+
+		var report sweepReport
+		if err := json.Unmarshal(result, &report); err != nil {
+			return expired, fmt.Errorf("failed to parse sweep report: %w", err)
+		}
+		expired += report.Expired
+		if report.Bookmark == "" {
+			return expired, nil
+		}
+		bookmark = report.Bookmark
+	}
+}
+
+// sweeperSetup returns the setup of the configured identity with the given name, or of the
+// first configured identity if name is empty.
+func sweeperSetup(config *web.ServerConfig, name string) (web.OrgSetup, error) {
+	setups := config.OrgSetups()
+	if name == "" {
+		return setups[0], nil
+	}
+	for i, identity := range config.Identities {
+		if identity.Name == name {
+			return setups[i], nil
+		}
+	}
+	return web.OrgSetup{}, fmt.Errorf("identity %s is not configured", name)
+}
+
+func main() {
+	configPath := flag.String("config", os.Getenv("REST_API_CONFIG"), "YAML or JSON server config naming an identity permitted to sweep")
+	identity := flag.String("identity", "", "configured identity to submit the sweep as; the first by default")
+	interval := flag.Duration("interval", time.Hour, "time between sweeps")
+	limit := flag.Int("limit", 100, "prescriptions expired per transaction, at most 500")
+	once := flag.Bool("once", false, "run a single sweep and exit")
+	flag.Parse()
+
+	config, err := web.LoadServerConfig(*configPath)
+	if err != nil {
+		fmt.Println("Error loading server config: ", err)
+		os.Exit(1)
+	}
+	slog.SetDefault(config.Logging.Logger(os.Stderr))
+
+	setup, err := sweeperSetup(config, *identity)
+	if err != nil {
+		slog.Error("Invalid sweeper identity", "error", err)
+		os.Exit(1)
+	}
+	orgSetup, err := web.Initialize(setup)
+	if err != nil {
+		slog.Error("Error initializing setup", "org", setup.OrgName, "error", err)
+		os.Exit(1)
+	}
+	contract := orgSetup.Gateway.GetNetwork(setup.ChannelID).GetContract(setup.ChaincodeID)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	ticker := time.NewTicker(*interval)
+	defer ticker.Stop()
+	for {
+		expired, err := sweep(contract, *limit)
+		if err != nil {
+			slog.Error("Sweep failed", "expired", expired, "error", err)
+		} else {
+			slog.Info("Sweep finished", "expired", expired)
+		}
+		if *once {
+			if err != nil {
+				os.Exit(1)
+			}
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"rest-api-go/web"
+)
+
+type fakeContract struct {
+	results   []string
+	err       error
+	bookmarks []string
+}
+
+func (f *fakeContract) SubmitTransaction(name string, args ...string) ([]byte, error) {
+	if name != "SweepExpiredPrescriptions" {
+		return nil, errors.New("unexpected transaction " + name)
+	}
+	f.bookmarks = append(f.bookmarks, args[0])
+	if len(f.results) == 0 {
+		return nil, f.err
+	}
+	result := f.results[0]
+	f.results = f.results[1:]
+	return []byte(result), nil
+}
+
+func TestSweepFollowsBookmarks(t *testing.T) {
+	contract := &fakeContract{results: []string{
+		`{"Expired":2,"Bookmark":"next"}`,
+		`{"Expired":1}`,
+	}}
+
+	expired, err := sweep(contract, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expired != 3 {
+		t.Errorf("expired = %d, want 3", expired)
+	}
+	if len(contract.bookmarks) != 2 || contract.bookmarks[0] != "" || contract.bookmarks[1] != "next" {
+		t.Errorf("bookmarks = %q, want [\"\" \"next\"]", contract.bookmarks)
+	}
+}
+
+func TestSweepReportsPartialProgress(t *testing.T) {
+	contract := &fakeContract{results: []string{`{"Expired":2,"Bookmark":"next"}`}, err: errors.New("endorsement failed")}
+
+	expired, err := sweep(contract, 2)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if expired != 2 {
+		t.Errorf("expired = %d, want 2", expired)
+	}
+}
+
+func TestSweeperSetupSelectsConfiguredIdentity(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(filename, []byte(`{
+		"ChannelID": "prescriptions",
+		"Orgs": [
+			{"Name": "Org1", "MSPID": "Org1MSP", "PeerEndpoint": "dns:///peer0.org1:7051", "TLSCertPath": "org1/ca.crt"},
+			{"Name": "Org2", "MSPID": "Org2MSP", "PeerEndpoint": "dns:///peer0.org2:9051", "TLSCertPath": "org2/ca.crt"}
+		],
+		"Identities": [
+			{"Name": "user1", "Org": "Org1", "CertPath": "org1/user1/cert.pem", "KeyPath": "org1/user1/keystore", "Token": "user-token"},
+			{"Name": "admin", "Org": "Org2", "CertPath": "org2/admin/cert.pem", "KeyPath": "org2/admin/keystore", "Token": "admin-token"}
+		]
+	}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	config, err := web.LoadServerConfig(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	setup, err := sweeperSetup(config, "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if setup.MSPID != "Org2MSP" || setup.PeerEndpoint != "dns:///peer0.org2:9051" || setup.ChannelID != "prescriptions" || setup.ChaincodeID != "basic" {
+		t.Errorf("setup = %+v, want Org2MSP on dns:///peer0.org2:9051 for prescriptions/basic", setup)
+	}
+	if want := filepath.Join(filepath.Dir(filename), "org2/admin/cert.pem"); setup.CertPath != want {
+		t.Errorf("CertPath = %q, want %q", setup.CertPath, want)
+	}
+
+	setup, err = sweeperSetup(config, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if setup.MSPID != "Org1MSP" {
+		t.Errorf("default setup MSPID = %q, want Org1MSP", setup.MSPID)
+	}
+
+	if _, err := sweeperSetup(config, "nobody"); err == nil || err.Error() != "identity nobody is not configured" {
+		t.Errorf("err = %v, want identity nobody is not configured", err)
+	}
+}
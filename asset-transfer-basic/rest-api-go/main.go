@@ -1,26 +1,41 @@
 package main
 
 import (
+	"flag"
 	"fmt"
+	"log/slog"
+	"os"
 	"rest-api-go/web"
 )
 
 func main() {
-	//Initialize setup for Org1
-	cryptoPath := "../../primary-network/organizations/peerOrganizations/org1.example.com"
-	orgConfig := web.OrgSetup{
-		OrgName:      "Org1",
-		MSPID:        "Org1MSP",
-		CertPath:     cryptoPath + "/users/User1@org1.example.com/msp/signcerts/cert.pem",
-		KeyPath:      cryptoPath + "/users/User1@org1.example.com/msp/keystore/",
-		TLSCertPath:  cryptoPath + "/peers/peer0.org1.example.com/tls/ca.crt",
-		PeerEndpoint: "dns:///localhost:7051",
-		GatewayPeer:  "peer0.org1.example.com",
+	configPath := flag.String("config", os.Getenv("REST_API_CONFIG"), "YAML or JSON server config; without it the server connects as Org1's User1")
+	check := flag.Bool("check", false, "check that every identity can connect, print a report and exit")
+	flag.Parse()
+
+	config, err := web.LoadServerConfig(*configPath)
+	if err != nil {
+		fmt.Println("Error loading server config: ", err)
+		os.Exit(1)
 	}
+	slog.SetDefault(config.Logging.Logger(os.Stderr))
 
-	orgSetup, err := web.Initialize(orgConfig)
+	if *check {
+		report := web.Preflight(config, web.Initialize)
+		report.Print(os.Stdout)
+		if report.Failed() {
+			os.Exit(1)
+		}
+		return
+	}
+
+	handler, err := web.NewServer(config, web.Initialize)
 	if err != nil {
-		fmt.Println("Error initializing setup for Org1: ", err)
+		fmt.Println("Error initializing identities: ", err)
+		os.Exit(1)
+	}
+	if err := web.ServeHandler(config.ListenAddress, handler); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
 	}
-	web.Serve(web.OrgSetup(*orgSetup))
 }
@@ -1,7 +1,7 @@
 package web
 
 import (
-	"fmt"
+	"log/slog"
 	"net/http"
 
 	"github.com/hyperledger/fabric-gateway/pkg/client"
@@ -15,17 +15,42 @@ type OrgSetup struct {
 	CertPath     string
 	KeyPath      string
 	TLSCertPath  string
+	TLSCACert    []byte
 	PeerEndpoint string
 	GatewayPeer  string
+	ChannelID    string
+	ChaincodeID  string
+	Timeouts     TimeoutConfig
 	Gateway      client.Gateway
+	EventSource  ChaincodeEventSource
+	Contract     DomainContract
+}
+
+// Handler routes requests to the generic /query and /invoke endpoints, the event stream and
+// the resource endpoints.
+func (setup *OrgSetup) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/query", setup.Query)
+	mux.HandleFunc("/invoke", setup.Invoke)
+	mux.HandleFunc("/events", setup.Events)
+	mux.HandleFunc("GET /patients/{id}", setup.ReadPatient)
+	mux.HandleFunc("POST /patients/{id}/prescriptions", setup.CreatePrescriptions)
+	mux.HandleFunc("POST /prescriptions/{id}/dispense", setup.DispensePrescription)
+	mux.HandleFunc("POST /prescriptions/{id}/revoke", setup.RevokePrescription)
+	mux.HandleFunc("GET /doctors/{id}/prescriptions", setup.DoctorPrescriptions)
+	return mux
 }
 
 // Serve starts http web server.
 func Serve(setups OrgSetup) {
-	http.HandleFunc("/query", setups.Query)
-	http.HandleFunc("/invoke", setups.Invoke)
-	fmt.Println("Listening (http://localhost:45000/)...")
-	if err := http.ListenAndServe(":45000", nil); err != nil {
-		fmt.Println(err)
+	if err := ServeHandler(defaultListenAddress, setups.Handler()); err != nil {
+		slog.Error("Server stopped", "error", err)
 	}
 }
+
+// ServeHandler starts http web server on the address with the given handler, such as a
+// MultiOrgServer.
+func ServeHandler(address string, handler http.Handler) error {
+	slog.Info("Listening", "address", address)
+	return http.ListenAndServe(address, handler)
+}
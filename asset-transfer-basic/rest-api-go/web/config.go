@@ -0,0 +1,511 @@
+package web
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// envPrefix prefixes the environment variables that override server config settings.
+const envPrefix = "REST_API_"
+
+const (
+	defaultListenAddress       = ":45000"
+	defaultEvaluateTimeout     = 5 * time.Second
+	defaultEndorseTimeout      = 15 * time.Second
+	defaultSubmitTimeout       = 5 * time.Second
+	defaultCommitStatusTimeout = 1 * time.Minute
+)
+
+// Duration is a time.Duration written as a string such as "15s" in config files.
+type Duration time.Duration
+
+func (duration *Duration) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return fmt.Errorf("duration must be a string such as \"15s\"")
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+	*duration = Duration(parsed)
+	return nil
+}
+
+// TimeoutConfig limits how long each step of a Gateway transaction may take. Zero values are
+// replaced by the defaults.
+type TimeoutConfig struct {
+	Evaluate     Duration `json:"Evaluate"`
+	Endorse      Duration `json:"Endorse"`
+	Submit       Duration `json:"Submit"`
+	CommitStatus Duration `json:"CommitStatus"`
+}
+
+func (timeouts TimeoutConfig) withDefaults() TimeoutConfig {
+	defaults := map[*Duration]time.Duration{
+		&timeouts.Evaluate:     defaultEvaluateTimeout,
+		&timeouts.Endorse:      defaultEndorseTimeout,
+		&timeouts.Submit:       defaultSubmitTimeout,
+		&timeouts.CommitStatus: defaultCommitStatusTimeout,
+	}
+	for timeout, value := range defaults {
+		if *timeout == 0 {
+			*timeout = Duration(value)
+		}
+	}
+	return timeouts
+}
+
+// LoggingConfig selects the level, one of debug, info, warn or error, and the format, text or
+// json, of the server's log.
+type LoggingConfig struct {
+	Level  string `json:"Level"`
+	Format string `json:"Format"`
+}
+
+// Logger returns a logger that writes to w as configured.
+func (config LoggingConfig) Logger(w io.Writer) *slog.Logger {
+	var level slog.Level
+	_ = level.UnmarshalText([]byte(config.Level))
+	options := &slog.HandlerOptions{Level: level}
+	if strings.EqualFold(config.Format, "json") {
+		return slog.New(slog.NewJSONHandler(w, options))
+	}
+	return slog.New(slog.NewTextHandler(w, options))
+}
+
+// OrgConfig describes an organization's Gateway peer. With a ConnectionProfile, such as the
+// connection-org1.yaml written by ccp-generate.sh, the settings left empty are read from the
+// profile: Name from its client organization, MSPID from the organization, and PeerEndpoint,
+// GatewayPeer and the TLS CA certificate from the peer named by GatewayPeer, or else the
+// organization's first peer.
+type OrgConfig struct {
+	Name              string `json:"Name"`
+	MSPID             string `json:"MSPID"`
+	ConnectionProfile string `json:"ConnectionProfile"`
+	PeerEndpoint      string `json:"PeerEndpoint"`
+	GatewayPeer       string `json:"GatewayPeer"`
+	TLSCertPath       string `json:"TLSCertPath"`
+
+	// tlsCACert is the PEM TLS CA certificate embedded in the connection profile.
+	tlsCACert []byte
+}
+
+// IdentityConfig describes an enrolled user of an organization that the server acts as.
+// Clients authenticate as the identity by sending Token as a bearer token. KeyPath is the
+// user's keystore directory.
+type IdentityConfig struct {
+	Name     string `json:"Name"`
+	Org      string `json:"Org"`
+	CertPath string `json:"CertPath"`
+	KeyPath  string `json:"KeyPath"`
+	Token    string `json:"Token"`
+}
+
+// ServerConfig configures the REST server, the organizations it connects to and the
+// identities it acts as. A server with a single identity may leave its Token empty to serve
+// requests without authentication. Relative paths are resolved against the directory of the
+// configuration file.
+type ServerConfig struct {
+	ListenAddress string           `json:"ListenAddress"`
+	ChannelID     string           `json:"ChannelID"`
+	ChaincodeID   string           `json:"ChaincodeID"`
+	Timeouts      TimeoutConfig    `json:"Timeouts"`
+	Logging       LoggingConfig    `json:"Logging"`
+	Orgs          []OrgConfig      `json:"Orgs"`
+	Identities    []IdentityConfig `json:"Identities"`
+}
+
+// DefaultServerConfig returns the config of a server that connects to the test network as
+// Org1's User1, relative to the rest-api-go directory.
+func DefaultServerConfig() *ServerConfig {
+	cryptoPath := "../../primary-network/organizations/peerOrganizations/org1.example.com"
+	return &ServerConfig{
+		Orgs: []OrgConfig{{
+			Name:         "Org1",
+			MSPID:        "Org1MSP",
+			PeerEndpoint: "dns:///localhost:7051",
+			GatewayPeer:  "peer0.org1.example.com",
+			TLSCertPath:  cryptoPath + "/peers/peer0.org1.example.com/tls/ca.crt",
+		}},
+		Identities: []IdentityConfig{{
+			Name:     "User1@org1.example.com",
+			Org:      "Org1",
+			CertPath: cryptoPath + "/users/User1@org1.example.com/msp/signcerts/cert.pem",
+			KeyPath:  cryptoPath + "/users/User1@org1.example.com/msp/keystore/",
+		}},
+	}
+}
+
+// LoadServerConfig reads a ServerConfig from a YAML (.yaml or .yml) or JSON file, or returns
+// DefaultServerConfig if filename is empty. Connection profiles are then read, environment
+// variables override the settings they name, and the result is validated.
+//
+// The environment variables are REST_API_LISTEN_ADDRESS, REST_API_CHANNEL_ID,
+// REST_API_CHAINCODE_ID, REST_API_{EVALUATE,ENDORSE,SUBMIT,COMMIT_STATUS}_TIMEOUT,
+// REST_API_LOG_{LEVEL,FORMAT}, REST_API_ORG_<org>_{MSPID,PEER_ENDPOINT,GATEWAY_PEER,TLS_CERT_PATH}
+// and REST_API_IDENTITY_<identity>_{CERT_PATH,KEY_PATH,TOKEN}, where <org> and <identity> are
+// the upper-cased name with other characters than letters and digits replaced by underscores,
+// e.g. REST_API_IDENTITY_USER1_ORG1_EXAMPLE_COM_TOKEN.
+func LoadServerConfig(filename string) (*ServerConfig, error) {
+	config := DefaultServerConfig()
+	source := "default server config"
+	if filename != "" {
+		config = &ServerConfig{}
+		source = "server config " + filename
+		if err := decodeConfigFile(filename, config, true); err != nil {
+			return nil, fmt.Errorf("failed to load server config: %w", err)
+		}
+		config.resolvePaths(filepath.Dir(filename))
+	}
+	for i := range config.Orgs {
+		if err := config.Orgs[i].applyConnectionProfile(); err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", source, err)
+		}
+	}
+	if err := config.applyEnv(); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", source, err)
+	}
+	config.applyDefaults()
+	if err := config.validate(); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", source, err)
+	}
+	return config, nil
+}
+
+// decodeConfigFile decodes a JSON or YAML file into value. YAML is converted to JSON first,
+// so both formats use the JSON field names, which match case-insensitively. If strict is
+// set, unknown fields are rejected.
+func decodeConfigFile(filename string, value interface{}, strict bool) error {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".yaml", ".yml":
+		var document interface{}
+		if err := yaml.Unmarshal(data, &document); err != nil {
+			return fmt.Errorf("failed to parse %s: %w", filename, err)
+		}
+		if data, err = json.Marshal(document); err != nil {
+			return fmt.Errorf("failed to parse %s: %w", filename, err)
+		}
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	if strict {
+		decoder.DisallowUnknownFields()
+	}
+	if err := decoder.Decode(value); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", filename, err)
+	}
+	return nil
+}
+
+func resolvePath(dir string, path string) string {
+	if path == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(dir, path)
+}
+
+func (config *ServerConfig) resolvePaths(dir string) {
+	for i := range config.Orgs {
+		config.Orgs[i].ConnectionProfile = resolvePath(dir, config.Orgs[i].ConnectionProfile)
+		config.Orgs[i].TLSCertPath = resolvePath(dir, config.Orgs[i].TLSCertPath)
+	}
+	for i := range config.Identities {
+		config.Identities[i].CertPath = resolvePath(dir, config.Identities[i].CertPath)
+		config.Identities[i].KeyPath = resolvePath(dir, config.Identities[i].KeyPath)
+	}
+}
+
+// connectionProfile is the part of a Fabric common connection profile that describes an
+// organization's peers.
+type connectionProfile struct {
+	Client struct {
+		Organization string `json:"organization"`
+	} `json:"client"`
+	Organizations map[string]struct {
+		MSPID string   `json:"mspid"`
+		Peers []string `json:"peers"`
+	} `json:"organizations"`
+	Peers map[string]struct {
+		URL        string `json:"url"`
+		TLSCACerts struct {
+			PEM  string `json:"pem"`
+			Path string `json:"path"`
+		} `json:"tlsCACerts"`
+		GRPCOptions struct {
+			SSLTargetNameOverride string `json:"ssl-target-name-override"`
+			HostnameOverride      string `json:"hostnameOverride"`
+		} `json:"grpcOptions"`
+	} `json:"peers"`
+}
+
+// applyConnectionProfile fills the settings the org leaves empty from its connection profile.
+func (org *OrgConfig) applyConnectionProfile() error {
+	if org.ConnectionProfile == "" {
+		return nil
+	}
+	var profile connectionProfile
+	if err := decodeConfigFile(org.ConnectionProfile, &profile, false); err != nil {
+		return fmt.Errorf("failed to load connection profile: %w", err)
+	}
+	if org.Name == "" {
+		org.Name = profile.Client.Organization
+	}
+	profileOrg, ok := profile.Organizations[org.Name]
+	if !ok {
+		return fmt.Errorf("connection profile %s does not describe org %q", org.ConnectionProfile, org.Name)
+	}
+	if org.MSPID == "" {
+		org.MSPID = profileOrg.MSPID
+	}
+
+	peerName := org.GatewayPeer
+	if peerName == "" {
+		if len(profileOrg.Peers) == 0 {
+			return fmt.Errorf("connection profile %s lists no peers for org %s", org.ConnectionProfile, org.Name)
+		}
+		peerName = profileOrg.Peers[0]
+	}
+	peer, ok := profile.Peers[peerName]
+	if !ok {
+		return fmt.Errorf("connection profile %s does not describe peer %s", org.ConnectionProfile, peerName)
+	}
+	if org.PeerEndpoint == "" {
+		endpoint, err := peerEndpoint(peer.URL)
+		if err != nil {
+			return fmt.Errorf("peer %s in connection profile %s: %w", peerName, org.ConnectionProfile, err)
+		}
+		org.PeerEndpoint = endpoint
+	}
+	if org.GatewayPeer == "" {
+		org.GatewayPeer = peer.GRPCOptions.SSLTargetNameOverride
+		if org.GatewayPeer == "" {
+			org.GatewayPeer = peer.GRPCOptions.HostnameOverride
+		}
+		if org.GatewayPeer == "" {
+			org.GatewayPeer = peerName
+		}
+	}
+	if org.TLSCertPath == "" {
+		if peer.TLSCACerts.PEM != "" {
+			org.tlsCACert = []byte(peer.TLSCACerts.PEM)
+		} else {
+			org.TLSCertPath = resolvePath(filepath.Dir(org.ConnectionProfile), peer.TLSCACerts.Path)
+		}
+	}
+	return nil
+}
+
+// peerEndpoint converts a connection profile peer URL such as grpcs://localhost:7051 to a gRPC
+// target.
+func peerEndpoint(peerURL string) (string, error) {
+	parsed, err := url.Parse(peerURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid peer url %q: %w", peerURL, err)
+	}
+	if parsed.Scheme != "grpcs" || parsed.Host == "" {
+		return "", fmt.Errorf("peer url %q must have the form grpcs://host:port", peerURL)
+	}
+	return "dns:///" + parsed.Host, nil
+}
+
+// envName converts a name to the form used in environment variable names.
+func envName(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		default:
+			return '_'
+		}
+	}, name)
+}
+
+// applyEnv overrides settings with the environment variables listed on LoadServerConfig.
+func (config *ServerConfig) applyEnv() error {
+	type setting struct {
+		name  string
+		value *string
+	}
+	settings := []setting{
+		{"LISTEN_ADDRESS", &config.ListenAddress},
+		{"CHANNEL_ID", &config.ChannelID},
+		{"CHAINCODE_ID", &config.ChaincodeID},
+		{"LOG_LEVEL", &config.Logging.Level},
+		{"LOG_FORMAT", &config.Logging.Format},
+	}
+	for i := range config.Orgs {
+		org := &config.Orgs[i]
+		prefix := "ORG_" + envName(org.Name) + "_"
+		settings = append(settings,
+			setting{prefix + "MSPID", &org.MSPID},
+			setting{prefix + "PEER_ENDPOINT", &org.PeerEndpoint},
+			setting{prefix + "GATEWAY_PEER", &org.GatewayPeer},
+			setting{prefix + "TLS_CERT_PATH", &org.TLSCertPath},
+		)
+	}
+	for i := range config.Identities {
+		identity := &config.Identities[i]
+		prefix := "IDENTITY_" + envName(identity.Name) + "_"
+		settings = append(settings,
+			setting{prefix + "CERT_PATH", &identity.CertPath},
+			setting{prefix + "KEY_PATH", &identity.KeyPath},
+			setting{prefix + "TOKEN", &identity.Token},
+		)
+	}
+	for _, setting := range settings {
+		if value, ok := os.LookupEnv(envPrefix + setting.name); ok {
+			*setting.value = value
+		}
+	}
+
+	timeouts := []struct {
+		name  string
+		value *Duration
+	}{
+		{"EVALUATE_TIMEOUT", &config.Timeouts.Evaluate},
+		{"ENDORSE_TIMEOUT", &config.Timeouts.Endorse},
+		{"SUBMIT_TIMEOUT", &config.Timeouts.Submit},
+		{"COMMIT_STATUS_TIMEOUT", &config.Timeouts.CommitStatus},
+	}
+	for _, timeout := range timeouts {
+		value, ok := os.LookupEnv(envPrefix + timeout.name)
+		if !ok {
+			continue
+		}
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("%s%s: %w", envPrefix, timeout.name, err)
+		}
+		*timeout.value = Duration(parsed)
+	}
+	return nil
+}
+
+func (config *ServerConfig) applyDefaults() {
+	if config.ListenAddress == "" {
+		config.ListenAddress = defaultListenAddress
+	}
+	if config.ChannelID == "" {
+		config.ChannelID = defaultChannelID
+	}
+	if config.ChaincodeID == "" {
+		config.ChaincodeID = defaultChaincodeID
+	}
+	if config.Logging.Level == "" {
+		config.Logging.Level = "info"
+	}
+	if config.Logging.Format == "" {
+		config.Logging.Format = "text"
+	}
+	config.Timeouts = config.Timeouts.withDefaults()
+}
+
+func (config *ServerConfig) validate() error {
+	if _, _, err := net.SplitHostPort(config.ListenAddress); err != nil {
+		return fmt.Errorf("invalid ListenAddress %q: %w", config.ListenAddress, err)
+	}
+	timeouts := map[string]Duration{
+		"Evaluate":     config.Timeouts.Evaluate,
+		"Endorse":      config.Timeouts.Endorse,
+		"Submit":       config.Timeouts.Submit,
+		"CommitStatus": config.Timeouts.CommitStatus,
+	}
+	for name, timeout := range timeouts {
+		if timeout < 0 {
+			return fmt.Errorf("the %s timeout must not be negative", name)
+		}
+	}
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(config.Logging.Level)); err != nil {
+		return fmt.Errorf("log level must be debug, info, warn or error, not %q", config.Logging.Level)
+	}
+	if format := strings.ToLower(config.Logging.Format); format != "text" && format != "json" {
+		return fmt.Errorf("log format must be text or json, not %q", config.Logging.Format)
+	}
+
+	orgs := map[string]bool{}
+	for _, org := range config.Orgs {
+		if org.Name == "" || org.MSPID == "" || org.PeerEndpoint == "" {
+			return fmt.Errorf("every org requires a Name, MSPID and PeerEndpoint")
+		}
+		if org.TLSCertPath == "" && len(org.tlsCACert) == 0 {
+			return fmt.Errorf("org %s requires a TLSCertPath or a connection profile with the peer's TLS CA certificate", org.Name)
+		}
+		if orgs[org.Name] {
+			return fmt.Errorf("org %s is configured twice", org.Name)
+		}
+		orgs[org.Name] = true
+	}
+	if len(config.Identities) == 0 {
+		return fmt.Errorf("at least one identity is required")
+	}
+	tokens := map[string]bool{}
+	for _, identity := range config.Identities {
+		if identity.Name == "" {
+			return fmt.Errorf("every identity requires a Name")
+		}
+		if !orgs[identity.Org] {
+			return fmt.Errorf("identity %s names unknown org %q", identity.Name, identity.Org)
+		}
+		if identity.CertPath == "" || identity.KeyPath == "" {
+			return fmt.Errorf("identity %s requires a CertPath and KeyPath", identity.Name)
+		}
+		if identity.Token == "" {
+			if len(config.Identities) > 1 {
+				return fmt.Errorf("identity %s requires a Token", identity.Name)
+			}
+			continue
+		}
+		if tokens[identity.Token] {
+			return fmt.Errorf("identity %s reuses the token of another identity", identity.Name)
+		}
+		tokens[identity.Token] = true
+	}
+	return nil
+}
+
+// OrgSetups returns the setup of each identity, in the order they are configured.
+func (config *ServerConfig) OrgSetups() []OrgSetup {
+	orgs := map[string]OrgConfig{}
+	for _, org := range config.Orgs {
+		orgs[org.Name] = org
+	}
+	setups := make([]OrgSetup, 0, len(config.Identities))
+	for _, identity := range config.Identities {
+		org := orgs[identity.Org]
+		setup := OrgSetup{
+			OrgName:      org.Name,
+			MSPID:        org.MSPID,
+			CertPath:     identity.CertPath,
+			KeyPath:      identity.KeyPath,
+			TLSCertPath:  org.TLSCertPath,
+			PeerEndpoint: org.PeerEndpoint,
+			GatewayPeer:  org.GatewayPeer,
+			ChannelID:    config.ChannelID,
+			ChaincodeID:  config.ChaincodeID,
+			Timeouts:     config.Timeouts,
+		}
+		if org.TLSCertPath == "" {
+			setup.TLSCACert = org.tlsCACert
+		}
+		setups = append(setups, setup)
+	}
+	return setups
+}
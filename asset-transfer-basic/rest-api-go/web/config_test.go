@@ -0,0 +1,210 @@
+package web
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testServerConfig = `{
+	"ChannelID": "mychannel",
+	"ChaincodeID": "basic",
+	"Orgs": [
+		{"Name": "Org1", "MSPID": "Org1MSP", "PeerEndpoint": "dns:///localhost:7051", "GatewayPeer": "peer0.org1.example.com", "TLSCertPath": "org1/ca.crt"},
+		{"Name": "Org2", "MSPID": "Org2MSP", "PeerEndpoint": "dns:///localhost:9051", "GatewayPeer": "peer0.org2.example.com", "TLSCertPath": "/etc/org2/ca.crt"}
+	],
+	"Identities": [
+		{"Name": "doctor1", "Org": "Org1", "CertPath": "org1/doctor1/cert.pem", "KeyPath": "org1/doctor1/keystore", "Token": "doctor-token"},
+		{"Name": "pharmacist1", "Org": "Org2", "CertPath": "org2/pharmacist1/cert.pem", "KeyPath": "org2/pharmacist1/keystore", "Token": "pharmacist-token"}
+	]
+}`
+
+func writeServerConfig(t *testing.T, config string) string {
+	t.Helper()
+	return writeFile(t, t.TempDir(), "config.json", config)
+}
+
+func writeFile(t *testing.T, dir string, name string, content string) string {
+	t.Helper()
+	filename := filepath.Join(dir, name)
+	if err := os.WriteFile(filename, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return filename
+}
+
+func TestLoadServerConfig(t *testing.T) {
+	filename := writeServerConfig(t, testServerConfig)
+	config, err := LoadServerConfig(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	setups := config.OrgSetups()
+	if len(setups) != 2 {
+		t.Fatalf("expected a setup per identity, got %d", len(setups))
+	}
+	dir := filepath.Dir(filename)
+	if setups[0].MSPID != "Org1MSP" || setups[0].CertPath != filepath.Join(dir, "org1/doctor1/cert.pem") || setups[0].TLSCertPath != filepath.Join(dir, "org1/ca.crt") {
+		t.Errorf("unexpected Org1 setup %+v", setups[0])
+	}
+	if setups[1].PeerEndpoint != "dns:///localhost:9051" || setups[1].TLSCertPath != "/etc/org2/ca.crt" || setups[1].ChannelID != "mychannel" {
+		t.Errorf("unexpected Org2 setup %+v", setups[1])
+	}
+
+	tests := map[string]string{
+		"unknown org":    strings.Replace(testServerConfig, `"Org": "Org2"`, `"Org": "Org3"`, 1),
+		"shared token":   strings.Replace(testServerConfig, "pharmacist-token", "doctor-token", 1),
+		"missing token":  strings.Replace(testServerConfig, `"Token": "doctor-token"`, `"Token": ""`, 1),
+		"duplicate org":  strings.Replace(testServerConfig, `"Name": "Org2"`, `"Name": "Org1"`, 1),
+		"missing mspid":  strings.Replace(testServerConfig, `"MSPID": "Org1MSP", `, ``, 1),
+		"malformed JSON": testServerConfig[:40],
+		"no identities":  `{"Orgs":[{"Name":"Org1","MSPID":"Org1MSP","PeerEndpoint":"dns:///localhost:7051","TLSCertPath":"ca.crt"}],"Identities":[]}`,
+		"unknown field":  strings.Replace(testServerConfig, `"ChannelID"`, `"Channel"`, 1),
+		"log level":      strings.Replace(testServerConfig, `"ChannelID"`, `"Logging": {"Level": "verbose"}, "ChannelID"`, 1),
+		"log format":     strings.Replace(testServerConfig, `"ChannelID"`, `"Logging": {"Format": "xml"}, "ChannelID"`, 1),
+		"listen address": strings.Replace(testServerConfig, `"ChannelID"`, `"ListenAddress": "45000", "ChannelID"`, 1),
+		"timeout":        strings.Replace(testServerConfig, `"ChannelID"`, `"Timeouts": {"Submit": "-5s"}, "ChannelID"`, 1),
+		"duration":       strings.Replace(testServerConfig, `"ChannelID"`, `"Timeouts": {"Submit": 5}, "ChannelID"`, 1),
+		"no TLS CA":      strings.Replace(testServerConfig, `, "TLSCertPath": "org1/ca.crt"`, ``, 1),
+	}
+	for name, config := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := LoadServerConfig(writeServerConfig(t, config)); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
+
+const testConnectionProfile = `---
+name: test-network-org1
+version: 1.0.0
+client:
+  organization: Org1
+organizations:
+  Org1:
+    mspid: Org1MSP
+    peers:
+    - peer0.org1.example.com
+peers:
+  peer0.org1.example.com:
+    url: grpcs://localhost:7051
+    tlsCACerts:
+      pem: |
+          -----BEGIN CERTIFICATE-----
+          MIIB
+          -----END CERTIFICATE-----
+    grpcOptions:
+      ssl-target-name-override: peer0.org1.example.com
+      hostnameOverride: peer0.org1.example.com
+`
+
+func TestLoadServerConfigFromYAMLWithConnectionProfiles(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "connection-org1.yaml", testConnectionProfile)
+	writeFile(t, dir, "connection-org2.json", `{
+		"client": {"organization": "Org2"},
+		"organizations": {"Org2": {"mspid": "Org2MSP", "peers": ["peer0.org2.example.com"]}},
+		"peers": {"peer0.org2.example.com": {
+			"url": "grpcs://localhost:9051",
+			"tlsCACerts": {"path": "tls/ca.crt"},
+			"grpcOptions": {"ssl-target-name-override": "peer0.org2.example.com"}
+		}}
+	}`)
+	filename := writeFile(t, dir, "config.yaml", `
+listenAddress: "127.0.0.1:8080"
+timeouts:
+  endorse: 30s
+logging:
+  level: debug
+  format: json
+orgs:
+  - connectionProfile: connection-org1.yaml
+  - connectionProfile: connection-org2.json
+    peerEndpoint: dns:///peer0.org2.example.com:9051
+identities:
+  - name: doctor1
+    org: Org1
+    certPath: doctor1/cert.pem
+    keyPath: doctor1/keystore
+    token: doctor-token
+  - name: pharmacist1
+    org: Org2
+    certPath: pharmacist1/cert.pem
+    keyPath: pharmacist1/keystore
+    token: pharmacist-token
+`)
+	config, err := LoadServerConfig(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.ListenAddress != "127.0.0.1:8080" || config.Logging.Format != "json" || config.ChannelID != "mychannel" {
+		t.Errorf("unexpected server settings %+v", config)
+	}
+	if config.Timeouts.Endorse != Duration(30*time.Second) || config.Timeouts.Evaluate != Duration(defaultEvaluateTimeout) {
+		t.Errorf("unexpected timeouts %+v", config.Timeouts)
+	}
+
+	setups := config.OrgSetups()
+	org1, org2 := setups[0], setups[1]
+	if org1.OrgName != "Org1" || org1.MSPID != "Org1MSP" || org1.PeerEndpoint != "dns:///localhost:7051" || org1.GatewayPeer != "peer0.org1.example.com" {
+		t.Errorf("unexpected Org1 setup %+v", org1)
+	}
+	if !strings.HasPrefix(string(org1.TLSCACert), "-----BEGIN CERTIFICATE-----\nMIIB\n") || org1.TLSCertPath != "" {
+		t.Errorf("expected the TLS CA certificate from the profile, got %q", org1.TLSCACert)
+	}
+	if org2.MSPID != "Org2MSP" || org2.PeerEndpoint != "dns:///peer0.org2.example.com:9051" || org2.TLSCertPath != filepath.Join(dir, "tls/ca.crt") {
+		t.Errorf("unexpected Org2 setup %+v", org2)
+	}
+	if org2.CertPath != filepath.Join(dir, "pharmacist1/cert.pem") || org2.Timeouts.Endorse != Duration(30*time.Second) {
+		t.Errorf("unexpected Org2 identity %+v", org2)
+	}
+
+	writeFile(t, dir, "connection-org1.yaml", strings.Replace(testConnectionProfile, "grpcs://", "grpc://", 1))
+	if _, err := LoadServerConfig(filename); err == nil || !strings.Contains(err.Error(), "grpcs://host:port") {
+		t.Errorf("expected a plaintext peer url to be rejected, got %v", err)
+	}
+}
+
+func TestLoadServerConfigEnvironmentOverrides(t *testing.T) {
+	filename := writeServerConfig(t, testServerConfig)
+	t.Setenv("REST_API_LISTEN_ADDRESS", ":8443")
+	t.Setenv("REST_API_ENDORSE_TIMEOUT", "45s")
+	t.Setenv("REST_API_LOG_LEVEL", "warn")
+	t.Setenv("REST_API_ORG_ORG1_PEER_ENDPOINT", "dns:///peer0.org1.example.com:7051")
+	t.Setenv("REST_API_IDENTITY_PHARMACIST1_TOKEN", "rotated-token")
+
+	config, err := LoadServerConfig(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.ListenAddress != ":8443" || config.Timeouts.Endorse != Duration(45*time.Second) || config.Logging.Level != "warn" {
+		t.Errorf("server settings not overridden %+v", config)
+	}
+	if config.Orgs[0].PeerEndpoint != "dns:///peer0.org1.example.com:7051" || config.Identities[1].Token != "rotated-token" {
+		t.Errorf("org and identity settings not overridden %+v %+v", config.Orgs[0], config.Identities[1])
+	}
+
+	t.Setenv("REST_API_SUBMIT_TIMEOUT", "soon")
+	if _, err := LoadServerConfig(filename); err == nil || !strings.Contains(err.Error(), "REST_API_SUBMIT_TIMEOUT") {
+		t.Errorf("expected the invalid variable to be named, got %v", err)
+	}
+}
+
+func TestDefaultServerConfig(t *testing.T) {
+	t.Setenv("REST_API_CHANNEL_ID", "prescriptions")
+	config, err := LoadServerConfig("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	setups := config.OrgSetups()
+	if len(setups) != 1 || setups[0].MSPID != "Org1MSP" || setups[0].PeerEndpoint != "dns:///localhost:7051" || setups[0].ChannelID != "prescriptions" {
+		t.Errorf("unexpected default setup %+v", setups)
+	}
+	if config.ListenAddress != defaultListenAddress || config.Timeouts.CommitStatus != Duration(defaultCommitStatusTimeout) {
+		t.Errorf("unexpected defaults %+v", config)
+	}
+}
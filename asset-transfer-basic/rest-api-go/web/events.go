@@ -0,0 +1,189 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+)
+
+// keepAliveInterval is how often an idle event stream sends a comment line so that proxies
+// do not close the connection.
+const keepAliveInterval = 15 * time.Second
+
+// ChaincodeEventSource provides the chaincode events of a channel. The Gateway connection is
+// used unless OrgSetup.EventSource is set, e.g. to a stub in tests.
+type ChaincodeEventSource interface {
+	// ChaincodeEvents streams events emitted by chaincodeName on channelID until ctx is done.
+	// A nil checkpoint starts with the next committed block.
+	ChaincodeEvents(ctx context.Context, channelID string, chaincodeName string, checkpoint client.Checkpoint) (<-chan *client.ChaincodeEvent, error)
+}
+
+type gatewayEventSource struct {
+	gateway *client.Gateway
+}
+
+func (source gatewayEventSource) ChaincodeEvents(ctx context.Context, channelID string, chaincodeName string, checkpoint client.Checkpoint) (<-chan *client.ChaincodeEvent, error) {
+	var options []client.ChaincodeEventsOption
+	if checkpoint != nil {
+		if checkpoint.TransactionID() == "" {
+			options = append(options, client.WithStartBlock(checkpoint.BlockNumber()))
+		} else {
+			options = append(options, client.WithCheckpoint(checkpoint))
+		}
+	}
+	return source.gateway.GetNetwork(channelID).ChaincodeEvents(ctx, chaincodeName, options...)
+}
+
+// EventCheckpoint is the position of a chaincode event, sent to clients as the SSE event ID
+// in the form "<block>:<transaction ID>". Resuming from it skips the events up to and
+// including that transaction.
+type EventCheckpoint struct {
+	Block uint64
+	TxID  string
+}
+
+// BlockNumber implements client.Checkpoint.
+func (checkpoint EventCheckpoint) BlockNumber() uint64 {
+	return checkpoint.Block
+}
+
+// TransactionID implements client.Checkpoint.
+func (checkpoint EventCheckpoint) TransactionID() string {
+	return checkpoint.TxID
+}
+
+func (checkpoint EventCheckpoint) String() string {
+	return fmt.Sprintf("%d:%s", checkpoint.Block, checkpoint.TxID)
+}
+
+// ParseEventCheckpoint parses "<block>" or "<block>:<transaction ID>".
+func ParseEventCheckpoint(value string) (EventCheckpoint, error) {
+	blockText, transactionID, _ := strings.Cut(value, ":")
+	block, err := strconv.ParseUint(blockText, 10, 64)
+	if err != nil {
+		return EventCheckpoint{}, fmt.Errorf("invalid checkpoint %q: %w", value, err)
+	}
+	return EventCheckpoint{Block: block, TxID: transactionID}, nil
+}
+
+// eventFilter selects the events sent to a client.
+type eventFilter struct {
+	eventNames map[string]bool
+	patientID  string
+}
+
+// prescriptionEvent is the part of the chaincode's PrescriptionEvent payload the filter needs.
+type prescriptionEvent struct {
+	Prescriptions []struct {
+		PatientId string `json:"PatientId"`
+	} `json:"Prescriptions"`
+}
+
+func (filter eventFilter) matches(event *client.ChaincodeEvent) bool {
+	if len(filter.eventNames) > 0 && !filter.eventNames[event.EventName] {
+		return false
+	}
+	if filter.patientID == "" {
+		return true
+	}
+
+	var payload prescriptionEvent
+	if err := json.Unmarshal(event.Payload, &payload); err != nil {
+		return false
+	}
+	for _, prescription := range payload.Prescriptions {
+		if prescription.PatientId == filter.patientID {
+			return true
+		}
+	}
+	return false
+}
+
+// Events streams chaincode events to the client as Server-Sent Events.
+//
+// Query parameters: channelid and chaincodeid select the chaincode; event (repeatable) and
+// patientId filter the events; startBlock or checkpoint set where to start. A reconnecting
+// client's Last-Event-ID header takes precedence, so the stream resumes after the last event
+// it received.
+func (setup *OrgSetup) Events(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeErrorDetail(w, http.StatusInternalServerError, &ErrorDetail{Code: ErrorInternal, Message: "Streaming is not supported"})
+		return
+	}
+
+	queryParams := r.URL.Query()
+	chainCodeName := queryParams.Get("chaincodeid")
+	channelID := queryParams.Get("channelid")
+	filter := eventFilter{eventNames: map[string]bool{}, patientID: queryParams.Get("patientId")}
+	for _, name := range queryParams["event"] {
+		filter.eventNames[name] = true
+	}
+
+	var checkpoint client.Checkpoint
+	resumeFrom := r.Header.Get("Last-Event-ID")
+	if resumeFrom == "" {
+		resumeFrom = queryParams.Get("checkpoint")
+	}
+	if resumeFrom == "" {
+		resumeFrom = queryParams.Get("startBlock")
+	}
+	if resumeFrom != "" {
+		parsed, err := ParseEventCheckpoint(resumeFrom)
+		if err != nil {
+			writeBadRequest(w, err.Error())
+			return
+		}
+		checkpoint = parsed
+	}
+	slog.Debug("Events", "channel", channelID, "chaincode", chainCodeName, "events", queryParams["event"], "resumeFrom", resumeFrom)
+
+	source := setup.EventSource
+	if source == nil {
+		source = gatewayEventSource{gateway: &setup.Gateway}
+	}
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	events, err := source.ChaincodeEvents(ctx, channelID, chainCodeName, checkpoint)
+	if err != nil {
+		writeError(w, fmt.Errorf("Error connecting to chaincode events: %w", err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(keepAliveInterval)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+			flusher.Flush()
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			if !filter.matches(event) {
+				continue
+			}
+			id := EventCheckpoint{Block: event.BlockNumber, TxID: event.TransactionID}
+			fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", id, event.EventName, event.Payload)
+			flusher.Flush()
+		}
+	}
+}
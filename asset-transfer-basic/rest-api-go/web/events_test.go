@@ -0,0 +1,117 @@
+package web
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+)
+
+// stubEventSource replays a fixed list of events, skipping those up to the checkpoint as
+// the Gateway does.
+type stubEventSource struct {
+	events     []*client.ChaincodeEvent
+	checkpoint client.Checkpoint
+}
+
+func (source *stubEventSource) ChaincodeEvents(ctx context.Context, channelID string, chaincodeName string, checkpoint client.Checkpoint) (<-chan *client.ChaincodeEvent, error) {
+	source.checkpoint = checkpoint
+	events := make(chan *client.ChaincodeEvent, len(source.events))
+	skipping := checkpoint != nil && checkpoint.TransactionID() != ""
+	for _, event := range source.events {
+		if checkpoint != nil && event.BlockNumber < checkpoint.BlockNumber() {
+			continue
+		}
+		if skipping {
+			if event.TransactionID == checkpoint.TransactionID() {
+				skipping = false
+			}
+			continue
+		}
+		events <- event
+	}
+	close(events)
+	return events, nil
+}
+
+func newStubEventSource() *stubEventSource {
+	return &stubEventSource{events: []*client.ChaincodeEvent{
+		{BlockNumber: 5, TransactionID: "tx1", EventName: "PrescriptionCreated", Payload: []byte(`{"Prescriptions":[{"PatientId":"patient1","PrescriptionId":"rx1","Status":"Active"}]}`)},
+		{BlockNumber: 5, TransactionID: "tx2", EventName: "PrescriptionCreated", Payload: []byte(`{"Prescriptions":[{"PatientId":"patient2","PrescriptionId":"rx2","Status":"Active"}]}`)},
+		{BlockNumber: 7, TransactionID: "tx3", EventName: "PrescriptionDispensed", Payload: []byte(`{"Prescriptions":[{"PatientId":"patient1","PrescriptionId":"rx1","Status":"Dispensed"}]}`)},
+	}}
+}
+
+func streamEvents(t *testing.T, source *stubEventSource, query string, lastEventID string) []string {
+	t.Helper()
+	setup := &OrgSetup{EventSource: source}
+	request := httptest.NewRequest(http.MethodGet, "/events?channelid=mychannel&chaincodeid=basic"+query, nil)
+	if lastEventID != "" {
+		request.Header.Set("Last-Event-ID", lastEventID)
+	}
+	recorder := httptest.NewRecorder()
+	setup.Events(recorder, request)
+
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d: %s", recorder.Code, recorder.Body.String())
+	}
+	if contentType := recorder.Header().Get("Content-Type"); contentType != "text/event-stream" {
+		t.Fatalf("unexpected content type %q", contentType)
+	}
+
+	var ids []string
+	for _, line := range strings.Split(recorder.Body.String(), "\n") {
+		if id, ok := strings.CutPrefix(line, "id: "); ok {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+func TestEventsStreamsAllEvents(t *testing.T) {
+	ids := streamEvents(t, newStubEventSource(), "", "")
+	if strings.Join(ids, ",") != "5:tx1,5:tx2,7:tx3" {
+		t.Fatalf("unexpected events %v", ids)
+	}
+}
+
+func TestEventsFiltersByEventNameAndPatient(t *testing.T) {
+	ids := streamEvents(t, newStubEventSource(), "&event=PrescriptionDispensed", "")
+	if strings.Join(ids, ",") != "7:tx3" {
+		t.Fatalf("unexpected events filtered by name %v", ids)
+	}
+
+	ids = streamEvents(t, newStubEventSource(), "&patientId=patient1", "")
+	if strings.Join(ids, ",") != "5:tx1,7:tx3" {
+		t.Fatalf("unexpected events filtered by patient %v", ids)
+	}
+}
+
+func TestEventsResumeFromCheckpoint(t *testing.T) {
+	source := newStubEventSource()
+	ids := streamEvents(t, source, "", "5:tx1")
+	if strings.Join(ids, ",") != "5:tx2,7:tx3" {
+		t.Fatalf("unexpected events after Last-Event-ID %v", ids)
+	}
+	if source.checkpoint != (EventCheckpoint{Block: 5, TxID: "tx1"}) {
+		t.Fatalf("unexpected checkpoint %v", source.checkpoint)
+	}
+
+	ids = streamEvents(t, source, "&startBlock=7", "")
+	if strings.Join(ids, ",") != "7:tx3" {
+		t.Fatalf("unexpected events from start block %v", ids)
+	}
+}
+
+func TestEventsRejectsInvalidCheckpoint(t *testing.T) {
+	setup := &OrgSetup{EventSource: newStubEventSource()}
+	request := httptest.NewRequest(http.MethodGet, "/events?channelid=mychannel&chaincodeid=basic&checkpoint=latest", nil)
+	recorder := httptest.NewRecorder()
+	setup.Events(recorder, request)
+	if recorder.Code != http.StatusBadRequest {
+		t.Fatalf("unexpected status %d", recorder.Code)
+	}
+}
@@ -1,6 +1,7 @@
 package web
 
 import (
+	"crypto"
 	"crypto/x509"
 	"fmt"
 	"log"
@@ -18,33 +19,45 @@ import (
 // Initialize the setup for the organization.
 func Initialize(setup OrgSetup) (*OrgSetup, error) {
 	log.Printf("Initializing connection for %s...\n", setup.OrgName)
-	clientConnection := setup.newGrpcConnection()
-	id := setup.newIdentity()
-	sign := setup.newSign()
+	id, err := setup.newIdentity()
+	if err != nil {
+		return nil, err
+	}
+	sign, err := setup.newSign()
+	if err != nil {
+		return nil, err
+	}
+	clientConnection, err := setup.newGrpcConnection()
+	if err != nil {
+		return nil, err
+	}
+	timeouts := setup.Timeouts.withDefaults()
 
 	gateway, err := client.Connect(
 		id,
 		client.WithSign(sign),
 		client.WithHash(hash.SHA256),
 		client.WithClientConnection(clientConnection),
-		client.WithEvaluateTimeout(5*time.Second),
-		client.WithEndorseTimeout(15*time.Second),
-		client.WithSubmitTimeout(5*time.Second),
-		client.WithCommitStatusTimeout(1*time.Minute),
+		client.WithEvaluateTimeout(time.Duration(timeouts.Evaluate)),
+		client.WithEndorseTimeout(time.Duration(timeouts.Endorse)),
+		client.WithSubmitTimeout(time.Duration(timeouts.Submit)),
+		client.WithCommitStatusTimeout(time.Duration(timeouts.CommitStatus)),
 	)
 	if err != nil {
-		panic(err)
+		clientConnection.Close()
+		return nil, fmt.Errorf("failed to connect to the Gateway: %w", err)
 	}
 	setup.Gateway = *gateway
 	log.Println("Initialization complete")
 	return &setup, nil
 }
 
-// newGrpcConnection creates a gRPC connection to the Gateway server.
-func (setup OrgSetup) newGrpcConnection() *grpc.ClientConn {
-	certificate, err := loadCertificate(setup.TLSCertPath)
+// newGrpcConnection creates a gRPC connection to the Gateway server. The TLS CA certificate
+// is TLSCACert if set, as read from a connection profile, or else read from TLSCertPath.
+func (setup OrgSetup) newGrpcConnection() (*grpc.ClientConn, error) {
+	certificate, err := setup.tlsCertificate()
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 
 	certPool := x509.NewCertPool()
@@ -53,50 +66,79 @@ func (setup OrgSetup) newGrpcConnection() *grpc.ClientConn {
 
 	connection, err := grpc.NewClient(setup.PeerEndpoint, grpc.WithTransportCredentials(transportCredentials))
 	if err != nil {
-		panic(fmt.Errorf("failed to create gRPC connection: %w", err))
+		return nil, fmt.Errorf("failed to create gRPC connection to %s: %w", setup.PeerEndpoint, err)
 	}
 
-	return connection
+	return connection, nil
 }
 
 // newIdentity creates a client identity for this Gateway connection using an X.509 certificate.
-func (setup OrgSetup) newIdentity() *identity.X509Identity {
+func (setup OrgSetup) newIdentity() (*identity.X509Identity, error) {
 	certificate, err := loadCertificate(setup.CertPath)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 
 	id, err := identity.NewX509Identity(setup.MSPID, certificate)
 	if err != nil {
-		panic(err)
+		return nil, fmt.Errorf("failed to create identity for %s: %w", setup.MSPID, err)
 	}
 
-	return id
+	return id, nil
 }
 
 // newSign creates a function that generates a digital signature from a message digest using a private key.
-func (setup OrgSetup) newSign() identity.Sign {
-	files, err := os.ReadDir(setup.KeyPath)
+func (setup OrgSetup) newSign() (identity.Sign, error) {
+	privateKey, err := loadPrivateKey(setup.KeyPath)
 	if err != nil {
-		panic(fmt.Errorf("failed to read private key directory: %w", err))
+		return nil, err
 	}
-	privateKeyPEM, err := os.ReadFile(path.Join(setup.KeyPath, files[0].Name()))
 
+	sign, err := identity.NewPrivateKeySign(privateKey)
 	if err != nil {
-		panic(fmt.Errorf("failed to read private key file: %w", err))
+		return nil, fmt.Errorf("failed to create signer from private key in %s: %w", setup.KeyPath, err)
 	}
 
-	privateKey, err := identity.PrivateKeyFromPEM(privateKeyPEM)
+	return sign, nil
+}
+
+// loadPrivateKey reads the private key from the first file in a keystore directory.
+func loadPrivateKey(keyPath string) (crypto.PrivateKey, error) {
+	files, err := os.ReadDir(keyPath)
 	if err != nil {
-		panic(err)
+		return nil, fmt.Errorf("failed to read private key directory: %w", err)
+	}
+	var filename string
+	for _, file := range files {
+		if !file.IsDir() {
+			filename = path.Join(keyPath, file.Name())
+			break
+		}
+	}
+	if filename == "" {
+		return nil, fmt.Errorf("no private key file in %s", keyPath)
 	}
 
-	sign, err := identity.NewPrivateKeySign(privateKey)
+	privateKeyPEM, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read private key file: %w", err)
+	}
+	privateKey, err := identity.PrivateKeyFromPEM(privateKeyPEM)
 	if err != nil {
-		panic(err)
+		return nil, fmt.Errorf("failed to parse private key %s: %w", filename, err)
 	}
+	return privateKey, nil
+}
 
-	return sign
+func (setup OrgSetup) tlsCertificate() (*x509.Certificate, error) {
+	if len(setup.TLSCACert) > 0 {
+		certificate, err := identity.CertificateFromPEM(setup.TLSCACert)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse TLS CA certificate from connection profile: %w", err)
+		}
+		return certificate, nil
+	}
+	return loadCertificate(setup.TLSCertPath)
 }
 
 func loadCertificate(filename string) (*x509.Certificate, error) {
@@ -104,5 +146,9 @@ func loadCertificate(filename string) (*x509.Certificate, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to read certificate file: %w", err)
 	}
-	return identity.CertificateFromPEM(certificatePEM)
+	certificate, err := identity.CertificateFromPEM(certificatePEM)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse certificate %s: %w", filename, err)
+	}
+	return certificate, nil
 }
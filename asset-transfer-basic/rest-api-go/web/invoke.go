@@ -2,39 +2,79 @@ package web
 
 import (
 	"fmt"
+	"log/slog"
 	"net/http"
+	"strings"
 
 	"github.com/hyperledger/fabric-gateway/pkg/client"
 )
 
-// Invoke handles chaincode invoke requests.
+// Invoke handles chaincode invoke requests. It responds with a Response holding the result,
+// transaction ID and block number once the transaction has committed.
 func (setup *OrgSetup) Invoke(w http.ResponseWriter, r *http.Request) {
-	fmt.Println("Received Invoke request")
 	if err := r.ParseForm(); err != nil {
-		fmt.Fprintf(w, "ParseForm() err: %s", err)
+		writeBadRequest(w, fmt.Sprintf("ParseForm() err: %s", err))
 		return
 	}
 	chainCodeName := r.FormValue("chaincodeid")
 	channelID := r.FormValue("channelid")
 	function := r.FormValue("function")
 	args := r.Form["args"]
-	fmt.Printf("channel: %s, chaincode: %s, function: %s, args: %s\n", channelID, chainCodeName, function, args)
+	transient, err := parseTransient(r.Form["transient"])
+	if err != nil {
+		writeBadRequest(w, fmt.Sprintf("Error parsing transient data: %s", err))
+		return
+	}
+	// Transient values carry private data and are deliberately not logged.
+	slog.Debug("Invoke", "channel", channelID, "chaincode", chainCodeName, "function", function, "args", args)
 	network := setup.Gateway.GetNetwork(channelID)
 	contract := network.GetContract(chainCodeName)
-	txn_proposal, err := contract.NewProposal(function, client.WithArguments(args...))
+	committed, err := submitTransaction(contract, function, args, transient)
 	if err != nil {
-		fmt.Fprintf(w, "Error creating txn proposal: %s", err)
+		writeError(w, err)
 		return
 	}
-	txn_endorsed, err := txn_proposal.Endorse()
+	writeResult(w, http.StatusOK, committed.Result, committed.TransactionId, committed.BlockNumber)
+}
+
+// submitTransaction endorses and submits a transaction, and waits for it to commit. A
+// transaction that fails validation is returned as a commitFailure.
+func submitTransaction(contract *client.Contract, function string, args []string, transient map[string][]byte) (*CommittedTransaction, error) {
+	proposal, err := contract.NewProposal(function, client.WithArguments(args...), client.WithTransient(transient))
 	if err != nil {
-		fmt.Fprintf(w, "Error endorsing txn: %s", err)
-		return
+		return nil, err
 	}
-	txn_committed, err := txn_endorsed.Submit()
+	endorsed, err := proposal.Endorse()
 	if err != nil {
-		fmt.Fprintf(w, "Error submitting transaction: %s", err)
-		return
+		return nil, err
+	}
+	commit, err := endorsed.Submit()
+	if err != nil {
+		return nil, err
+	}
+	commitStatus, err := commit.Status()
+	if err != nil {
+		return nil, err
+	}
+	if !commitStatus.Successful {
+		return nil, &commitFailure{TransactionID: commitStatus.TransactionID, Code: commitStatus.Code}
+	}
+	return &CommittedTransaction{
+		Result:        endorsed.Result(),
+		TransactionId: commitStatus.TransactionID,
+		BlockNumber:   commitStatus.BlockNumber,
+	}, nil
+}
+
+// parseTransient converts "name=value" form values into a transient data map.
+func parseTransient(values []string) (map[string][]byte, error) {
+	transient := map[string][]byte{}
+	for _, value := range values {
+		name, data, ok := strings.Cut(value, "=")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("transient value must be of the form name=value")
+		}
+		transient[name] = []byte(data)
 	}
-	fmt.Fprintf(w, "Transaction ID : %s Response: %s", txn_committed.TransactionID(), txn_endorsed.Result())
+	return transient, nil
 }
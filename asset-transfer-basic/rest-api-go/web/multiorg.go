@@ -0,0 +1,92 @@
+package web
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+// ErrorUnauthenticated is the error code of requests without a valid bearer token.
+const ErrorUnauthenticated = "Unauthenticated"
+
+// identityRoute is a connected identity and the handler that serves its requests.
+type identityRoute struct {
+	name      string
+	tokenHash [sha256.Size]byte
+	setup     *OrgSetup
+	handler   http.Handler
+}
+
+// MultiOrgServer serves requests for several identities, each with its own Gateway. Each
+// request is authenticated by its bearer token and served as the identity the token
+// belongs to, so the chaincode sees that identity as the caller.
+type MultiOrgServer struct {
+	routes []identityRoute
+}
+
+// NewServer connects the identities in the config with initialize, which is Initialize outside
+// tests. A single identity without a token serves every request; otherwise requests are
+// routed by a MultiOrgServer.
+func NewServer(config *ServerConfig, initialize func(OrgSetup) (*OrgSetup, error)) (http.Handler, error) {
+	if len(config.Identities) == 1 && config.Identities[0].Token == "" {
+		identity := config.Identities[0]
+		setup, err := initialize(config.OrgSetups()[0])
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect identity %s of %s: %w", identity.Name, identity.Org, err)
+		}
+		return setup.Handler(), nil
+	}
+	return NewMultiOrgServer(config, initialize)
+}
+
+// NewMultiOrgServer connects every identity in the config with initialize, which is
+// Initialize outside tests.
+func NewMultiOrgServer(config *ServerConfig, initialize func(OrgSetup) (*OrgSetup, error)) (*MultiOrgServer, error) {
+	server := &MultiOrgServer{}
+	for i, setup := range config.OrgSetups() {
+		identity := config.Identities[i]
+		connected, err := initialize(setup)
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect identity %s of %s: %w", identity.Name, identity.Org, err)
+		}
+		server.routes = append(server.routes, identityRoute{
+			name:      identity.Name,
+			tokenHash: sha256.Sum256([]byte(identity.Token)),
+			setup:     connected,
+			handler:   connected.Handler(),
+		})
+	}
+	return server, nil
+}
+
+// route returns the identity whose token the request carries. Tokens are compared by their
+// hashes in constant time.
+func (server *MultiOrgServer) route(r *http.Request) *identityRoute {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || token == "" {
+		return nil
+	}
+	hash := sha256.Sum256([]byte(token))
+	var found *identityRoute
+	for i := range server.routes {
+		if subtle.ConstantTimeCompare(hash[:], server.routes[i].tokenHash[:]) == 1 {
+			found = &server.routes[i]
+		}
+	}
+	return found
+}
+
+// ServeHTTP serves the request as the authenticated identity.
+func (server *MultiOrgServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	route := server.route(r)
+	if route == nil {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="rest-api-go"`)
+		writeErrorDetail(w, http.StatusUnauthorized, &ErrorDetail{Code: ErrorUnauthenticated, Message: "a valid bearer token is required"})
+		return
+	}
+	slog.Info("Request", "method", r.Method, "path", r.URL.Path, "identity", route.name, "mspid", route.setup.MSPID)
+	route.handler.ServeHTTP(w, r)
+}
@@ -0,0 +1,77 @@
+package web
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMultiOrgServerRoutesByToken(t *testing.T) {
+	config, err := LoadServerConfig(writeServerConfig(t, testServerConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	contracts := map[string]*stubContract{}
+	server, err := NewMultiOrgServer(config, func(setup OrgSetup) (*OrgSetup, error) {
+		contract := &stubContract{result: `{"Records":[],"FetchedRecordsCount":0,"Bookmark":""}`}
+		contracts[setup.MSPID] = contract
+		setup.Contract = contract
+		return &setup, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request := func(token string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/doctors/doctor1/prescriptions", nil)
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		server.ServeHTTP(recorder, r)
+		return recorder
+	}
+
+	if response := request("pharmacist-token"); response.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", response.Code, response.Body)
+	}
+	if contracts["Org2MSP"].name == "" || contracts["Org1MSP"].name != "" {
+		t.Errorf("pharmacist request was not served by the Org2 identity")
+	}
+
+	for _, token := range []string{"", "wrong-token"} {
+		response := request(token)
+		if response.Code != http.StatusUnauthorized || response.Header().Get("WWW-Authenticate") == "" {
+			t.Errorf("token %q: expected 401 with a challenge, got %d", token, response.Code)
+		}
+	}
+
+	_, err = NewMultiOrgServer(config, func(setup OrgSetup) (*OrgSetup, error) {
+		return nil, errors.New("no such file")
+	})
+	if err == nil || !strings.Contains(err.Error(), "identity doctor1 of Org1") {
+		t.Errorf("expected the failing identity to be named, got %v", err)
+	}
+}
+
+func TestNewServerWithoutTokenServesSingleIdentity(t *testing.T) {
+	config, err := LoadServerConfig("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	contract := &stubContract{result: `{"Records":[],"FetchedRecordsCount":0,"Bookmark":""}`}
+	handler, err := NewServer(config, func(setup OrgSetup) (*OrgSetup, error) {
+		setup.Contract = contract
+		return &setup, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/doctors/doctor1/prescriptions", nil))
+	if recorder.Code != http.StatusOK || contract.name == "" {
+		t.Errorf("expected the request to be served without a token, got %d", recorder.Code)
+	}
+}
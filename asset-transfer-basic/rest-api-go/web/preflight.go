@@ -0,0 +1,192 @@
+package web
+
+import (
+	"crypto"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// metadataFunction is provided by every contract API chaincode, so evaluating it checks the
+// identity against the channel without depending on the chaincode's own functions.
+const metadataFunction = "org.hyperledger.fabric:GetMetadata"
+
+// CheckResult is the outcome of one preflight check of an identity. Err is nil if the check
+// passed, and Skipped is set if a check it depends on did not pass.
+type CheckResult struct {
+	Identity string
+	Check    string
+	Detail   string
+	Skipped  bool
+	Err      error
+}
+
+// PreflightReport lists the preflight check results of every configured identity.
+type PreflightReport struct {
+	Results []CheckResult
+}
+
+// Failed reports whether any check failed or was skipped.
+func (report *PreflightReport) Failed() bool {
+	for _, result := range report.Results {
+		if result.Err != nil || result.Skipped {
+			return true
+		}
+	}
+	return false
+}
+
+// Print writes the report to w, one line per check.
+func (report *PreflightReport) Print(w io.Writer) {
+	identity := ""
+	for _, result := range report.Results {
+		if result.Identity != identity {
+			identity = result.Identity
+			fmt.Fprintf(w, "%s\n", identity)
+		}
+		status, detail := "ok", result.Detail
+		switch {
+		case result.Err != nil:
+			status, detail = "FAIL", result.Err.Error()
+		case result.Skipped:
+			status = "skip"
+		}
+		fmt.Fprintf(w, "  %-4s  %-12s %s\n", status, result.Check, detail)
+	}
+	if report.Failed() {
+		fmt.Fprintln(w, "Preflight check failed")
+	} else {
+		fmt.Fprintln(w, "Preflight check passed")
+	}
+}
+
+// Preflight checks that every configured identity can connect: its certificate and private
+// key are readable and belong together, the org's TLS CA certificate is readable and the
+// peer endpoint completes a TLS handshake with it, and the Gateway, connected with
+// initialize, accepts the identity as a member of its MSP.
+func Preflight(config *ServerConfig, initialize func(OrgSetup) (*OrgSetup, error)) *PreflightReport {
+	report := &PreflightReport{}
+	for i, setup := range config.OrgSetups() {
+		name := fmt.Sprintf("%s (%s)", config.Identities[i].Name, setup.MSPID)
+		report.Results = append(report.Results, checkSetup(name, setup, initialize)...)
+	}
+	return report
+}
+
+func checkSetup(name string, setup OrgSetup, initialize func(OrgSetup) (*OrgSetup, error)) []CheckResult {
+	var results []CheckResult
+	passed := map[string]bool{}
+	check := func(check string, run func() (string, error), prerequisites ...string) {
+		result := CheckResult{Identity: name, Check: check}
+		for _, prerequisite := range prerequisites {
+			if !passed[prerequisite] {
+				result.Skipped = true
+				result.Detail = fmt.Sprintf("requires the %s check to pass", prerequisite)
+			}
+		}
+		if !result.Skipped {
+			result.Detail, result.Err = run()
+			passed[check] = result.Err == nil
+		}
+		results = append(results, result)
+	}
+
+	var certificate *x509.Certificate
+	check("certificate", func() (string, error) {
+		var err error
+		if certificate, err = loadCertificate(setup.CertPath); err != nil {
+			return "", err
+		}
+		now := time.Now()
+		if now.After(certificate.NotAfter) {
+			return "", fmt.Errorf("certificate %s expired at %s", setup.CertPath, certificate.NotAfter.Format(time.RFC3339))
+		}
+		if now.Before(certificate.NotBefore) {
+			return "", fmt.Errorf("certificate %s is not valid until %s", setup.CertPath, certificate.NotBefore.Format(time.RFC3339))
+		}
+		return fmt.Sprintf("%s, expires %s", certificate.Subject, certificate.NotAfter.Format(time.RFC3339)), nil
+	})
+	check("private key", func() (string, error) {
+		privateKey, err := loadPrivateKey(setup.KeyPath)
+		if err != nil {
+			return "", err
+		}
+		if !keyMatchesCertificate(privateKey, certificate) {
+			return "", fmt.Errorf("the private key in %s does not belong to certificate %s", setup.KeyPath, setup.CertPath)
+		}
+		return "matches the certificate", nil
+	}, "certificate")
+	var tlsCA *x509.Certificate
+	check("TLS CA", func() (string, error) {
+		var err error
+		if tlsCA, err = setup.tlsCertificate(); err != nil {
+			return "", err
+		}
+		if !tlsCA.IsCA {
+			return "", fmt.Errorf("TLS CA certificate %s is not a CA certificate", tlsCA.Subject)
+		}
+		return tlsCA.Subject.String(), nil
+	})
+	check("endpoint", func() (string, error) {
+		return dialPeer(setup, tlsCA)
+	}, "TLS CA")
+	check("MSP ID", func() (string, error) {
+		connected, err := initialize(setup)
+		if err != nil {
+			return "", err
+		}
+		if _, err := connected.contract().Evaluate(metadataFunction); err != nil {
+			return "", fmt.Errorf("the Gateway rejected a query as %s: %w", setup.MSPID, err)
+		}
+		return fmt.Sprintf("the Gateway accepted the identity as %s", setup.MSPID), nil
+	}, "private key", "endpoint")
+	return results
+}
+
+// keyMatchesCertificate reports whether the private key's public key is the certificate's.
+func keyMatchesCertificate(privateKey crypto.PrivateKey, certificate *x509.Certificate) bool {
+	signer, ok := privateKey.(crypto.Signer)
+	if !ok {
+		return false
+	}
+	publicKey, ok := signer.Public().(interface{ Equal(crypto.PublicKey) bool })
+	return ok && publicKey.Equal(certificate.PublicKey)
+}
+
+// dialPeer completes a TLS handshake with the peer, verifying its certificate against the TLS
+// CA for the GatewayPeer server name.
+func dialPeer(setup OrgSetup, tlsCA *x509.Certificate) (string, error) {
+	address := endpointAddress(setup.PeerEndpoint)
+	certPool := x509.NewCertPool()
+	certPool.AddCert(tlsCA)
+	dialer := &net.Dialer{Timeout: time.Duration(setup.Timeouts.withDefaults().Evaluate)}
+	connection, err := tls.DialWithDialer(dialer, "tcp", address, &tls.Config{RootCAs: certPool, ServerName: setup.GatewayPeer})
+	if err != nil {
+		var verifyErr *tls.CertificateVerificationError
+		if errors.As(err, &verifyErr) {
+			return "", fmt.Errorf("peer %s presented a certificate the TLS CA does not verify for %s: %w", address, setup.GatewayPeer, err)
+		}
+		return "", fmt.Errorf("peer %s is unreachable: %w", address, err)
+	}
+	defer connection.Close()
+	return fmt.Sprintf("TLS handshake with %s as %s", address, setup.GatewayPeer), nil
+}
+
+// endpointAddress returns the host and port of a gRPC target such as dns:///localhost:7051.
+func endpointAddress(endpoint string) string {
+	if _, target, ok := strings.Cut(endpoint, "://"); ok {
+		if _, address, ok := strings.Cut(target, "/"); ok {
+			return address
+		}
+		return target
+	}
+	if scheme, address, ok := strings.Cut(endpoint, ":"); ok && (scheme == "dns" || scheme == "passthrough") {
+		return address
+	}
+	return endpoint
+}
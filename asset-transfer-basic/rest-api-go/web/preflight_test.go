@@ -0,0 +1,170 @@
+package web
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeEnrollment writes a self-signed certificate and its private key in the layout of an
+// enrolled user's MSP directory, and returns the certificate path and keystore directory.
+func writeEnrollment(t *testing.T) (string, string) {
+	t.Helper()
+	dir := t.TempDir()
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "doctor1"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	certificate, err := x509.CreateCertificate(rand.Reader, template, template, &privateKey.PublicKey, privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certPath := writeFile(t, dir, "cert.pem", string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certificate})))
+	keyPath := filepath.Join(dir, "keystore")
+	if err := os.Mkdir(keyPath, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, keyPath, "priv_sk", string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})))
+	return certPath, keyPath
+}
+
+func TestPreflight(t *testing.T) {
+	peer := httptest.NewTLSServer(http.NotFoundHandler())
+	defer peer.Close()
+	tlsCA := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: peer.Certificate().Raw}))
+	certPath, keyPath := writeEnrollment(t)
+	otherCertPath, _ := writeEnrollment(t)
+
+	newConfig := func() *ServerConfig {
+		config := &ServerConfig{
+			Orgs: []OrgConfig{{
+				Name:         "Org1",
+				MSPID:        "Org1MSP",
+				PeerEndpoint: "dns:///" + peer.Listener.Addr().String(),
+				GatewayPeer:  "example.com",
+				tlsCACert:    []byte(tlsCA),
+			}},
+			Identities: []IdentityConfig{{Name: "doctor1", Org: "Org1", CertPath: certPath, KeyPath: keyPath}},
+		}
+		config.applyDefaults()
+		return config
+	}
+	connect := func(err error) func(OrgSetup) (*OrgSetup, error) {
+		return func(setup OrgSetup) (*OrgSetup, error) {
+			setup.Contract = &stubContract{result: "{}", err: err}
+			return &setup, nil
+		}
+	}
+	outcome := func(report *PreflightReport) string {
+		var outcomes []string
+		for _, result := range report.Results {
+			switch {
+			case result.Err != nil:
+				outcomes = append(outcomes, result.Check+"=FAIL")
+			case result.Skipped:
+				outcomes = append(outcomes, result.Check+"=skip")
+			default:
+				outcomes = append(outcomes, result.Check+"=ok")
+			}
+		}
+		return strings.Join(outcomes, " ")
+	}
+
+	report := Preflight(newConfig(), connect(nil))
+	if report.Failed() || outcome(report) != "certificate=ok private key=ok TLS CA=ok endpoint=ok MSP ID=ok" {
+		t.Fatalf("expected every check to pass, got %s", outcome(report))
+	}
+
+	tests := []struct {
+		name     string
+		modify   func(config *ServerConfig)
+		rejectAs error
+		expected string
+	}{
+		{
+			name:     "key of another certificate",
+			modify:   func(config *ServerConfig) { config.Identities[0].CertPath = otherCertPath },
+			expected: "certificate=ok private key=FAIL TLS CA=ok endpoint=ok MSP ID=skip",
+		},
+		{
+			name:     "missing certificate",
+			modify:   func(config *ServerConfig) { config.Identities[0].CertPath = filepath.Join(t.TempDir(), "cert.pem") },
+			expected: "certificate=FAIL private key=skip TLS CA=ok endpoint=ok MSP ID=skip",
+		},
+		{
+			name:     "wrong TLS CA",
+			modify:   func(config *ServerConfig) { config.Orgs[0].tlsCACert = nil; config.Orgs[0].TLSCertPath = otherCertPath },
+			expected: "certificate=ok private key=ok TLS CA=FAIL endpoint=skip MSP ID=skip",
+		},
+		{
+			name:     "wrong server name",
+			modify:   func(config *ServerConfig) { config.Orgs[0].GatewayPeer = "peer0.org1.example.com" },
+			expected: "certificate=ok private key=ok TLS CA=ok endpoint=FAIL MSP ID=skip",
+		},
+		{
+			name:     "unknown MSP ID",
+			rejectAs: errors.New("access denied: creator org unknown"),
+			expected: "certificate=ok private key=ok TLS CA=ok endpoint=ok MSP ID=FAIL",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := newConfig()
+			if tt.modify != nil {
+				tt.modify(config)
+			}
+			report := Preflight(config, connect(tt.rejectAs))
+			if !report.Failed() || outcome(report) != tt.expected {
+				t.Errorf("got %s, expected %s", outcome(report), tt.expected)
+			}
+		})
+	}
+
+	address := peer.Listener.Addr().String()
+	peer.Close()
+	report = Preflight(newConfig(), connect(nil))
+	var printed strings.Builder
+	report.Print(&printed)
+	if !strings.Contains(printed.String(), "FAIL  endpoint     peer "+address+" is unreachable") || !strings.HasSuffix(printed.String(), "Preflight check failed\n") {
+		t.Errorf("unexpected report\n%s", printed.String())
+	}
+}
+
+func TestInitializeReturnsSetupErrors(t *testing.T) {
+	certPath, keyPath := writeEnrollment(t)
+	tests := map[string]OrgSetup{
+		"missing certificate": {MSPID: "Org1MSP", CertPath: filepath.Join(t.TempDir(), "cert.pem"), KeyPath: keyPath},
+		"empty keystore":      {MSPID: "Org1MSP", CertPath: certPath, KeyPath: t.TempDir()},
+		"missing TLS CA":      {MSPID: "Org1MSP", CertPath: certPath, KeyPath: keyPath, TLSCertPath: filepath.Join(t.TempDir(), "ca.crt")},
+	}
+	for name, setup := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := Initialize(setup); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,243 @@
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+)
+
+const (
+	// defaultChannelID and defaultChaincodeID are used by the resource endpoints when
+	// OrgSetup does not name a channel or chaincode.
+	defaultChannelID   = "mychannel"
+	defaultChaincodeID = "basic"
+
+	// defaultPageSize is the page size of list endpoints without a pageSize parameter.
+	defaultPageSize = 20
+)
+
+// DomainContract evaluates and submits the chaincode transactions behind the resource
+// endpoints. The Gateway is used unless OrgSetup.Contract is set, e.g. to a stub in tests.
+type DomainContract interface {
+	// Evaluate runs a query and returns its result.
+	Evaluate(name string, args ...string) ([]byte, error)
+	// Submit runs a transaction with the given transient data and returns it once it has
+	// committed.
+	Submit(name string, args []string, transient map[string][]byte) (*CommittedTransaction, error)
+}
+
+// CommittedTransaction is a transaction that has committed, with its result.
+type CommittedTransaction struct {
+	Result        []byte
+	TransactionId string
+	BlockNumber   uint64
+}
+
+type gatewayContract struct {
+	contract *client.Contract
+}
+
+func (gateway gatewayContract) Evaluate(name string, args ...string) ([]byte, error) {
+	return gateway.contract.EvaluateTransaction(name, args...)
+}
+
+func (gateway gatewayContract) Submit(name string, args []string, transient map[string][]byte) (*CommittedTransaction, error) {
+	return submitTransaction(gateway.contract, name, args, transient)
+}
+
+// contract returns the chaincode the resource endpoints call.
+func (setup *OrgSetup) contract() DomainContract {
+	if setup.Contract != nil {
+		return setup.Contract
+	}
+	channelID := setup.ChannelID
+	if channelID == "" {
+		channelID = defaultChannelID
+	}
+	chaincodeID := setup.ChaincodeID
+	if chaincodeID == "" {
+		chaincodeID = defaultChaincodeID
+	}
+	return gatewayContract{contract: setup.Gateway.GetNetwork(channelID).GetContract(chaincodeID)}
+}
+
+// decodeRequest decodes a JSON request body, rejecting unknown fields and trailing data.
+func decodeRequest(r *http.Request, request interface{ validate() error }) error {
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(request); err != nil {
+		return fmt.Errorf("invalid request body: %w", err)
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return fmt.Errorf("invalid request body: unexpected data after the JSON object")
+	}
+	return request.validate()
+}
+
+// writeChaincodeResult decodes a chaincode result into value and writes it, so that only
+// results of the expected shape reach the client.
+func writeChaincodeResult(w http.ResponseWriter, status int, result []byte, value interface{}) {
+	if err := json.Unmarshal(result, value); err != nil {
+		writeErrorDetail(w, http.StatusBadGateway, &ErrorDetail{Code: ErrorUnexpectedResponse, Message: fmt.Sprintf("Unexpected chaincode response: %s", err)})
+		return
+	}
+	writeJSON(w, status, value)
+}
+
+// ReadPatient handles GET /patients/{id} and returns the patient's Asset.
+func (setup *OrgSetup) ReadPatient(w http.ResponseWriter, r *http.Request) {
+	patientID := r.PathValue("id")
+	slog.Debug("ReadPatient", "patient", patientID)
+	result, err := setup.contract().Evaluate("ReadAsset", patientID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeChaincodeResult(w, http.StatusOK, result, &Asset{})
+}
+
+// CreatePrescriptions handles POST /patients/{id}/prescriptions with a
+// CreatePrescriptionsRequest, and returns the new prescription IDs.
+func (setup *OrgSetup) CreatePrescriptions(w http.ResponseWriter, r *http.Request) {
+	patientID := r.PathValue("id")
+	slog.Debug("CreatePrescriptions", "patient", patientID)
+	var request CreatePrescriptionsRequest
+	if err := decodeRequest(r, &request); err != nil {
+		writeBadRequest(w, err.Error())
+		return
+	}
+
+	assetJSON, err := json.Marshal(struct {
+		PatientId     string            `json:"PatientId"`
+		Prescriptions []NewPrescription `json:"Prescriptions"`
+	}{patientID, request.Prescriptions})
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	phiJSON, err := json.Marshal(struct {
+		PatientName      string            `json:"PatientName,omitempty"`
+		DateOfBirth      string            `json:"DateOfBirth,omitempty"`
+		Salt             string            `json:"Salt"`
+		Diagnoses        []string          `json:"Diagnoses"`
+		AllergyOverrides []AllergyOverride `json:"AllergyOverrides,omitempty"`
+	}{request.PatientName, request.DateOfBirth, request.Salt, request.Diagnoses, request.AllergyOverrides})
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	committed, err := setup.contract().Submit("CreateAsset", []string{string(assetJSON)}, map[string][]byte{"phi": phiJSON})
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	var created struct {
+		TransactionResult
+		CreateAssetResult
+	}
+	if err := json.Unmarshal(committed.Result, &created.CreateAssetResult); err != nil {
+		writeErrorDetail(w, http.StatusBadGateway, &ErrorDetail{Code: ErrorUnexpectedResponse, Message: fmt.Sprintf("Unexpected chaincode response: %s", err)})
+		return
+	}
+	created.TransactionResult = TransactionResult{TransactionId: committed.TransactionId, BlockNumber: committed.BlockNumber}
+	w.Header().Set("Location", "/patients/"+patientID)
+	writeJSON(w, http.StatusCreated, created)
+}
+
+// DispensePrescription handles POST /prescriptions/{id}/dispense with a DispenseRequest.
+func (setup *OrgSetup) DispensePrescription(w http.ResponseWriter, r *http.Request) {
+	prescriptionID := r.PathValue("id")
+	slog.Debug("DispensePrescription", "prescription", prescriptionID)
+	var request DispenseRequest
+	if err := decodeRequest(r, &request); err != nil {
+		writeBadRequest(w, err.Error())
+		return
+	}
+
+	dispensationJSON, err := json.Marshal(struct {
+		PatientId      string `json:"patientId"`
+		PrescriptionId string `json:"prescriptionId"`
+		PharmacyId     string `json:"pharmacyId,omitempty"`
+		Quantity       int    `json:"quantity,omitempty"`
+		Note           string `json:"note,omitempty"`
+	}{request.PatientId, prescriptionID, request.PharmacyId, request.Quantity, request.Note})
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	setup.submitTransition(w, "DispensePrescription", string(dispensationJSON))
+}
+
+// RevokePrescription handles POST /prescriptions/{id}/revoke with a RevokeRequest.
+func (setup *OrgSetup) RevokePrescription(w http.ResponseWriter, r *http.Request) {
+	prescriptionID := r.PathValue("id")
+	slog.Debug("RevokePrescription", "prescription", prescriptionID)
+	var request RevokeRequest
+	if err := decodeRequest(r, &request); err != nil {
+		writeBadRequest(w, err.Error())
+		return
+	}
+
+	revocationJSON, err := json.Marshal(struct {
+		PatientId      string `json:"patientId"`
+		PrescriptionId string `json:"prescriptionId"`
+	}{request.PatientId, prescriptionID})
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	setup.submitTransition(w, "RevokePrescriptionJSON", string(revocationJSON))
+}
+
+// submitTransition submits a transaction that returns no result and responds with its ID and
+// block number.
+func (setup *OrgSetup) submitTransition(w http.ResponseWriter, function string, argument string) {
+	committed, err := setup.contract().Submit(function, []string{argument}, nil)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, TransactionResult{TransactionId: committed.TransactionId, BlockNumber: committed.BlockNumber})
+}
+
+// DoctorPrescriptions handles GET /doctors/{id}/prescriptions and returns a PrescriptionPage
+// of the prescriptions the doctor created. The pageSize and bookmark query parameters select
+// the page, and the next page's bookmark is also returned in the X-Next-Bookmark header.
+func (setup *OrgSetup) DoctorPrescriptions(w http.ResponseWriter, r *http.Request) {
+	doctorID := r.PathValue("id")
+	slog.Debug("DoctorPrescriptions", "doctor", doctorID)
+	queryParams := r.URL.Query()
+	pageSize := defaultPageSize
+	if queryParams.Has("pageSize") {
+		parsed, err := strconv.Atoi(queryParams.Get("pageSize"))
+		if err != nil || parsed < 1 {
+			writeBadRequest(w, "pageSize must be a positive integer")
+			return
+		}
+		pageSize = parsed
+	}
+
+	result, err := setup.contract().Evaluate("GetPrescriptionsByDoctorWithPagination", doctorID, strconv.Itoa(pageSize), queryParams.Get("bookmark"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	var page PrescriptionPage
+	if err := json.Unmarshal(result, &page); err != nil {
+		writeErrorDetail(w, http.StatusBadGateway, &ErrorDetail{Code: ErrorUnexpectedResponse, Message: fmt.Sprintf("Unexpected chaincode response: %s", err)})
+		return
+	}
+	if page.Records == nil {
+		page.Records = []Prescription{}
+	}
+	if page.Bookmark != "" {
+		w.Header().Set(nextBookmarkHeader, page.Bookmark)
+	}
+	writeJSON(w, http.StatusOK, page)
+}
@@ -0,0 +1,156 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// stubContract records the transactions it is asked to run and returns a fixed result.
+type stubContract struct {
+	result    string
+	err       error
+	name      string
+	args      []string
+	transient map[string][]byte
+}
+
+func (contract *stubContract) Evaluate(name string, args ...string) ([]byte, error) {
+	contract.name = name
+	contract.args = args
+	return []byte(contract.result), contract.err
+}
+
+func (contract *stubContract) Submit(name string, args []string, transient map[string][]byte) (*CommittedTransaction, error) {
+	contract.name = name
+	contract.args = args
+	contract.transient = transient
+	if contract.err != nil {
+		return nil, contract.err
+	}
+	return &CommittedTransaction{Result: []byte(contract.result), TransactionId: "tx1", BlockNumber: 7}, nil
+}
+
+func serve(setup *OrgSetup, method string, target string, body string) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	setup.Handler().ServeHTTP(recorder, httptest.NewRequest(method, target, strings.NewReader(body)))
+	return recorder
+}
+
+func TestCreatePrescriptions(t *testing.T) {
+	contract := &stubContract{result: `{"PatientId":"patient1","PrescriptionIds":["RX-1-0"]}`}
+	setup := &OrgSetup{Contract: contract}
+
+	response := serve(setup, http.MethodPost, "/patients/patient1/prescriptions", `{
+		"Prescriptions":[{"MedicationName":"Amoxicillin","Dose":{"Amount":500,"Unit":"mg"}}],
+		"PatientName":"Jane Banda","Salt":"0123456789abcdef","Diagnoses":["Otitis media"]}`)
+	if response.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", response.Code, response.Body)
+	}
+	if contract.name != "CreateAsset" {
+		t.Fatalf("expected CreateAsset, got %s", contract.name)
+	}
+	if contract.args[0] != `{"PatientId":"patient1","Prescriptions":[{"MedicationName":"Amoxicillin","Dose":{"Amount":500,"Unit":"mg"}}]}` {
+		t.Errorf("unexpected asset argument %s", contract.args[0])
+	}
+	if strings.Contains(contract.args[0], "Jane Banda") || !strings.Contains(string(contract.transient["phi"]), "Jane Banda") {
+		t.Errorf("patient details must be sent only as transient data")
+	}
+
+	var created struct {
+		TransactionId   string
+		PrescriptionIds []string
+	}
+	if err := json.Unmarshal(response.Body.Bytes(), &created); err != nil {
+		t.Fatal(err)
+	}
+	if created.TransactionId != "tx1" || len(created.PrescriptionIds) != 1 {
+		t.Errorf("unexpected response %s", response.Body)
+	}
+}
+
+func TestCreatePrescriptionsValidatesBody(t *testing.T) {
+	tests := map[string]string{
+		"unknown field":     `{"Prescriptions":[{"MedicationName":"Amoxicillin","Status":"Dispensed"}],"Salt":"0123456789abcdef","Diagnoses":["Otitis media"]}`,
+		"no medication":     `{"Prescriptions":[{"Dosage":"500mg"}],"Salt":"0123456789abcdef","Diagnoses":["Otitis media"]}`,
+		"diagnosis count":   `{"Prescriptions":[{"MedicationName":"Amoxicillin"}],"Salt":"0123456789abcdef","Diagnoses":[]}`,
+		"short salt":        `{"Prescriptions":[{"MedicationName":"Amoxicillin"}],"Salt":"abc","Diagnoses":["Otitis media"]}`,
+		"override index":    `{"Prescriptions":[{"MedicationName":"Amoxicillin"}],"Salt":"0123456789abcdef","Diagnoses":["Otitis media"],"AllergyOverrides":[{"Prescription":1,"AllergyId":"ALG-1","Justification":"x"}]}`,
+		"trailing data":     `{"Prescriptions":[{"MedicationName":"Amoxicillin"}],"Salt":"0123456789abcdef","Diagnoses":["Otitis media"]} {}`,
+		"wrong field types": `{"Prescriptions":[{"MedicationName":"Amoxicillin","Quantity":"ten"}],"Salt":"0123456789abcdef","Diagnoses":["Otitis media"]}`,
+	}
+	for name, body := range tests {
+		t.Run(name, func(t *testing.T) {
+			contract := &stubContract{}
+			response := serve(&OrgSetup{Contract: contract}, http.MethodPost, "/patients/patient1/prescriptions", body)
+			if response.Code != http.StatusBadRequest {
+				t.Fatalf("expected 400, got %d: %s", response.Code, response.Body)
+			}
+			if contract.name != "" {
+				t.Fatalf("invalid request reached the chaincode")
+			}
+		})
+	}
+}
+
+func TestDispenseAndRevokePrescription(t *testing.T) {
+	contract := &stubContract{}
+	setup := &OrgSetup{Contract: contract}
+
+	response := serve(setup, http.MethodPost, "/prescriptions/rx1/dispense", `{"PatientId":"patient1","Quantity":10}`)
+	if response.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", response.Code, response.Body)
+	}
+	if contract.name != "DispensePrescription" || contract.args[0] != `{"patientId":"patient1","prescriptionId":"rx1","quantity":10}` {
+		t.Errorf("unexpected transaction %s %v", contract.name, contract.args)
+	}
+	if strings.TrimSpace(response.Body.String()) != `{"TransactionId":"tx1","BlockNumber":7}` {
+		t.Errorf("unexpected response %s", response.Body)
+	}
+
+	response = serve(setup, http.MethodPost, "/prescriptions/rx1/revoke", `{"PatientId":"patient1"}`)
+	if response.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", response.Code, response.Body)
+	}
+	if contract.name != "RevokePrescriptionJSON" || contract.args[0] != `{"patientId":"patient1","prescriptionId":"rx1"}` {
+		t.Errorf("unexpected transaction %s %v", contract.name, contract.args)
+	}
+
+	if response := serve(setup, http.MethodPost, "/prescriptions/rx1/revoke", `{}`); response.Code != http.StatusBadRequest {
+		t.Errorf("revoke without a patient: expected 400, got %d", response.Code)
+	}
+	if response := serve(setup, http.MethodGet, "/prescriptions/rx1/dispense", ""); response.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET dispense: expected 405, got %d", response.Code)
+	}
+}
+
+func TestDoctorPrescriptions(t *testing.T) {
+	contract := &stubContract{result: `{"Records":[{"PrescriptionId":"rx1","MedicationName":"Amoxicillin","Status":"Active"}],"FetchedRecordsCount":1,"Bookmark":"g1AAAA"}`}
+	setup := &OrgSetup{Contract: contract}
+
+	response := serve(setup, http.MethodGet, "/doctors/doctor1/prescriptions", "")
+	if response.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", response.Code, response.Body)
+	}
+	if contract.name != "GetPrescriptionsByDoctorWithPagination" || strings.Join(contract.args, ",") != "doctor1,20," {
+		t.Errorf("unexpected query %s %v", contract.name, contract.args)
+	}
+	if response.Header().Get(nextBookmarkHeader) != "g1AAAA" {
+		t.Errorf("missing next bookmark header")
+	}
+
+	serve(setup, http.MethodGet, "/doctors/doctor1/prescriptions?pageSize=5&bookmark=g1AAAA", "")
+	if strings.Join(contract.args, ",") != "doctor1,5,g1AAAA" {
+		t.Errorf("unexpected query args %v", contract.args)
+	}
+	if response := serve(setup, http.MethodGet, "/doctors/doctor1/prescriptions?pageSize=0", ""); response.Code != http.StatusBadRequest {
+		t.Errorf("pageSize=0: expected 400, got %d", response.Code)
+	}
+
+	contract.result = `[{"PrescriptionId":"rx1"}]`
+	if response := serve(setup, http.MethodGet, "/doctors/doctor1/prescriptions", ""); response.Code != http.StatusBadGateway {
+		t.Errorf("malformed chaincode response: expected 502, got %d", response.Code)
+	}
+}
@@ -1,25 +1,54 @@
 package web
 
 import (
-	"fmt"
+	"encoding/json"
+	"log/slog"
 	"net/http"
+	"net/url"
 )
 
-// Query handles chaincode query requests.
+// nextBookmarkHeader carries the bookmark of the next page of a paginated query.
+const nextBookmarkHeader = "X-Next-Bookmark"
+
+// Query handles chaincode query requests. It responds with a Response holding the result.
 func (setup OrgSetup) Query(w http.ResponseWriter, r *http.Request) {
-	fmt.Println("Received Query request")
 	queryParams := r.URL.Query()
 	chainCodeName := queryParams.Get("chaincodeid")
 	channelID := queryParams.Get("channelid")
 	function := queryParams.Get("function")
-	args := r.URL.Query()["args"]
-	fmt.Printf("channel: %s, chaincode: %s, function: %s, args: %s\n", channelID, chainCodeName, function, args)
+	args := paginationArgs(r.URL.Query()["args"], queryParams)
+	slog.Debug("Query", "channel", channelID, "chaincode", chainCodeName, "function", function, "args", args)
 	network := setup.Gateway.GetNetwork(channelID)
 	contract := network.GetContract(chainCodeName)
 	evaluateResponse, err := contract.EvaluateTransaction(function, args...)
 	if err != nil {
-		fmt.Fprintf(w, "Error: %s", err)
+		writeError(w, err)
 		return
 	}
-	fmt.Fprintf(w, "Response: %s", evaluateResponse)
+	if bookmark := nextBookmark(evaluateResponse); bookmark != "" {
+		w.Header().Set(nextBookmarkHeader, bookmark)
+	}
+	writeResult(w, http.StatusOK, evaluateResponse, "", 0)
+}
+
+// paginationArgs appends the pageSize and bookmark query parameters to the arguments of a
+// paginated chaincode query, which take them last. Without a pageSize the arguments are
+// returned unchanged; the bookmark is empty for the first page.
+func paginationArgs(args []string, queryParams url.Values) []string {
+	if !queryParams.Has("pageSize") {
+		return args
+	}
+	return append(args, queryParams.Get("pageSize"), queryParams.Get("bookmark"))
+}
+
+// nextBookmark returns the bookmark of a paginated chaincode response, or an empty string
+// for other responses and for the last page.
+func nextBookmark(response []byte) string {
+	var page struct {
+		Bookmark string `json:"Bookmark"`
+	}
+	if err := json.Unmarshal(response, &page); err != nil {
+		return ""
+	}
+	return page.Bookmark
 }
@@ -0,0 +1,41 @@
+package web
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestPaginationArgs(t *testing.T) {
+	query, _ := url.ParseQuery("args=doctor1&pageSize=20&bookmark=g1AAAA")
+	args := paginationArgs(query["args"], query)
+	if strings.Join(args, ",") != "doctor1,20,g1AAAA" {
+		t.Fatalf("unexpected args %v", args)
+	}
+
+	query, _ = url.ParseQuery("args=doctor1&pageSize=20")
+	args = paginationArgs(query["args"], query)
+	if len(args) != 3 || args[2] != "" {
+		t.Fatalf("first page should pass an empty bookmark, got %q", args)
+	}
+
+	query, _ = url.ParseQuery("args=patient1")
+	args = paginationArgs(query["args"], query)
+	if strings.Join(args, ",") != "patient1" {
+		t.Fatalf("unpaginated query args changed: %v", args)
+	}
+}
+
+func TestNextBookmark(t *testing.T) {
+	tests := map[string]string{
+		`{"Records":[],"FetchedRecordsCount":0,"Bookmark":"g1AAAA"}`: "g1AAAA",
+		`{"Records":[],"FetchedRecordsCount":0,"Bookmark":""}`:       "",
+		`[{"PrescriptionId":"rx1"}]`:                                 "",
+		`not json`:                                                   "",
+	}
+	for response, expected := range tests {
+		if bookmark := nextBookmark([]byte(response)); bookmark != expected {
+			t.Fatalf("nextBookmark(%s) = %q, expected %q", response, bookmark, expected)
+		}
+	}
+}
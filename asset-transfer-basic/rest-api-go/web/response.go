@@ -0,0 +1,256 @@
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+	"github.com/hyperledger/fabric-protos-go-apiv2/gateway"
+	"github.com/hyperledger/fabric-protos-go-apiv2/peer"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Machine-readable error codes. Chaincode errors whose message is a JSON object with a Code,
+// such as the chaincode's TransitionError, are reported under that code instead.
+const (
+	ErrorInvalidRequest          = "InvalidRequest"
+	ErrorForbidden               = "Forbidden"
+	ErrorNotFound                = "NotFound"
+	ErrorChaincode               = "ChaincodeError"
+	ErrorEndorsementFailed       = "EndorsementFailed"
+	ErrorSubmitFailed            = "SubmitFailed"
+	ErrorCommitStatusUnavailable = "CommitStatusUnavailable"
+	ErrorCommitConflict          = "CommitConflict"
+	ErrorCommitFailed            = "CommitFailed"
+	ErrorUnavailable             = "Unavailable"
+	ErrorTimeout                 = "Timeout"
+	ErrorUnexpectedResponse      = "UnexpectedResponse"
+	ErrorInternal                = "InternalError"
+)
+
+// chaincodeStatusCodes maps the codes of structured chaincode errors to HTTP statuses.
+var chaincodeStatusCodes = map[string]int{
+	"IllegalStatusTransition": http.StatusConflict,
+	"BatchRejected":           http.StatusUnprocessableEntity,
+}
+
+// chaincodeResponsePattern finds the chaincode's own message in a peer's error message.
+var chaincodeResponsePattern = regexp.MustCompile(`(?s)chaincode response \d+, (.*)$`)
+
+// Response is the JSON envelope of the /query and /invoke endpoints, and the body of every
+// error response. Result holds the chaincode's result as JSON, or as a JSON string when the
+// chaincode did not return JSON.
+type Response struct {
+	Result        json.RawMessage `json:"Result,omitempty"`
+	TransactionId string          `json:"TransactionId,omitempty"`
+	BlockNumber   uint64          `json:"BlockNumber,omitempty"`
+	Error         *ErrorDetail    `json:"Error,omitempty"`
+}
+
+// ErrorDetail describes a failed request. GrpcCode is set for errors returned by the Gateway,
+// ValidationCode for transactions that failed to commit, and Endorsements lists the errors
+// returned by each endorsing peer or orderer. Chaincode holds the chaincode's error when it
+// is a JSON object.
+type ErrorDetail struct {
+	Code           string              `json:"Code"`
+	Message        string              `json:"Message"`
+	TransactionId  string              `json:"TransactionId,omitempty"`
+	GrpcCode       string              `json:"GrpcCode,omitempty"`
+	ValidationCode string              `json:"ValidationCode,omitempty"`
+	Endorsements   []EndorsementDetail `json:"Endorsements,omitempty"`
+	Chaincode      json.RawMessage     `json:"Chaincode,omitempty"`
+}
+
+// EndorsementDetail is the error returned by one peer or orderer.
+type EndorsementDetail struct {
+	Address string `json:"Address"`
+	MspId   string `json:"MspId"`
+	Message string `json:"Message"`
+}
+
+// commitFailure reports a transaction that was ordered but failed validation. It carries the
+// same fields as client.CommitError, which cannot be constructed outside the client package.
+type commitFailure struct {
+	TransactionID string
+	Code          peer.TxValidationCode
+}
+
+func (e *commitFailure) Error() string {
+	return fmt.Sprintf("transaction %s failed to commit with status code %d (%s)", e.TransactionID, int32(e.Code), e.Code)
+}
+
+// writeJSON writes value as the JSON response body.
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(value); err != nil {
+		slog.Error("Error writing response", "error", err)
+	}
+}
+
+// writeResult writes a successful Response.
+func writeResult(w http.ResponseWriter, status int, result []byte, transactionID string, blockNumber uint64) {
+	writeJSON(w, status, Response{Result: resultJSON(result), TransactionId: transactionID, BlockNumber: blockNumber})
+}
+
+// resultJSON returns a chaincode result as JSON: unchanged if it is JSON, and as a JSON string
+// otherwise. An empty result is omitted.
+func resultJSON(result []byte) json.RawMessage {
+	if len(result) == 0 {
+		return nil
+	}
+	if json.Valid(result) {
+		return result
+	}
+	quoted, _ := json.Marshal(string(result))
+	return quoted
+}
+
+// writeErrorDetail writes an error Response.
+func writeErrorDetail(w http.ResponseWriter, status int, detail *ErrorDetail) {
+	writeJSON(w, status, Response{TransactionId: detail.TransactionId, Error: detail})
+}
+
+// writeBadRequest writes a 400 error Response for an invalid request.
+func writeBadRequest(w http.ResponseWriter, message string) {
+	writeErrorDetail(w, http.StatusBadRequest, &ErrorDetail{Code: ErrorInvalidRequest, Message: message})
+}
+
+// writeError writes the error Response for a failed Gateway call.
+func writeError(w http.ResponseWriter, err error) {
+	status, detail := describeError(err)
+	slog.Error("Gateway call failed", "status", status, "code", detail.Code, "message", detail.Message, "transactionId", detail.TransactionId)
+	writeErrorDetail(w, status, detail)
+}
+
+// describeError returns the HTTP status and error detail of a failed Gateway call.
+func describeError(err error) (int, *ErrorDetail) {
+	var endorseErr *client.EndorseError
+	var submitErr *client.SubmitError
+	var commitStatusErr *client.CommitStatusError
+	var commitErr *client.CommitError
+	var failure *commitFailure
+	switch {
+	case errors.As(err, &endorseErr):
+		return describeStatus(ErrorEndorsementFailed, endorseErr.TransactionID, status.Convert(err))
+	case errors.As(err, &submitErr):
+		return describeStatus(ErrorSubmitFailed, submitErr.TransactionID, status.Convert(err))
+	case errors.As(err, &commitStatusErr):
+		return describeStatus(ErrorCommitStatusUnavailable, commitStatusErr.TransactionID, status.Convert(err))
+	case errors.As(err, &commitErr):
+		return describeCommitFailure(commitErr.TransactionID, commitErr.Code)
+	case errors.As(err, &failure):
+		return describeCommitFailure(failure.TransactionID, failure.Code)
+	}
+	if st, ok := status.FromError(err); ok {
+		return describeStatus(ErrorChaincode, "", st)
+	}
+	return http.StatusInternalServerError, &ErrorDetail{Code: ErrorInternal, Message: err.Error()}
+}
+
+// describeStatus describes a gRPC status error returned by the Gateway at the stage named by
+// code. Errors raised by the chaincode during endorsement or evaluation are client errors;
+// other failures are reported as failures of the Gateway or the network.
+func describeStatus(code string, transactionID string, st *status.Status) (int, *ErrorDetail) {
+	detail := &ErrorDetail{
+		Code:          code,
+		Message:       st.Message(),
+		TransactionId: transactionID,
+		GrpcCode:      st.Code().String(),
+	}
+	messages := []string{st.Message()}
+	for _, d := range st.Details() {
+		if errorDetail, ok := d.(*gateway.ErrorDetail); ok {
+			detail.Endorsements = append(detail.Endorsements, EndorsementDetail{
+				Address: errorDetail.GetAddress(),
+				MspId:   errorDetail.GetMspId(),
+				Message: errorDetail.GetMessage(),
+			})
+			messages = append(messages, errorDetail.GetMessage())
+		}
+	}
+
+	switch st.Code() {
+	case codes.Unavailable:
+		detail.Code = ErrorUnavailable
+		return http.StatusServiceUnavailable, detail
+	case codes.DeadlineExceeded:
+		detail.Code = ErrorTimeout
+		return http.StatusGatewayTimeout, detail
+	}
+	if code == ErrorSubmitFailed || code == ErrorCommitStatusUnavailable {
+		return http.StatusBadGateway, detail
+	}
+
+	// The chaincode's message is the same from every endorser; use the first found.
+	for _, message := range messages {
+		match := chaincodeResponsePattern.FindStringSubmatch(message)
+		if match == nil {
+			continue
+		}
+		detail.Message = match[1]
+		var structured struct {
+			Code string `json:"Code"`
+		}
+		if json.Unmarshal([]byte(match[1]), &structured) == nil && structured.Code != "" {
+			detail.Code = structured.Code
+			detail.Chaincode = json.RawMessage(match[1])
+			if httpStatus, ok := chaincodeStatusCodes[structured.Code]; ok {
+				return httpStatus, detail
+			}
+			return http.StatusUnprocessableEntity, detail
+		}
+		return chaincodeMessageStatus(detail), detail
+	}
+
+	switch st.Code() {
+	case codes.PermissionDenied:
+		detail.Code = ErrorForbidden
+		return http.StatusForbidden, detail
+	case codes.NotFound:
+		detail.Code = ErrorNotFound
+		return http.StatusNotFound, detail
+	case codes.InvalidArgument:
+		detail.Code = ErrorInvalidRequest
+		return http.StatusBadRequest, detail
+	}
+	return http.StatusBadGateway, detail
+}
+
+// chaincodeMessageStatus returns the HTTP status of a chaincode error with a plain message,
+// recognising the chaincode's access control and missing record errors.
+func chaincodeMessageStatus(detail *ErrorDetail) int {
+	switch {
+	case strings.Contains(detail.Message, "is not permitted to call"):
+		detail.Code = ErrorForbidden
+		return http.StatusForbidden
+	case strings.Contains(detail.Message, "does not exist"), strings.Contains(detail.Message, "not found"):
+		detail.Code = ErrorNotFound
+		return http.StatusNotFound
+	}
+	detail.Code = ErrorChaincode
+	return http.StatusUnprocessableEntity
+}
+
+// describeCommitFailure describes a transaction that failed validation. Read conflicts are
+// reported as 409, since the client may retry the transaction.
+func describeCommitFailure(transactionID string, code peer.TxValidationCode) (int, *ErrorDetail) {
+	detail := &ErrorDetail{
+		Code:           ErrorCommitFailed,
+		Message:        fmt.Sprintf("transaction %s failed to commit with status %s", transactionID, code),
+		TransactionId:  transactionID,
+		ValidationCode: code.String(),
+	}
+	switch code {
+	case peer.TxValidationCode_MVCC_READ_CONFLICT, peer.TxValidationCode_PHANTOM_READ_CONFLICT:
+		detail.Code = ErrorCommitConflict
+		return http.StatusConflict, detail
+	}
+	return http.StatusBadGateway, detail
+}
@@ -0,0 +1,144 @@
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+	"github.com/hyperledger/fabric-protos-go-apiv2/gateway"
+	"github.com/hyperledger/fabric-protos-go-apiv2/peer"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// endorsementStatus returns the status the Gateway returns when the chaincode rejects a
+// proposal on both endorsing peers.
+func endorsementStatus(t *testing.T, chaincodeMessage string) *status.Status {
+	t.Helper()
+	st, err := status.New(codes.Aborted, "failed to endorse transaction, see attached details for more info").WithDetails(
+		&gateway.ErrorDetail{Address: "peer0.org1.example.com:7051", MspId: "Org1MSP", Message: "chaincode response 500, " + chaincodeMessage},
+		&gateway.ErrorDetail{Address: "peer0.org2.example.com:9051", MspId: "Org2MSP", Message: "chaincode response 500, " + chaincodeMessage},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return st
+}
+
+func TestDescribeEndorsementErrors(t *testing.T) {
+	transition := `{"Code":"IllegalStatusTransition","PrescriptionId":"rx1","From":"Dispensed","To":"Revoked","Allowed":[]}`
+	tests := []struct {
+		name    string
+		message string
+		status  int
+		code    string
+	}{
+		{name: "structured", message: transition, status: http.StatusConflict, code: "IllegalStatusTransition"},
+		{name: "forbidden", message: "caller pharmacist1 with role 'pharmacist' is not permitted to call CreateAsset", status: http.StatusForbidden, code: ErrorForbidden},
+		{name: "not found", message: "asset patient9 does not exist", status: http.StatusNotFound, code: ErrorNotFound},
+		{name: "validation", message: "patientId is required", status: http.StatusUnprocessableEntity, code: ErrorChaincode},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			httpStatus, detail := describeStatus(ErrorEndorsementFailed, "tx1", endorsementStatus(t, tt.message))
+			if httpStatus != tt.status || detail.Code != tt.code {
+				t.Fatalf("got %d %s, expected %d %s", httpStatus, detail.Code, tt.status, tt.code)
+			}
+			if detail.Message != tt.message || detail.TransactionId != "tx1" || detail.GrpcCode != "Aborted" {
+				t.Errorf("unexpected detail %+v", detail)
+			}
+			if len(detail.Endorsements) != 2 || detail.Endorsements[1].MspId != "Org2MSP" {
+				t.Errorf("missing endorsement details %+v", detail.Endorsements)
+			}
+		})
+	}
+
+	_, detail := describeStatus(ErrorEndorsementFailed, "tx1", endorsementStatus(t, transition))
+	if string(detail.Chaincode) != transition {
+		t.Errorf("chaincode error not kept as JSON: %s", detail.Chaincode)
+	}
+}
+
+func TestDescribeGatewayFailures(t *testing.T) {
+	tests := []struct {
+		name   string
+		code   string
+		status *status.Status
+		http   int
+		error  string
+	}{
+		{name: "unavailable", code: ErrorEndorsementFailed, status: status.New(codes.Unavailable, "connection refused"), http: http.StatusServiceUnavailable, error: ErrorUnavailable},
+		{name: "timeout", code: ErrorCommitStatusUnavailable, status: status.New(codes.DeadlineExceeded, "context deadline exceeded"), http: http.StatusGatewayTimeout, error: ErrorTimeout},
+		{name: "submit", code: ErrorSubmitFailed, status: status.New(codes.Aborted, "orderer rejected"), http: http.StatusBadGateway, error: ErrorSubmitFailed},
+		{name: "unknown chaincode", code: ErrorEndorsementFailed, status: status.New(codes.NotFound, "chaincode basic2 not found"), http: http.StatusNotFound, error: ErrorNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			httpStatus, detail := describeStatus(tt.code, "tx1", tt.status)
+			if httpStatus != tt.http || detail.Code != tt.error {
+				t.Fatalf("got %d %s, expected %d %s", httpStatus, detail.Code, tt.http, tt.error)
+			}
+		})
+	}
+}
+
+func TestDescribeCommitErrors(t *testing.T) {
+	httpStatus, detail := describeError(&client.CommitError{TransactionID: "tx1", Code: peer.TxValidationCode_MVCC_READ_CONFLICT})
+	if httpStatus != http.StatusConflict || detail.Code != ErrorCommitConflict || detail.ValidationCode != "MVCC_READ_CONFLICT" {
+		t.Errorf("unexpected read conflict description %d %+v", httpStatus, detail)
+	}
+
+	httpStatus, detail = describeError(fmt.Errorf("submit: %w", &commitFailure{TransactionID: "tx2", Code: peer.TxValidationCode_ENDORSEMENT_POLICY_FAILURE}))
+	if httpStatus != http.StatusBadGateway || detail.Code != ErrorCommitFailed || detail.TransactionId != "tx2" {
+		t.Errorf("unexpected commit failure description %d %+v", httpStatus, detail)
+	}
+
+	httpStatus, detail = describeError(errors.New("boom"))
+	if httpStatus != http.StatusInternalServerError || detail.Code != ErrorInternal {
+		t.Errorf("unexpected description of a plain error %d %+v", httpStatus, detail)
+	}
+}
+
+func TestErrorEnvelope(t *testing.T) {
+	contract := &stubContract{err: endorsementStatus(t, `{"Code":"IllegalStatusTransition","PrescriptionId":"rx1","From":"Revoked","To":"Revoked","Allowed":[]}`).Err()}
+	response := serve(&OrgSetup{Contract: contract}, http.MethodPost, "/prescriptions/rx1/revoke", `{"PatientId":"patient1"}`)
+	if response.Code != http.StatusConflict {
+		t.Fatalf("expected 409, got %d: %s", response.Code, response.Body)
+	}
+
+	var envelope struct {
+		Error struct {
+			Code      string
+			Chaincode struct {
+				From string
+			}
+		}
+	}
+	if err := json.Unmarshal(response.Body.Bytes(), &envelope); err != nil {
+		t.Fatal(err)
+	}
+	if envelope.Error.Code != "IllegalStatusTransition" || envelope.Error.Chaincode.From != "Revoked" {
+		t.Errorf("unexpected error envelope %s", response.Body)
+	}
+
+	response = serve(&OrgSetup{Contract: contract}, http.MethodPost, "/prescriptions/rx1/revoke", `{"PatientId":`)
+	if response.Code != http.StatusBadRequest || !json.Valid(response.Body.Bytes()) {
+		t.Errorf("invalid request: expected a 400 JSON envelope, got %d: %s", response.Code, response.Body)
+	}
+}
+
+func TestResultJSON(t *testing.T) {
+	tests := map[string]string{
+		`{"PatientId":"001"}`: `{"PatientId":"001"}`,
+		`patient1`:            `"patient1"`,
+		``:                    ``,
+	}
+	for result, expected := range tests {
+		if actual := string(resultJSON([]byte(result))); actual != expected {
+			t.Errorf("resultJSON(%q) = %s, expected %s", result, actual, expected)
+		}
+	}
+}
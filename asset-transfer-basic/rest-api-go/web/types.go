@@ -0,0 +1,230 @@
+package web
+
+import (
+	"fmt"
+	"strings"
+)
+
+// The types below mirror the JSON of the chaincode's Asset and Prescription types and the
+// results of its transactions. Request bodies are decoded into them strictly, so a misspelt
+// or unknown field is rejected before anything is sent to the chaincode, and chaincode
+// responses are decoded into them before being returned.
+
+// minSaltLength matches the chaincode's minimum salt for private data hashes.
+const minSaltLength = 16
+
+// Asset is a patient with their prescriptions, as returned by ReadAsset.
+type Asset struct {
+	DoctorId        string         `json:"DoctorId"`
+	PatientName     string         `json:"PatientName"`
+	PatientId       string         `json:"PatientId"`
+	DateOfBirth     string         `json:"DateOfBirth,omitempty"`
+	Prescriptions   []Prescription `json:"Prescriptions"`
+	LastUpdated     string         `json:"LastUpdated"`
+	PrivateDataHash string         `json:"PrivateDataHash,omitempty"`
+}
+
+// Prescription is a prescription as stored by the chaincode.
+type Prescription struct {
+	PrescriptionId       string            `json:"PrescriptionId"`
+	PatientId            string            `json:"PatientId,omitempty"`
+	MedicationName       string            `json:"MedicationName"`
+	Dosage               string            `json:"Dosage"`
+	Medication           *CodedMedication  `json:"Medication,omitempty"`
+	Dose                 *Dose             `json:"Dose,omitempty"`
+	Instructions         string            `json:"Instructions"`
+	Diagnosis            string            `json:"Diagnosis"`
+	Status               string            `json:"Status"`
+	CreatedBy            string            `json:"CreatedBy"`
+	TxID                 string            `json:"TxID"`
+	Timestamp            string            `json:"Timestamp"`
+	CreatedAt            string            `json:"CreatedAt,omitempty"`
+	ExpiryDate           string            `json:"ExpiryDate,omitempty"`
+	Quantity             int               `json:"Quantity,omitempty"`
+	Refills              int               `json:"Refills,omitempty"`
+	Dispensations        []Dispensation    `json:"Dispensations,omitempty"`
+	DispensingPharmacist string            `json:"dispensingPharmacist,omitempty"`
+	DispensingTimestamp  string            `json:"dispensingTimestamp,omitempty"`
+	PrivateDataHash      string            `json:"PrivateDataHash,omitempty"`
+	Amendments           []Amendment       `json:"Amendments,omitempty"`
+	AllergyOverrides     []AllergyOverride `json:"AllergyOverrides,omitempty"`
+}
+
+// CodedMedication identifies a medication by its RxNorm or ATC code.
+type CodedMedication struct {
+	System  string `json:"System,omitempty"`
+	Code    string `json:"Code"`
+	Display string `json:"Display,omitempty"`
+}
+
+// Dose is a structured dose.
+type Dose struct {
+	Amount    float64 `json:"Amount"`
+	Unit      string  `json:"Unit"`
+	Route     string  `json:"Route,omitempty"`
+	Frequency string  `json:"Frequency,omitempty"`
+	Duration  string  `json:"Duration,omitempty"`
+}
+
+// Dispensation is one handout of a prescription.
+type Dispensation struct {
+	Fill         int    `json:"Fill"`
+	Quantity     int    `json:"Quantity"`
+	PharmacistId string `json:"PharmacistId"`
+	PharmacyId   string `json:"PharmacyId"`
+	TxID         string `json:"TxID"`
+	Timestamp    string `json:"Timestamp"`
+	Note         string `json:"Note,omitempty"`
+}
+
+// Amendment records a change to a prescription and the previous values.
+type Amendment struct {
+	TxID      string        `json:"TxID"`
+	Timestamp string        `json:"Timestamp"`
+	AmendedBy string        `json:"AmendedBy"`
+	Role      string        `json:"Role"`
+	Reason    string        `json:"Reason"`
+	Changes   []FieldChange `json:"Changes"`
+}
+
+// FieldChange is the previous and new value of one amended field.
+type FieldChange struct {
+	Field    string `json:"Field"`
+	Previous string `json:"Previous"`
+	New      string `json:"New"`
+}
+
+// AllergyOverride allows a prescription that matches one of the patient's allergies.
+type AllergyOverride struct {
+	Prescription  int    `json:"Prescription,omitempty"`
+	AllergyId     string `json:"AllergyId"`
+	Substance     string `json:"Substance,omitempty"`
+	Justification string `json:"Justification"`
+	OverriddenBy  string `json:"OverriddenBy,omitempty"`
+	Timestamp     string `json:"Timestamp,omitempty"`
+}
+
+// InteractionFinding is an interaction the chaincode found between two medications.
+type InteractionFinding struct {
+	Medication        string `json:"Medication"`
+	MedicationCode    string `json:"MedicationCode"`
+	InteractsWith     string `json:"InteractsWith"`
+	InteractsWithCode string `json:"InteractsWithCode"`
+	PrescriptionId    string `json:"PrescriptionId,omitempty"`
+	Severity          string `json:"Severity"`
+	Evidence          string `json:"Evidence,omitempty"`
+}
+
+// CreateAssetResult is the result of CreateAsset.
+type CreateAssetResult struct {
+	PatientId           string               `json:"PatientId"`
+	PrescriptionIds     []string             `json:"PrescriptionIds"`
+	InteractionWarnings []InteractionFinding `json:"InteractionWarnings,omitempty"`
+}
+
+// PrescriptionPage is one page of a paginated prescription query.
+type PrescriptionPage struct {
+	Records             []Prescription `json:"Records"`
+	FetchedRecordsCount int32          `json:"FetchedRecordsCount"`
+	Bookmark            string         `json:"Bookmark"`
+}
+
+// NewPrescription holds the fields a doctor supplies for a new prescription. The chaincode
+// assigns the rest.
+type NewPrescription struct {
+	MedicationName string           `json:"MedicationName,omitempty"`
+	Dosage         string           `json:"Dosage,omitempty"`
+	Medication     *CodedMedication `json:"Medication,omitempty"`
+	Dose           *Dose            `json:"Dose,omitempty"`
+	Instructions   string           `json:"Instructions,omitempty"`
+	ExpiryDate     string           `json:"ExpiryDate,omitempty"`
+	Quantity       int              `json:"Quantity,omitempty"`
+	Refills        int              `json:"Refills,omitempty"`
+}
+
+// CreatePrescriptionsRequest is the body of POST /patients/{id}/prescriptions. PatientName,
+// DateOfBirth, Salt, Diagnoses and AllergyOverrides are private and are sent to the chaincode
+// as transient data; Diagnoses holds one diagnosis per prescription.
+type CreatePrescriptionsRequest struct {
+	Prescriptions    []NewPrescription `json:"Prescriptions"`
+	PatientName      string            `json:"PatientName,omitempty"`
+	DateOfBirth      string            `json:"DateOfBirth,omitempty"`
+	Salt             string            `json:"Salt"`
+	Diagnoses        []string          `json:"Diagnoses"`
+	AllergyOverrides []AllergyOverride `json:"AllergyOverrides,omitempty"`
+}
+
+func (request *CreatePrescriptionsRequest) validate() error {
+	if len(request.Prescriptions) == 0 {
+		return fmt.Errorf("at least one prescription is required")
+	}
+	for i, prescription := range request.Prescriptions {
+		if strings.TrimSpace(prescription.MedicationName) == "" && (prescription.Medication == nil || prescription.Medication.Code == "") {
+			return fmt.Errorf("prescription %d requires a MedicationName or a Medication code", i)
+		}
+		if dose := prescription.Dose; dose != nil && (dose.Amount <= 0 || strings.TrimSpace(dose.Unit) == "") {
+			return fmt.Errorf("prescription %d requires a positive dose Amount and a Unit", i)
+		}
+		if prescription.Quantity < 0 || prescription.Refills < 0 {
+			return fmt.Errorf("prescription %d has a negative Quantity or Refills", i)
+		}
+	}
+	if len(request.Salt) < minSaltLength {
+		return fmt.Errorf("Salt must be at least %d characters", minSaltLength)
+	}
+	if len(request.Diagnoses) != len(request.Prescriptions) {
+		return fmt.Errorf("one diagnosis is required per prescription")
+	}
+	for _, diagnosis := range request.Diagnoses {
+		if strings.TrimSpace(diagnosis) == "" {
+			return fmt.Errorf("diagnoses must not be empty")
+		}
+	}
+	for _, override := range request.AllergyOverrides {
+		if override.Prescription < 0 || override.Prescription >= len(request.Prescriptions) {
+			return fmt.Errorf("allergy override names prescription %d, but %d were submitted", override.Prescription, len(request.Prescriptions))
+		}
+		if override.AllergyId == "" || strings.TrimSpace(override.Justification) == "" {
+			return fmt.Errorf("an allergy override requires an AllergyId and a Justification")
+		}
+	}
+	return nil
+}
+
+// DispenseRequest is the body of POST /prescriptions/{id}/dispense. Without a Quantity the
+// rest of the current fill is dispensed. The pharmacist is the caller.
+type DispenseRequest struct {
+	PatientId  string `json:"PatientId"`
+	Quantity   int    `json:"Quantity,omitempty"`
+	PharmacyId string `json:"PharmacyId,omitempty"`
+	Note       string `json:"Note,omitempty"`
+}
+
+func (request *DispenseRequest) validate() error {
+	if request.PatientId == "" {
+		return fmt.Errorf("PatientId is required")
+	}
+	if request.Quantity < 0 {
+		return fmt.Errorf("Quantity must not be negative")
+	}
+	return nil
+}
+
+// RevokeRequest is the body of POST /prescriptions/{id}/revoke. The doctor is the caller.
+type RevokeRequest struct {
+	PatientId string `json:"PatientId"`
+}
+
+func (request *RevokeRequest) validate() error {
+	if request.PatientId == "" {
+		return fmt.Errorf("PatientId is required")
+	}
+	return nil
+}
+
+// TransactionResult identifies a committed transaction in the responses of the resource
+// endpoints.
+type TransactionResult struct {
+	TransactionId string `json:"TransactionId"`
+	BlockNumber   uint64 `json:"BlockNumber"`
+}
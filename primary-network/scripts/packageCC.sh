@@ -79,19 +79,46 @@ verifyResult() {
   fi
 }
 
+# CouchDB indexes under META-INF in the chaincode path are packaged with the chaincode and
+# created by peers whose state database is CouchDB. Peers running LevelDB ignore them.
+COUCHDB_INDEX_PATH=META-INF/statedb/couchdb/indexes
+
+checkCouchDBIndexes() {
+  if [ ! -d "${CC_SRC_PATH}/${COUCHDB_INDEX_PATH}" ]; then
+    infoln "No CouchDB indexes found at ${CC_SRC_PATH}/${COUCHDB_INDEX_PATH}"
+    return
+  fi
+  for index in "${CC_SRC_PATH}/${COUCHDB_INDEX_PATH}"/*.json; do
+    if ! jq -e '.index.fields and .ddoc and .name' "$index" > /dev/null 2>&1; then
+      fatalln "CouchDB index $index is not a valid index definition"
+    fi
+    infoln "Packaging CouchDB index $(basename "$index")"
+  done
+}
+
+verifyPackagedIndexes() {
+  if [ ! -d "${CC_SRC_PATH}/${COUCHDB_INDEX_PATH}" ]; then
+    return
+  fi
+  tar -xzOf "$1" code.tar.gz | tar -tz | grep -q "${COUCHDB_INDEX_PATH}/"
+  verifyResult $? "CouchDB indexes are missing from the chaincode package $1"
+}
+
 packageChaincode() {
-  set -x
+  checkCouchDBIndexes
+  PACKAGE_FILE=${CC_NAME}.tar.gz
   if [ ${CC_PACKAGE_ONLY} = true ] ; then
     mkdir -p packagedChaincode
-    peer lifecycle chaincode package packagedChaincode/${CC_NAME}_${CC_VERSION}.tar.gz --path ${CC_SRC_PATH} --lang ${CC_RUNTIME_LANGUAGE} --label ${CC_NAME}_${CC_VERSION} >&log.txt
-  else
-    peer lifecycle chaincode package ${CC_NAME}.tar.gz --path ${CC_SRC_PATH} --lang ${CC_RUNTIME_LANGUAGE} --label ${CC_NAME}_${CC_VERSION} >&log.txt
+    PACKAGE_FILE=packagedChaincode/${CC_NAME}_${CC_VERSION}.tar.gz
   fi
+  set -x
+  peer lifecycle chaincode package ${PACKAGE_FILE} --path ${CC_SRC_PATH} --lang ${CC_RUNTIME_LANGUAGE} --label ${CC_NAME}_${CC_VERSION} >&log.txt
   res=$?
   { set +x; } 2>/dev/null
   cat log.txt
-  PACKAGE_ID=$(peer lifecycle chaincode calculatepackageid ${CC_NAME}.tar.gz)
+  PACKAGE_ID=$(peer lifecycle chaincode calculatepackageid ${PACKAGE_FILE})
   verifyResult $res "Chaincode packaging has failed"
+  verifyPackagedIndexes ${PACKAGE_FILE}
   successln "Chaincode is packaged"
 }
 